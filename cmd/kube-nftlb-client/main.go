@@ -2,16 +2,66 @@ package main
 
 import (
 	"github.com/zevenet/kube-nftlb/pkg/auth"
+	"github.com/zevenet/kube-nftlb/pkg/config"
 	"github.com/zevenet/kube-nftlb/pkg/controller"
 	"github.com/zevenet/kube-nftlb/pkg/metrics"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+	"github.com/zevenet/kube-nftlb/pkg/webhook"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
 )
 
 func main() {
+	// Farm marks can't collide with the masquerade mark
+	masqueradeMark, err := validation.ParseMark(config.MasqueradeMark)
+	if err != nil {
+		panic(err)
+	}
+	validation.MasqueradeMark = masqueradeMark
+
+	// Start admission webhook server (optional)
+	if config.WebhookEnabled || config.WebhookOnly {
+		allowedExternalIPs, err := webhook.ParseNetworks(config.WebhookAllowedExternalIPs)
+		if err != nil {
+			panic(err)
+		}
+
+		go webhook.StartServer(config.WebhookAddress, config.WebhookCertFile, config.WebhookKeyFile, &webhook.Validator{
+			AllowedExternalIPs: allowedExternalIPs,
+			WarnOnly:           config.WebhookWarnOnly,
+		})
+
+		// The Deployment variant only serves the admission webhook
+		if config.WebhookOnly {
+			select {}
+		}
+	}
+
 	// Authentication: get access to the API
 	clientset := auth.GetClientset()
 
+	// Read default settings, farm templates, Pods, Nodes and TrafficSplits before any Service or Endpoints is applied,
+	// NftlbFarms are programmed once Pods and Nodes are known
+	settingsControllers := []cache.Controller{
+		controller.NewNamespaceController(clientset),
+		controller.NewPodController(clientset),
+		controller.NewNodeController(clientset),
+		controller.NewFarmTemplateController(clientset),
+	}
+	if defaultsController := controller.NewDefaultsController(clientset); defaultsController != nil {
+		settingsControllers = append(settingsControllers, defaultsController)
+	}
+	if trafficSplitController := controller.NewTrafficSplitController(auth.GetDynamicClient()); trafficSplitController != nil {
+		settingsControllers = append(settingsControllers, trafficSplitController)
+	}
+	if nftlbFarmController := controller.NewNftlbFarmController(auth.GetDynamicClient()); nftlbFarmController != nil {
+		settingsControllers = append(settingsControllers, nftlbFarmController)
+	}
+	for _, settingsController := range settingsControllers {
+		go settingsController.Run(wait.NeverStop)
+		cache.WaitForCacheSync(wait.NeverStop, settingsController.HasSynced)
+	}
+
 	// Get controllers
 	controllers := []cache.Controller{
 		controller.NewServiceController(clientset),
@@ -23,6 +73,25 @@ func main() {
 	// Start metrics server
 	go metrics.StartServer()
 
+	// Raise weights of new backends with slow start
+	go controller.RunSlowStart(wait.NeverStop)
+
+	// Set backends down while their health checks fail
+	go controller.RunHealthChecks(wait.NeverStop)
+
+	// Delete backends that have left once they're drained
+	go controller.RunDrains(wait.NeverStop)
+
+	// Delete conntrack entries of removed UDP backends and VIPs
+	go controller.RunConntrackCleanup(wait.NeverStop)
+
+	// Write the status annotation of Services
+	go controller.RunStatusUpdates(wait.NeverStop)
+
+	// Report programmed Pods and set their readiness gates (only the leader)
+	go controller.RunReadinessReport(clientset, wait.NeverStop)
+	go controller.RunReadinessGates(clientset, wait.NeverStop)
+
 	// Run controllers as background processes
 	for _, controller := range controllers {
 		go controller.Run(wait.NeverStop)
@@ -3,33 +3,62 @@ package auth
 import (
 	"flag"
 	"fmt"
+	"sync"
 
 	"github.com/zevenet/kube-nftlb/pkg/config"
 	"github.com/zevenet/kube-nftlb/pkg/log"
 	"github.com/zevenet/kube-nftlb/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-var clienset = authenticate(config.ClientCfgPath)
+var (
+	kubeconfig = flag.String("kubeconfig", config.ClientCfgPath, config.ClientCfgPath)
+
+	// Clients are made the first time they're used, once command line flags can be parsed
+	clientsOnce   sync.Once
+	clienset      *kubernetes.Clientset
+	dynamicClient dynamic.Interface
+)
 
 // GetClientset returns an already authenticated clienset.
 func GetClientset() *kubernetes.Clientset {
+	clientsOnce.Do(authenticateClients)
 	return clienset
 }
 
-// authenticate implements authentication to kube-nftlb. Stops the container if the authentication fails.
-func authenticate(cfg string) *kubernetes.Clientset {
+// GetDynamicClient returns an already authenticated dynamic client, it's used to read custom resources.
+func GetDynamicClient() dynamic.Interface {
+	clientsOnce.Do(authenticateClients)
+	return dynamicClient
+}
+
+// authenticateClients makes every client from the same configuration.
+func authenticateClients() {
+	restConfig := buildConfig()
+	clienset = authenticate(restConfig)
+	dynamicClient = authenticateDynamic(restConfig)
+}
+
+// buildConfig reads the configuration file used by every client. Stops the container if it couldn't be read.
+func buildConfig() *rest.Config {
 	// Parse command line flags
-	kubeconfig := flag.String("kubeconfig", cfg, cfg)
-	flag.Parse()
+	if !flag.Parsed() {
+		flag.Parse()
+	}
 
 	// Collects the path of the configuration file and generates the necessary configuration to then create the client
 	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
 	if err != nil {
 		panic(err)
 	}
+	return config
+}
 
+// authenticate implements authentication to kube-nftlb. Stops the container if the authentication fails.
+func authenticate(config *rest.Config) *kubernetes.Clientset {
 	// Create the clientset, based on the previous configuration
 	clienset, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -40,3 +69,12 @@ func authenticate(cfg string) *kubernetes.Clientset {
 
 	return clienset
 }
+
+// authenticateDynamic makes the dynamic client. Stops the container if it fails.
+func authenticateDynamic(config *rest.Config) dynamic.Interface {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	return dynamicClient
+}
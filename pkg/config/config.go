@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+
 	"github.com/zevenet/kube-nftlb/pkg/env"
 	"github.com/zevenet/kube-nftlb/pkg/types"
 )
@@ -9,4 +11,34 @@ var (
 	ClientCfgPath         = env.GetString("CLIENT_CFG_PATH")
 	ClientLevelLogs       = types.LogLevel(env.GetInt("CLIENT_LOGS_LEVEL"))
 	DockerInterfaceBridge = env.GetString("DOCKER_INTERFACE_BRIDGE")
+	MasqueradeMark        = env.GetStringDefault("NFTLB_MASQUERADE_MARK", "0x40000000")
+	NodeName              = env.GetStringDefault("NODE_NAME", hostname())
+	HelpersMap            = env.GetStringDefault("CLIENT_HELPERS_MAP", "")
+	HelpersByPortName     = env.GetBoolDefault("CLIENT_HELPERS_BY_PORT_NAME", false)
+	CompactFarms          = env.GetBoolDefault("CLIENT_COMPACT_FARMS", false)
+	DefaultsConfigMap     = env.GetStringDefault("CLIENT_DEFAULTS_CONFIGMAP", "kube-system/kube-nftlb-defaults")
+	TrafficSplits         = env.GetBoolDefault("CLIENT_TRAFFIC_SPLITS", false)
+	NftlbFarms            = env.GetBoolDefault("CLIENT_NFTLB_FARMS", false)
+	HealthChecks          = env.GetBoolDefault("CLIENT_HEALTH_CHECKS", false)
+	ReadinessGates        = env.GetBoolDefault("CLIENT_READINESS_GATES", false)
+	ReadinessNamespace    = env.GetStringDefault("CLIENT_READINESS_NAMESPACE", "kube-system")
+	ConntrackCleanup      = env.GetBoolDefault("CLIENT_CONNTRACK_CLEANUP", true)
+
+	WebhookEnabled            = env.GetBoolDefault("WEBHOOK_ENABLED", false)
+	WebhookOnly               = env.GetBoolDefault("WEBHOOK_ONLY", false)
+	WebhookAddress            = env.GetStringDefault("WEBHOOK_ADDRESS", ":9443")
+	WebhookCertFile           = env.GetStringDefault("WEBHOOK_CERT_FILE", "/var/run/kube-nftlb-webhook/tls.crt")
+	WebhookKeyFile            = env.GetStringDefault("WEBHOOK_KEY_FILE", "/var/run/kube-nftlb-webhook/tls.key")
+	WebhookAllowedExternalIPs = env.GetStringDefault("WEBHOOK_ALLOWED_EXTERNAL_IPS", "")
+	WebhookWarnOnly           = env.GetBoolDefault("WEBHOOK_WARN_ONLY", false)
 )
+
+// hostname returns the host name reported by the kernel. kube-nftlb runs with hostNetwork, so it's the node name
+// unless the node was registered with another name (NODE_NAME must be set in that case).
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		panic(err)
+	}
+	return name
+}
@@ -0,0 +1,196 @@
+package conntrack
+
+import (
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+)
+
+// Kinds of targets, exported as the label of deleted entries
+const (
+	KindBackend = "backend"
+	KindVIP     = "vip"
+)
+
+// Target matches conntrack entries whose destination has been removed.
+type Target struct {
+	// KindBackend matches the source of the reply direction (nftlb translates the destination of every connection to
+	// a backend), KindVIP matches the destination of the original direction
+	Kind string
+
+	IP       net.IP
+	Port     uint16 // 0 matches every port
+	Protocol uint8  // 0 matches every protocol
+
+	// VIPs of the farm of a backend, only connections sent to them are matched
+	VIPs []VIP
+}
+
+// BackendTarget returns a Target for UDP entries sent from the VIPs of a farm to a removed backend. UDP has no
+// connections to close, so clients keep sending datagrams to the backend until the entry expires.
+func BackendTarget(ip string, port uint16, vips []VIP) Target {
+	return Target{Kind: KindBackend, IP: net.ParseIP(ip), Port: port, Protocol: syscall.IPPROTO_UDP, VIPs: vips}
+}
+
+// VIPTarget returns a Target for entries sent to a removed VIP port.
+func VIPTarget(ip string, port uint16, protocol uint8) Target {
+	return Target{Kind: KindVIP, IP: net.ParseIP(ip), Port: port, Protocol: protocol}
+}
+
+// match returns true if a flow has been sent to the target.
+func (t Target) match(flow Flow) bool {
+	if t.Protocol != 0 && flow.Protocol != t.Protocol {
+		return false
+	}
+
+	ip, port := flow.Forward.DstIP, flow.Forward.DstPort
+	if t.Kind == KindBackend {
+		if !matchVIPs(t.VIPs, flow.Forward.DstIP, flow.Forward.DstPort, flow.Protocol) {
+			return false
+		}
+		ip, port = flow.Reverse.SrcIP, flow.Reverse.SrcPort
+	}
+	return ip.Equal(t.IP) && (t.Port == 0 || port == t.Port)
+}
+
+// Cleaner deletes conntrack entries of removed targets in batches: targets are queued, and every entry that matches
+// any of them is deleted with a single dump of the conntrack table (for every family).
+type Cleaner struct {
+	ns      netns.NsHandle
+	sockets map[int]*nl.SocketHandle
+
+	mutex   sync.Mutex
+	pending []pendingTarget
+}
+
+// pendingTarget is a Target waiting for the next batch.
+type pendingTarget struct {
+	target Target
+	added  time.Time
+}
+
+// NewCleaner returns a Cleaner that works in a network namespace. netns.None() works in the network namespace of
+// kube-nftlb.
+func NewCleaner(ns netns.NsHandle) *Cleaner {
+	return &Cleaner{ns: ns}
+}
+
+// Add queues targets for the next batch. Targets without a valid IP are ignored.
+func (c *Cleaner) Add(targets ...Target) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for _, target := range targets {
+		if target.IP != nil {
+			c.pending = append(c.pending, pendingTarget{target: target, added: now})
+		}
+	}
+}
+
+// Flush deletes every entry that matches a target queued at least delay ago, so nftlb has stopped sending traffic to
+// it and new entries don't go to the same destination. It returns how many entries have been deleted. Flush mustn't
+// be called concurrently.
+func (c *Cleaner) Flush(delay time.Duration) (uint, error) {
+	c.mutex.Lock()
+	targets := make([]Target, 0)
+	pending := make([]pendingTarget, 0)
+	for _, item := range c.pending {
+		if time.Since(item.added) >= delay {
+			targets = append(targets, item.target)
+		} else {
+			pending = append(pending, item)
+		}
+	}
+	c.pending = pending
+	c.mutex.Unlock()
+
+	if len(targets) == 0 {
+		return 0, nil
+	}
+
+	metrics.ConntrackCleanupsTotal.Inc()
+	if err := c.openSocket(); err != nil {
+		metrics.ConntrackCleanupErrorsTotal.Inc()
+		return 0, err
+	}
+
+	// Every family is cleaned even if the other one fails, the first error is returned
+	deleted := uint(0)
+	var flushErr error
+	for _, family := range []netlink.InetFamily{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		count, err := c.deleteFlows(family, targets)
+		deleted += count
+		if err != nil && flushErr == nil {
+			flushErr = err
+		}
+	}
+	if flushErr != nil {
+		metrics.ConntrackCleanupErrorsTotal.Inc()
+	}
+	return deleted, flushErr
+}
+
+// openSocket opens the netfilter socket of the Cleaner in its network namespace, unless it's open already.
+func (c *Cleaner) openSocket() error {
+	if c.sockets != nil {
+		return nil
+	}
+
+	socket, err := nl.GetNetlinkSocketAt(c.ns, netns.None(), syscall.NETLINK_NETFILTER)
+	if err != nil {
+		return err
+	}
+	if err := socket.SetSendTimeout(&nl.SocketTimeoutTv); err != nil {
+		socket.Close()
+		return err
+	}
+	if err := socket.SetReceiveTimeout(&nl.SocketTimeoutTv); err != nil {
+		socket.Close()
+		return err
+	}
+
+	c.sockets = map[int]*nl.SocketHandle{syscall.NETLINK_NETFILTER: {Socket: socket}}
+	return nil
+}
+
+// deleteFlows deletes the entries of a family that match any target. Deleted entries are counted by the kind of the
+// target that matched them. Entries that have expired since the dump aren't errors.
+func (c *Cleaner) deleteFlows(family netlink.InetFamily, targets []Target) (uint, error) {
+	msgs, err := newRequest(nl.IPCTNL_MSG_CT_GET, syscall.NLM_F_DUMP, family, c.sockets).Execute(syscall.NETLINK_NETFILTER, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := uint(0)
+	var deleteErr error
+	for _, msg := range msgs {
+		if len(msg) <= nl.SizeofNfgenmsg {
+			continue
+		}
+
+		flow := parseFlow(msg[nl.SizeofNfgenmsg:])
+		for _, target := range targets {
+			if !target.match(flow) {
+				continue
+			}
+
+			req := newRequest(nl.IPCTNL_MSG_CT_DELETE, syscall.NLM_F_ACK, family, c.sockets)
+			req.AddRawData(msg[nl.SizeofNfgenmsg:])
+			if _, err := req.Execute(syscall.NETLINK_NETFILTER, 0); err == nil {
+				metrics.ConntrackEntriesDeletedTotal.WithLabelValues(target.Kind).Inc()
+				deleted++
+			} else if err != syscall.ENOENT && deleteErr == nil {
+				deleteErr = err
+			}
+			break
+		}
+	}
+	return deleted, deleteErr
+}
@@ -0,0 +1,258 @@
+package conntrack
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+)
+
+// Kernel flag of confirmed conntrack entries (IPS_CONFIRMED in linux/netfilter/nf_conntrack_common.h)
+const ipsConfirmed = 1 << 3
+
+// newNetns returns a new network namespace, without moving the test into it.
+func newNetns(t *testing.T) netns.NsHandle {
+	t.Helper()
+
+	if os.Geteuid() != 0 {
+		t.Skip("network namespaces need root")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origin.Close()
+
+	ns, err := netns.New()
+	if err != nil {
+		t.Skipf("can't make a network namespace: %s", err.Error())
+	}
+	if err := netns.Set(origin); err != nil {
+		t.Fatal(err)
+	}
+	return ns
+}
+
+// createUDPFlow adds a UDP conntrack entry from a client to a destination, answered by a source.
+func createUDPFlow(t *testing.T, sockets map[int]*nl.SocketHandle, client string, dst string, dstPort uint16, reply string, replyPort uint16) {
+	t.Helper()
+
+	var family netlink.InetFamily = netlink.FAMILY_V4
+	ipAttrs := [2]int{nl.CTA_IP_V4_SRC, nl.CTA_IP_V4_DST}
+	ip := func(value string) []byte {
+		return net.ParseIP(value).To4()
+	}
+	if net.ParseIP(client).To4() == nil {
+		family = netlink.FAMILY_V6
+		ipAttrs = [2]int{nl.CTA_IP_V6_SRC, nl.CTA_IP_V6_DST}
+		ip = func(value string) []byte {
+			return net.ParseIP(value).To16()
+		}
+	}
+	be16 := func(value uint16) []byte {
+		data := make([]byte, 2)
+		binary.BigEndian.PutUint16(data, value)
+		return data
+	}
+	be32 := func(value uint32) []byte {
+		data := make([]byte, 4)
+		binary.BigEndian.PutUint32(data, value)
+		return data
+	}
+	tuple := func(attrType int, src string, dst string, srcPort uint16, dstPort uint16) *nl.RtAttr {
+		tuple := nl.NewRtAttr(attrType|int(nl.NLA_F_NESTED), nil)
+		ipAttr := tuple.AddRtAttr(nl.CTA_TUPLE_IP|int(nl.NLA_F_NESTED), nil)
+		ipAttr.AddRtAttr(ipAttrs[0], ip(src))
+		ipAttr.AddRtAttr(ipAttrs[1], ip(dst))
+		proto := tuple.AddRtAttr(nl.CTA_TUPLE_PROTO|int(nl.NLA_F_NESTED), nil)
+		proto.AddRtAttr(nl.CTA_PROTO_NUM, []byte{syscall.IPPROTO_UDP})
+		proto.AddRtAttr(nl.CTA_PROTO_SRC_PORT, be16(srcPort))
+		proto.AddRtAttr(nl.CTA_PROTO_DST_PORT, be16(dstPort))
+		return tuple
+	}
+
+	// IPCTNL_MSG_CT_NEW is 0
+	req := newRequest(0, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL|syscall.NLM_F_ACK, family, sockets)
+	req.AddData(tuple(nl.CTA_TUPLE_ORIG, client, dst, 40000, dstPort))
+	req.AddData(tuple(nl.CTA_TUPLE_REPLY, reply, client, replyPort, 40000))
+	req.AddData(nl.NewRtAttr(nl.CTA_STATUS, be32(ipsConfirmed)))
+	req.AddData(nl.NewRtAttr(nl.CTA_TIMEOUT, be32(60)))
+	if _, err := req.Execute(syscall.NETLINK_NETFILTER, 0); err != nil {
+		t.Skipf("can't create conntrack entries: %s", err.Error())
+	}
+}
+
+// deletedEntries returns how many entries have been deleted for a kind of target.
+func deletedEntries(t *testing.T, kind string) float64 {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.ConntrackEntriesDeletedTotal)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "target" && label.GetValue() == kind {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestCleanerFlush(t *testing.T) {
+	ns := newNetns(t)
+	defer ns.Close()
+
+	socket, err := nl.GetNetlinkSocketAt(ns, netns.None(), syscall.NETLINK_NETFILTER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	sockets := map[int]*nl.SocketHandle{syscall.NETLINK_NETFILTER: {Socket: socket}}
+
+	// Sent from the VIP to the removed backend
+	createUDPFlow(t, sockets, "10.0.0.1", "10.96.0.10", 53, "172.17.0.2", 5353)
+	createUDPFlow(t, sockets, "fd00::1", "fd00::10", 53, "fd00::2", 5353)
+	// Sent to the removed backend without the VIP
+	createUDPFlow(t, sockets, "10.0.0.2", "172.17.0.2", 5353, "172.17.0.2", 5353)
+	// Sent from the VIP to another backend
+	createUDPFlow(t, sockets, "10.0.0.3", "10.96.0.10", 53, "172.17.0.3", 5353)
+	// Sent to a removed VIP
+	createUDPFlow(t, sockets, "10.0.0.4", "10.96.0.20", 80, "172.17.0.4", 8080)
+
+	backends, vips := deletedEntries(t, KindBackend), deletedEntries(t, KindVIP)
+
+	cleaner := NewCleaner(ns)
+	cleaner.Add(
+		BackendTarget("172.17.0.2", 5353, []VIP{NewVIP("10.96.0.10", "53", syscall.IPPROTO_UDP)}),
+		BackendTarget("fd00::2", 5353, []VIP{NewVIP("fd00::10", "53", syscall.IPPROTO_UDP)}),
+		VIPTarget("10.96.0.20", 80, syscall.IPPROTO_UDP),
+	)
+	deleted, err := cleaner.Flush(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 3 {
+		t.Fatalf("got %d deleted entries, want 3", deleted)
+	}
+	if got := deletedEntries(t, KindBackend) - backends; got != 2 {
+		t.Fatalf("got %v deleted backend entries, want 2", got)
+	}
+	if got := deletedEntries(t, KindVIP) - vips; got != 1 {
+		t.Fatalf("got %v deleted VIP entries, want 1", got)
+	}
+
+	// The rest of the entries are kept
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Delete()
+
+	flows, err := handle.ConntrackTableList(netlink.ConntrackTable, netlink.FAMILY_V4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flowsV6, err := handle.ConntrackTableList(netlink.ConntrackTable, netlink.FAMILY_V6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 2 || len(flowsV6) != 0 {
+		t.Fatalf("got %d IPv4 and %d IPv6 entries, want 2 and 0", len(flows), len(flowsV6))
+	}
+	for _, flow := range flows {
+		if flow.Reverse.SrcIP.Equal(net.ParseIP("172.17.0.2")) && flow.Forward.DstIP.Equal(net.ParseIP("10.96.0.10")) {
+			t.Fatalf("got the entry %s, want it deleted", flow.String())
+		}
+	}
+
+	// Nothing is deleted without targets
+	if deleted, err := cleaner.Flush(0); deleted != 0 || err != nil {
+		t.Fatalf("got %d deleted entries and error %v, want 0 and nil", deleted, err)
+	}
+}
+
+// udpFlow returns a UDP flow from a client to a destination, answered by a source.
+func udpFlow(dst string, dstPort uint16, reply string, replyPort uint16) Flow {
+	return Flow{
+		Protocol: syscall.IPPROTO_UDP,
+		Forward:  Tuple{SrcIP: net.ParseIP("10.0.0.1"), DstIP: net.ParseIP(dst), SrcPort: 40000, DstPort: dstPort},
+		Reverse:  Tuple{SrcIP: net.ParseIP(reply), DstIP: net.ParseIP("10.0.0.1"), SrcPort: replyPort, DstPort: 40000},
+	}
+}
+
+func TestTargetMatch(t *testing.T) {
+	vips := []VIP{NewVIP("10.96.0.10", "53", syscall.IPPROTO_UDP)}
+	targets := []Target{
+		BackendTarget("172.17.0.2", 5353, vips),
+		BackendTarget("172.17.0.5", 0, vips),
+		VIPTarget("10.96.0.20", 80, syscall.IPPROTO_UDP),
+	}
+
+	tests := []struct {
+		name string
+		flow Flow
+		want bool
+	}{
+		{"sent from the VIP to a removed backend", udpFlow("10.96.0.10", 53, "172.17.0.2", 5353), true},
+		{"sent from the VIP to another port of a removed backend", udpFlow("10.96.0.10", 53, "172.17.0.2", 5354), false},
+		{"sent from the VIP to any port of a removed backend", udpFlow("10.96.0.10", 53, "172.17.0.5", 8080), true},
+		{"sent to a removed backend without the VIP", udpFlow("172.17.0.2", 5353, "172.17.0.2", 5353), false},
+		{"sent from the VIP to another backend", udpFlow("10.96.0.10", 53, "172.17.0.3", 5353), false},
+		{"sent to a removed VIP", udpFlow("10.96.0.20", 80, "172.17.0.4", 8080), true},
+		{"sent to another port of a removed VIP", udpFlow("10.96.0.20", 81, "172.17.0.4", 8080), false},
+	}
+
+	for _, test := range tests {
+		got := false
+		for _, target := range targets {
+			got = got || target.match(test.flow)
+		}
+		if got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+
+	// TCP entries of removed backends are closed by their connections
+	flow := udpFlow("10.96.0.10", 53, "172.17.0.2", 5353)
+	flow.Protocol = syscall.IPPROTO_TCP
+	if targets[0].match(flow) {
+		t.Error("TCP entry sent to a removed backend: got true, want false")
+	}
+}
+
+func TestCleanerFlushDelay(t *testing.T) {
+	cleaner := NewCleaner(netns.None())
+	cleaner.Add(BackendTarget("172.17.0.2", 5353, nil), BackendTarget("not an IP", 5353, nil))
+	if len(cleaner.pending) != 1 {
+		t.Fatalf("got %d pending targets, want 1 (targets without a valid IP are ignored)", len(cleaner.pending))
+	}
+
+	// Targets queued less than delay ago wait for the next batch
+	deleted, err := cleaner.Flush(time.Hour)
+	if err != nil || deleted != 0 {
+		t.Fatalf("got %d deleted entries and error %v, want 0 and nil", deleted, err)
+	}
+	if len(cleaner.pending) != 1 {
+		t.Fatalf("got %d pending targets, want 1", len(cleaner.pending))
+	}
+}
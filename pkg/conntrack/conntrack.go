@@ -0,0 +1,169 @@
+package conntrack
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// TCP state of established connections (enum tcp_conntrack in linux/netfilter/nf_conntrack_tcp.h)
+const tcpStateEstablished = 3
+
+// Tuple is a direction of a flow.
+type Tuple struct {
+	SrcIP   net.IP
+	DstIP   net.IP
+	SrcPort uint16
+	DstPort uint16
+}
+
+// Flow is a connection tracked by the kernel. Flows of netlink don't have the state of TCP connections, so the
+// conntrack table is read here.
+type Flow struct {
+	Protocol uint8
+	Forward  Tuple
+	Reverse  Tuple
+	TCPState uint8 // 0 for flows that aren't TCP
+}
+
+// Flows returns every IPv4 and IPv6 connection tracked by the kernel.
+func Flows() ([]Flow, error) {
+	flows := make([]Flow, 0)
+	for _, family := range []netlink.InetFamily{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		msgs, err := newRequest(nl.IPCTNL_MSG_CT_GET, syscall.NLM_F_DUMP, family, nil).Execute(syscall.NETLINK_NETFILTER, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			if len(msg) > nl.SizeofNfgenmsg {
+				flows = append(flows, parseFlow(msg[nl.SizeofNfgenmsg:]))
+			}
+		}
+	}
+	return flows, nil
+}
+
+// newRequest returns a request for the conntrack table of a family. Requests without sockets open a socket in the
+// network namespace of kube-nftlb.
+func newRequest(operation int, flags int, family netlink.InetFamily, sockets map[int]*nl.SocketHandle) *nl.NetlinkRequest {
+	req := nl.NewNetlinkRequest((int(netlink.ConntrackTable)<<8)|operation, flags)
+	req.Sockets = sockets
+	req.AddData(&nl.Nfgenmsg{NfgenFamily: uint8(family), Version: nl.NFNETLINK_V0})
+	return req
+}
+
+// CountBackend returns how many established TCP connections have been sent from a VIP to a backend: nftlb translates
+// the destination of every connection to the backend, so it's the source of the reply direction. Port 0 matches every
+// port.
+func CountBackend(flows []Flow, vips []VIP, ip string, port uint16) int {
+	backendIP := net.ParseIP(ip)
+	if backendIP == nil {
+		return 0
+	}
+
+	count := 0
+	for _, flow := range flows {
+		if flow.Protocol != syscall.IPPROTO_TCP || flow.TCPState != tcpStateEstablished {
+			continue
+		}
+		if !flow.Reverse.SrcIP.Equal(backendIP) || port != 0 && flow.Reverse.SrcPort != port {
+			continue
+		}
+		if matchVIPs(vips, flow.Forward.DstIP, flow.Forward.DstPort, flow.Protocol) {
+			count++
+		}
+	}
+	return count
+}
+
+// parseFlow reads the attributes of a conntrack message (without its netfilter header).
+func parseFlow(data []byte) Flow {
+	flow := Flow{}
+	for _, attr := range attributes(data) {
+		switch attr.Type & nl.NLA_TYPE_MASK {
+		case nl.CTA_TUPLE_ORIG:
+			flow.Protocol = parseTuple(attr.Value, &flow.Forward)
+		case nl.CTA_TUPLE_REPLY:
+			parseTuple(attr.Value, &flow.Reverse)
+		case nl.CTA_PROTOINFO:
+			flow.TCPState = parseTCPState(attr.Value)
+		}
+	}
+	return flow
+}
+
+// parseTuple reads the addresses and ports of a tuple, and returns its protocol.
+func parseTuple(data []byte, tuple *Tuple) uint8 {
+	protocol := uint8(0)
+	for _, attr := range attributes(data) {
+		switch attr.Type & nl.NLA_TYPE_MASK {
+		case nl.CTA_TUPLE_IP:
+			for _, ipAttr := range attributes(attr.Value) {
+				switch ipAttr.Type & nl.NLA_TYPE_MASK {
+				case nl.CTA_IP_V4_SRC, nl.CTA_IP_V6_SRC:
+					tuple.SrcIP = net.IP(append([]byte(nil), ipAttr.Value...))
+				case nl.CTA_IP_V4_DST, nl.CTA_IP_V6_DST:
+					tuple.DstIP = net.IP(append([]byte(nil), ipAttr.Value...))
+				}
+			}
+		case nl.CTA_TUPLE_PROTO:
+			for _, protoAttr := range attributes(attr.Value) {
+				switch protoAttr.Type & nl.NLA_TYPE_MASK {
+				case nl.CTA_PROTO_NUM:
+					if len(protoAttr.Value) >= 1 {
+						protocol = protoAttr.Value[0]
+					}
+				case nl.CTA_PROTO_SRC_PORT:
+					if len(protoAttr.Value) >= 2 {
+						tuple.SrcPort = binary.BigEndian.Uint16(protoAttr.Value)
+					}
+				case nl.CTA_PROTO_DST_PORT:
+					if len(protoAttr.Value) >= 2 {
+						tuple.DstPort = binary.BigEndian.Uint16(protoAttr.Value)
+					}
+				}
+			}
+		}
+	}
+	return protocol
+}
+
+// parseTCPState reads the TCP state of the protocol info, it's 0 if it isn't a TCP flow.
+func parseTCPState(data []byte) uint8 {
+	for _, attr := range attributes(data) {
+		if attr.Type&nl.NLA_TYPE_MASK != nl.CTA_PROTOINFO_TCP {
+			continue
+		}
+		for _, tcpAttr := range attributes(attr.Value) {
+			if tcpAttr.Type&nl.NLA_TYPE_MASK == nl.CTA_PROTOINFO_TCP_STATE && len(tcpAttr.Value) >= 1 {
+				return tcpAttr.Value[0]
+			}
+		}
+	}
+	return 0
+}
+
+// attributes splits netlink attributes, ignoring the truncated ones.
+func attributes(data []byte) []nl.Attribute {
+	attrs := make([]nl.Attribute, 0)
+	for len(data) >= nl.SizeofNfattr {
+		length := int(nl.NativeEndian().Uint16(data[0:2]))
+		if length < nl.SizeofNfattr || length > len(data) {
+			break
+		}
+		attrs = append(attrs, nl.Attribute{
+			Type:  nl.NativeEndian().Uint16(data[2:4]),
+			Value: data[nl.SizeofNfattr:length],
+		})
+
+		aligned := (length + int(nl.NLA_ALIGNTO) - 1) &^ (int(nl.NLA_ALIGNTO) - 1)
+		if aligned > len(data) {
+			break
+		}
+		data = data[aligned:]
+	}
+	return attrs
+}
@@ -0,0 +1,118 @@
+package conntrack
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+// tupleAttr returns a tuple attribute as the kernel sends it.
+func tupleAttr(attrType int, protocol uint8, src string, dst string, srcPort uint16, dstPort uint16) *nl.RtAttr {
+	port := func(value uint16) []byte {
+		data := make([]byte, 2)
+		binary.BigEndian.PutUint16(data, value)
+		return data
+	}
+
+	tuple := nl.NewRtAttr(attrType|int(nl.NLA_F_NESTED), nil)
+	ip := tuple.AddRtAttr(nl.CTA_TUPLE_IP|int(nl.NLA_F_NESTED), nil)
+	ip.AddRtAttr(nl.CTA_IP_V4_SRC, net.ParseIP(src).To4())
+	ip.AddRtAttr(nl.CTA_IP_V4_DST, net.ParseIP(dst).To4())
+	proto := tuple.AddRtAttr(nl.CTA_TUPLE_PROTO|int(nl.NLA_F_NESTED), nil)
+	proto.AddRtAttr(nl.CTA_PROTO_NUM, []byte{protocol})
+	proto.AddRtAttr(nl.CTA_PROTO_SRC_PORT, port(srcPort))
+	proto.AddRtAttr(nl.CTA_PROTO_DST_PORT, port(dstPort))
+	return tuple
+}
+
+func TestParseFlow(t *testing.T) {
+	protoInfo := nl.NewRtAttr(nl.CTA_PROTOINFO|int(nl.NLA_F_NESTED), nil)
+	tcp := protoInfo.AddRtAttr(nl.CTA_PROTOINFO_TCP|int(nl.NLA_F_NESTED), nil)
+	tcp.AddRtAttr(nl.CTA_PROTOINFO_TCP_STATE, []byte{tcpStateEstablished})
+
+	data := make([]byte, 0)
+	data = append(data, tupleAttr(nl.CTA_TUPLE_ORIG, syscall.IPPROTO_TCP, "10.0.0.1", "10.96.0.10", 40000, 80).Serialize()...)
+	data = append(data, tupleAttr(nl.CTA_TUPLE_REPLY, syscall.IPPROTO_TCP, "172.17.0.2", "10.0.0.1", 8080, 40000).Serialize()...)
+	data = append(data, protoInfo.Serialize()...)
+
+	flow := parseFlow(data)
+	if flow.Protocol != syscall.IPPROTO_TCP || flow.TCPState != tcpStateEstablished {
+		t.Fatalf("got protocol %d and TCP state %d, want %d and %d", flow.Protocol, flow.TCPState, syscall.IPPROTO_TCP, tcpStateEstablished)
+	}
+	if !flow.Forward.DstIP.Equal(net.ParseIP("10.96.0.10")) || flow.Forward.DstPort != 80 {
+		t.Fatalf("got forward destination %s:%d, want 10.96.0.10:80", flow.Forward.DstIP, flow.Forward.DstPort)
+	}
+	if !flow.Reverse.SrcIP.Equal(net.ParseIP("172.17.0.2")) || flow.Reverse.SrcPort != 8080 {
+		t.Fatalf("got reverse source %s:%d, want 172.17.0.2:8080", flow.Reverse.SrcIP, flow.Reverse.SrcPort)
+	}
+
+	// Truncated messages don't panic
+	parseFlow(data[:len(data)-3])
+}
+
+func TestCountBackend(t *testing.T) {
+	flow := func(protocol uint8, state uint8, vip string, vipPort uint16, backend string, backendPort uint16) Flow {
+		return Flow{
+			Protocol: protocol,
+			Forward:  Tuple{SrcIP: net.ParseIP("10.0.0.1"), DstIP: net.ParseIP(vip), SrcPort: 40000, DstPort: vipPort},
+			Reverse:  Tuple{SrcIP: net.ParseIP(backend), DstIP: net.ParseIP("10.0.0.1"), SrcPort: backendPort, DstPort: 40000},
+			TCPState: state,
+		}
+	}
+
+	flows := []Flow{
+		flow(syscall.IPPROTO_TCP, tcpStateEstablished, "10.96.0.10", 80, "172.17.0.2", 8080),
+		flow(syscall.IPPROTO_TCP, tcpStateEstablished, "192.168.0.10", 80, "172.17.0.2", 8080),
+		// Closing connections aren't counted
+		flow(syscall.IPPROTO_TCP, tcpStateEstablished+4, "10.96.0.10", 80, "172.17.0.2", 8080),
+		// UDP flows aren't counted
+		flow(syscall.IPPROTO_UDP, 0, "10.96.0.10", 80, "172.17.0.2", 8080),
+		// Connections that weren't sent to a VIP of the farm aren't counted
+		flow(syscall.IPPROTO_TCP, tcpStateEstablished, "172.17.0.2", 8080, "172.17.0.2", 8080),
+		flow(syscall.IPPROTO_TCP, tcpStateEstablished, "10.96.0.10", 443, "172.17.0.2", 8080),
+		// Other backends aren't counted
+		flow(syscall.IPPROTO_TCP, tcpStateEstablished, "10.96.0.10", 80, "172.17.0.3", 8080),
+	}
+
+	vips := []VIP{
+		NewVIP("10.96.0.10", "80", syscall.IPPROTO_TCP),
+		NewVIP("192.168.0.10", "80", syscall.IPPROTO_TCP),
+	}
+	if count := CountBackend(flows, vips, "172.17.0.2", 8080); count != 2 {
+		t.Fatalf("got %d connections, want 2", count)
+	}
+	if count := CountBackend(flows, vips, "172.17.0.2", 0); count != 2 {
+		t.Fatalf("every port: got %d connections, want 2", count)
+	}
+	if count := CountBackend(flows, nil, "172.17.0.2", 8080); count != 0 {
+		t.Fatalf("without VIPs: got %d connections, want 0", count)
+	}
+}
+
+func TestVIPMatch(t *testing.T) {
+	tests := []struct {
+		vip      VIP
+		ip       string
+		port     uint16
+		protocol uint8
+		want     bool
+	}{
+		{NewVIP("10.96.0.10", "80", syscall.IPPROTO_TCP), "10.96.0.10", 80, syscall.IPPROTO_TCP, true},
+		{NewVIP("10.96.0.10", "80", syscall.IPPROTO_TCP), "10.96.0.10", 80, syscall.IPPROTO_UDP, false},
+		{NewVIP("10.96.0.10", "80", syscall.IPPROTO_TCP), "10.96.0.11", 80, syscall.IPPROTO_TCP, false},
+		{NewVIP("10.96.0.10", "80,443,8000-8002", 0), "10.96.0.10", 8001, syscall.IPPROTO_UDP, true},
+		{NewVIP("10.96.0.10", "80,443,8000-8002", 0), "10.96.0.10", 8003, syscall.IPPROTO_TCP, false},
+		// NodePort addresses don't have an IP
+		{NewVIP("", "30080", syscall.IPPROTO_TCP), "192.168.0.1", 30080, syscall.IPPROTO_TCP, true},
+		{NewVIP("", "30080", syscall.IPPROTO_TCP), "192.168.0.1", 30081, syscall.IPPROTO_TCP, false},
+	}
+
+	for _, test := range tests {
+		if got := test.vip.Match(net.ParseIP(test.ip), test.port, test.protocol); got != test.want {
+			t.Errorf("%+v: %s:%d/%d: got %v, want %v", test.vip, test.ip, test.port, test.protocol, got, test.want)
+		}
+	}
+}
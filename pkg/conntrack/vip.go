@@ -0,0 +1,70 @@
+package conntrack
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// VIP is an address of a farm, where connections are sent before nftlb translates their destination to a backend.
+type VIP struct {
+	IP       net.IP // nil matches every address (NodePort farms)
+	Protocol uint8  // 0 matches every protocol
+	ports    []portRange
+}
+
+// portRange is a range of ports, both included.
+type portRange struct {
+	first uint16
+	last  uint16
+}
+
+// NewVIP returns a VIP for an address and the ports of a nftlb address (example: "80,443,8000-8002"). Empty ports
+// match every port.
+func NewVIP(ip string, ports string, protocol uint8) VIP {
+	vip := VIP{IP: net.ParseIP(ip), Protocol: protocol}
+	for _, item := range strings.Split(ports, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(item), "-", 2)
+		first, err := strconv.ParseUint(bounds[0], 10, 16)
+		if err != nil {
+			continue
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.ParseUint(bounds[1], 10, 16); err != nil {
+				continue
+			}
+		}
+		vip.ports = append(vip.ports, portRange{first: uint16(first), last: uint16(last)})
+	}
+	return vip
+}
+
+// Match returns true if a destination belongs to the VIP.
+func (v VIP) Match(ip net.IP, port uint16, protocol uint8) bool {
+	if v.Protocol != 0 && v.Protocol != protocol {
+		return false
+	}
+	if v.IP != nil && !v.IP.Equal(ip) {
+		return false
+	}
+	if len(v.ports) == 0 {
+		return true
+	}
+	for _, ports := range v.ports {
+		if port >= ports.first && port <= ports.last {
+			return true
+		}
+	}
+	return false
+}
+
+// matchVIPs returns true if a destination belongs to any VIP.
+func matchVIPs(vips []VIP, ip net.IP, port uint16, protocol uint8) bool {
+	for _, vip := range vips {
+		if vip.Match(ip, port, protocol) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/parser"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+)
+
+const (
+	// Stale conntrack entries are deleted in batches every conntrackCleanupStep
+	conntrackCleanupStep = time.Second
+
+	// Targets wait at least conntrackCleanupDelay, so nftlb has been updated before their entries are deleted
+	conntrackCleanupDelay = time.Second
+)
+
+// RunConntrackCleanup deletes stale conntrack entries of removed backends and VIPs until stopCh is closed.
+func RunConntrackCleanup(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(conntrackCleanupStep)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		deleted, err := parser.ConntrackCleaner.Flush(conntrackCleanupDelay)
+		if err != nil {
+			log.WriteLog(types.ErrorLog, fmt.Sprintf("RunConntrackCleanup: node name: %s\n%s", config.NodeName, err.Error()))
+		}
+		if deleted > 0 {
+			log.WriteLog(types.DetailedLog, fmt.Sprintf("RunConntrackCleanup: node name: %s\n%d stale conntrack entries deleted", config.NodeName, deleted))
+		}
+	}
+}
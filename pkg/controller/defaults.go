@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/parser"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/watcher"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NewDefaultsController returns a k8s controller with a ConfigMap resource watcher for the ConfigMap with cluster
+// defaults (CLIENT_DEFAULTS_CONFIGMAP). It returns nil if there's no ConfigMap to watch.
+func NewDefaultsController(clientset *kubernetes.Clientset) cache.Controller {
+	if config.DefaultsConfigMap == "" {
+		return nil
+	}
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(config.DefaultsConfigMap)
+	if err != nil {
+		panic(err)
+	}
+	listWatch := watcher.NewConfigMapListWatch(clientset, namespace, name)
+
+	eventHandler := lockedHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			updateClusterDefaults(obj.(*corev1.ConfigMap))
+		},
+		DeleteFunc: func(obj interface{}) {
+			updateClusterDefaults(nil)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			updateClusterDefaults(newObj.(*corev1.ConfigMap))
+		},
+	})
+
+	_, controller := cache.NewInformer(
+		listWatch,
+		&corev1.ConfigMap{},
+		0,
+		eventHandler,
+	)
+
+	return controller
+}
+
+// NewNamespaceController returns a k8s controller with a Namespace resource watcher, which reads default settings
+// for Services in every Namespace.
+func NewNamespaceController(clientset *kubernetes.Clientset) cache.Controller {
+	listWatch := watcher.NewNamespaceListWatch(clientset)
+
+	eventHandler := lockedHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			updateNamespaceDefaults(obj.(*corev1.Namespace))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if namespace, ok := obj.(*corev1.Namespace); ok {
+				parser.DeleteNamespaceDefaults(namespace)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			updateNamespaceDefaults(newObj.(*corev1.Namespace))
+		},
+	})
+
+	_, controller := cache.NewInformer(
+		listWatch,
+		&corev1.Namespace{},
+		0,
+		eventHandler,
+	)
+
+	return controller
+}
+
+// NewFarmTemplateController returns a k8s controller with a ConfigMap resource watcher for ConfigMaps with farm
+// templates.
+func NewFarmTemplateController(clientset *kubernetes.Clientset) cache.Controller {
+	listWatch := watcher.NewFarmTemplateListWatch(clientset)
+
+	eventHandler := lockedHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			configMap := obj.(*corev1.ConfigMap)
+			updateFarmTemplate(configMap, parser.SetFarmTemplate(configMap))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if configMap, ok := obj.(*corev1.ConfigMap); ok {
+				updateFarmTemplate(configMap, parser.DeleteFarmTemplate(configMap))
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			configMap := newObj.(*corev1.ConfigMap)
+			updateFarmTemplate(configMap, parser.SetFarmTemplate(configMap))
+		},
+	})
+
+	_, controller := cache.NewInformer(
+		listWatch,
+		&corev1.ConfigMap{},
+		0,
+		eventHandler,
+	)
+
+	return controller
+}
+
+// updateClusterDefaults reads cluster defaults and applies again every Service if they have changed.
+func updateClusterDefaults(configMap *corev1.ConfigMap) {
+	if !parser.SetClusterDefaults(configMap) {
+		return
+	}
+
+	log.WriteLog(types.StandardLog, fmt.Sprintf("updateClusterDefaults: ConfigMap name: %s\nDefaults have changed", config.DefaultsConfigMap))
+	reconcileServices(func(*corev1.Service) bool {
+		return true
+	})
+}
+
+// updateNamespaceDefaults reads namespace defaults and applies again every Service in that Namespace if they have changed.
+func updateNamespaceDefaults(namespace *corev1.Namespace) {
+	if !parser.SetNamespaceDefaults(namespace) {
+		return
+	}
+
+	log.WriteLog(types.StandardLog, fmt.Sprintf("updateNamespaceDefaults: Namespace name: %s\nDefaults have changed", namespace.Name))
+	reconcileServices(func(svc *corev1.Service) bool {
+		return svc.Namespace == namespace.Name
+	})
+}
+
+// updateFarmTemplate applies again every Service that uses the farm template of a ConfigMap if it has changed.
+func updateFarmTemplate(configMap *corev1.ConfigMap, changed bool) {
+	if !changed {
+		return
+	}
+
+	users := make(map[string]bool)
+	for _, key := range parser.FarmTemplateUsers(configMap) {
+		users[key] = true
+	}
+
+	log.WriteLog(types.StandardLog, fmt.Sprintf("updateFarmTemplate: ConfigMap name: %s\nFarm template has changed", configMap.Name))
+	reconcileServices(func(svc *corev1.Service) bool {
+		return users[svc.Namespace+"/"+svc.Name]
+	})
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/conntrack"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/parser"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+)
+
+// Connections of draining backends are counted every drainStep
+const drainStep = time.Second
+
+// RunDrains counts the connections of every draining backend until stopCh is closed. Backends without connections or
+// whose drain timeout has expired are deleted, applying their Endpoints again.
+func RunDrains(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(drainStep)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		runDrains()
+	}
+}
+
+// runDrains counts the connections of every draining backend once, holding the lock of the controllers.
+func runDrains() {
+	parserMutex.Lock()
+	defer parserMutex.Unlock()
+
+	drains := parser.Drains()
+	if len(drains) == 0 {
+		return
+	}
+
+	// Without conntrack, backends drain until their drain timeout expires
+	flows, err := conntrack.Flows()
+	if err != nil {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("RunDrains: node name: %s\n%s", config.NodeName, err.Error()))
+	}
+
+	finished := make([]string, 0)
+	for _, drain := range drains {
+		result := ""
+		if err == nil {
+			connections := conntrack.CountBackend(flows, drain.VIPs, drain.IP, drain.Port)
+			parser.SetDrainConnections(drain.Farm, drain.Backend, connections)
+			if connections == 0 {
+				result = parser.DrainDrained
+			}
+		}
+		if result == "" && drain.Expired {
+			result = parser.DrainTimeout
+		}
+
+		if result != "" && parser.FinishDrain(drain.Farm, drain.Backend, result) {
+			log.WriteLog(types.StandardLog, fmt.Sprintf("RunDrains: farm name: %s\nBackend %s has finished draining (%s)", drain.Farm, drain.Backend, result))
+			finished = append(finished, drain.Endpoints)
+		}
+	}
+
+	updateEndpointsByKey(finished, "")
+}
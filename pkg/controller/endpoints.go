@@ -16,48 +16,65 @@ import (
 	corev1 "k8s.io/api/core/v1"
 )
 
+// Every Endpoints known by the Endpoints controller
+var endpointsStore cache.Store
+
 // NewEndpointsController
 func NewEndpointsController(clientset *kubernetes.Clientset) cache.Controller {
 	listWatch := watcher.NewEndpointListWatch(clientset)
 
-	eventHandler := cache.ResourceEventHandlerFuncs{
-		AddFunc:    AddNftlbBackends,
-		DeleteFunc: DeleteNftlbBackends,
-		UpdateFunc: UpdateNftlbBackends,
-	}
+	eventHandler := lockedHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			AddNftlbBackends(obj)
+			updateDependentEndpoints(obj.(*corev1.Endpoints))
+		},
+		DeleteFunc: func(obj interface{}) {
+			DeleteNftlbBackends(obj)
+			updateDependentEndpoints(obj.(*corev1.Endpoints))
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			UpdateNftlbBackends(oldObj, newObj)
+			updateDependentEndpoints(newObj.(*corev1.Endpoints))
+		},
+	})
 
-	_, controller := cache.NewInformer(
+	var controller cache.Controller
+	endpointsStore, controller = cache.NewInformer(
 		listWatch,
 		&corev1.Endpoints{},
 		0,
 		eventHandler,
 	)
+	parser.SetEndpointsStore(endpointsStore)
 
 	return controller
 }
 
 // AddNftlbBackends
 func AddNftlbBackends(obj interface{}) {
-	ep := obj.(*corev1.Endpoints)
+	addNftlbBackends(obj.(*corev1.Endpoints))
+}
 
+// addNftlbBackends sends every backend of an Endpoints object to nftlb, and returns them.
+func addNftlbBackends(ep *corev1.Endpoints) *types.Nftlb {
 	// Parse this Endpoints struct as a Nftlb struct
 	data := parser.EndpointsAsNftlb(ep)
 
 	if len(data.Farms) == 0 {
 		// Reject object without farms
 		log.WriteLog(types.DetailedLog, fmt.Sprintf("AddNftlbFarms: Endpoints name: %s\nEmpty Farms slice", ep.Name))
-		return
-	} else if len(data.Farms[0].Backends) == 0 {
-		// Reject farm without backends
-		log.WriteLog(types.DetailedLog, fmt.Sprintf("AddNftlbFarms: Endpoints name: %s\nFarms[0] has no backends", ep.Name))
-		return
+		return data
+	} else if !hasBackends(data) {
+		// Reject farms without backends
+		log.WriteLog(types.DetailedLog, fmt.Sprintf("AddNftlbFarms: Endpoints name: %s\nFarms have no backends", ep.Name))
+		return data
 	}
 
 	// Parse Nftlb struct as a JSON string
 	nftlbJSON, err := parser.NftlbAsJSON(data)
 	if err != nil {
 		log.WriteLog(types.ErrorLog, fmt.Sprintf("AddNftlbBackends: Endpoints name: %s\n%s", ep.Name, err.Error()))
-		return
+		return data
 	}
 	log.WriteLog(types.StandardLog, fmt.Sprintf("AddNftlbBackends: Endpoints name: %s\n%s", ep.Name, nftlbJSON))
 
@@ -73,19 +90,37 @@ func AddNftlbBackends(obj interface{}) {
 
 	if err != nil {
 		log.WriteLog(types.ErrorLog, fmt.Sprintf("AddNftlbBackends: Endpoints name: %s\n%s", ep.Name, err.Error()))
-		return
+		return data
 	}
 
 	log.WriteLog(types.StandardLog, string(response))
+
+	// Gated Pods of this Endpoints object are reported as programmed by this node
+	parser.SetEndpointsProgrammed(ep)
+	return data
+}
+
+// hasBackends returns true if any farm has backends.
+func hasBackends(data *types.Nftlb) bool {
+	for _, farm := range data.Farms {
+		if len(farm.Backends) > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // DeleteNftlbBackends
 func DeleteNftlbBackends(obj interface{}) {
 	metrics.EndpointsChangesTotal.Inc()
 	ep := obj.(*corev1.Endpoints)
+
+	// Make channel where paths will come through
 	pathsChan := make(chan string)
+	done := make(chan struct{})
 
 	go func() {
+		defer close(done)
 		for path := range pathsChan {
 			// Get the response from that request
 			if response, err := http.Send(&types.RequestData{
@@ -99,11 +134,72 @@ func DeleteNftlbBackends(obj interface{}) {
 		}
 	}()
 
+	// Read paths and send them through the channel, and wait until every backend is deleted, so the next handler
+	// doesn't race these deletes
 	parser.EndpointsAsPaths(ep, pathsChan)
+	<-done
 }
 
-// UpdateNftlbBackends
+// UpdateNftlbBackends adds or updates backends of the updated Endpoints, and then deletes only backends that don't
+// exist anymore, so backends that are kept don't lose their connections or their slow start.
 func UpdateNftlbBackends(oldObj, newObj interface{}) {
-	DeleteNftlbBackends(oldObj)
-	AddNftlbBackends(newObj)
+	ep := newObj.(*corev1.Endpoints)
+
+	oldBackends := parser.BackendsPerEndpoints(ep)
+	data := addNftlbBackends(ep)
+
+	pathsChan := make(chan string)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for path := range pathsChan {
+			// Get the response from that request
+			if response, err := http.Send(&types.RequestData{
+				Method: "DELETE",
+				Path:   path,
+			}); err != nil {
+				log.WriteLog(types.ErrorLog, fmt.Sprintf("UpdateNftlbBackends: Endpoints name: %s, path: %s\n%s", ep.Name, path, err.Error()))
+			} else {
+				log.WriteLog(types.StandardLog, fmt.Sprintf("UpdateNftlbBackends: Endpoints name: %s, path: %s\n%s", ep.Name, path, string(response)))
+			}
+		}
+	}()
+
+	parser.StaleBackendsAsPaths(oldBackends, data, pathsChan)
+	<-done
+}
+
+// updateDependentEndpoints updates backends of every Service whose backends are made from the endpoints of this
+// Endpoints object: Services without endpoints that use it as fallback, and roots of a TrafficSplit.
+func updateDependentEndpoints(ep *corev1.Endpoints) {
+	key := ep.Namespace + "/" + ep.Name
+	updateEndpointsByKey(append(parser.FallbackUsers(key), parser.TrafficSplitUsers(key)...), key)
+}
+
+// updateEndpointsByKey updates backends of every Endpoints (namespace/name) known by the Endpoints controller, except
+// the one being processed.
+func updateEndpointsByKey(keys []string, skipKey string) {
+	// Nothing to update until the Endpoints controller is made
+	if endpointsStore == nil {
+		return
+	}
+
+	updated := make(map[string]bool)
+	for _, key := range keys {
+		if key == skipKey || updated[key] {
+			continue
+		}
+		updated[key] = true
+
+		obj, exists, err := endpointsStore.GetByKey(key)
+		if err != nil {
+			log.WriteLog(types.ErrorLog, fmt.Sprintf("updateEndpointsByKey: Endpoints name: %s\n%s", key, err.Error()))
+			continue
+		} else if !exists {
+			continue
+		}
+
+		UpdateNftlbBackends(obj, obj)
+	}
 }
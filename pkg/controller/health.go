@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/zevenet/kube-nftlb/pkg/health"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/parser"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+)
+
+// RunHealthChecks sets backends down or up again when their health changes, until stopCh is closed.
+func RunHealthChecks(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case change := <-parser.HealthChecker.Changes():
+			runHealthChange(change)
+		}
+	}
+}
+
+// runHealthChange sends the backend whose health has changed, holding the lock of the controllers.
+func runHealthChange(change health.Change) {
+	parserMutex.Lock()
+	defer parserMutex.Unlock()
+
+	state := "unhealthy"
+	if change.Healthy {
+		state = "healthy"
+	}
+	log.WriteLog(types.StandardLog, fmt.Sprintf("RunHealthChecks: farm name: %s\nBackend %s is %s", change.Group, change.Target, state))
+	sendNftlbBackends(parser.HealthAsNftlb(change), "RunHealthChecks")
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"sync"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// It's held by every event handler and background loop that applies Services or Endpoints, so the maps of the parser
+// (farms, backends and addresses) are never read and written by several controllers at once
+var parserMutex sync.Mutex
+
+// lockedHandler returns event handlers that hold parserMutex while they run.
+func lockedHandler(handler cache.ResourceEventHandlerFuncs) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			parserMutex.Lock()
+			defer parserMutex.Unlock()
+
+			if handler.AddFunc != nil {
+				handler.AddFunc(obj)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			parserMutex.Lock()
+			defer parserMutex.Unlock()
+
+			if handler.DeleteFunc != nil {
+				handler.DeleteFunc(obj)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			parserMutex.Lock()
+			defer parserMutex.Unlock()
+
+			if handler.UpdateFunc != nil {
+				handler.UpdateFunc(oldObj, newObj)
+			}
+		},
+	}
+}
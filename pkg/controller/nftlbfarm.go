@@ -0,0 +1,300 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/auth"
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/events"
+	"github.com/zevenet/kube-nftlb/pkg/http"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/parser"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/watcher"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+var (
+	// Every NftlbFarm known by the NftlbFarm controller
+	nftlbFarmStore cache.Store
+
+	// It locks appliedPerNftlbFarm, so NftlbFarms are reconciled by a single controller at once
+	nftlbFarmsMutex sync.Mutex
+
+	// Map [NftlbFarm (namespace/name)] to { Nftlb struct sent to nftlb }
+	appliedPerNftlbFarm = make(map[string]*types.Nftlb)
+)
+
+// NewNftlbFarmController returns a k8s controller with a NftlbFarm resource watcher. It returns nil if NftlbFarms
+// aren't programmed (CLIENT_NFTLB_FARMS) or their CRD isn't applied, its cache would never be synced.
+func NewNftlbFarmController(dynamicClient dynamic.Interface) cache.Controller {
+	if !config.NftlbFarms {
+		return nil
+	}
+	if err := watcher.CustomResourceServed(auth.GetClientset().Discovery(), types.NftlbFarmResource); err != nil {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("NewNftlbFarmController: NftlbFarms won't be programmed\n%s", err.Error()))
+		return nil
+	}
+
+	listWatch := watcher.NewNftlbFarmListWatch(dynamicClient)
+
+	eventHandler := lockedHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			reconcileNftlbFarm(obj.(*unstructured.Unstructured))
+		},
+		DeleteFunc: func(obj interface{}) {
+			nftlbFarm, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			nftlbFarmsMutex.Lock()
+			defer nftlbFarmsMutex.Unlock()
+
+			releaseNftlbFarmLocked(nftlbFarm)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			reconcileNftlbFarm(newObj.(*unstructured.Unstructured))
+		},
+	})
+
+	var controller cache.Controller
+	nftlbFarmStore, controller = cache.NewInformer(
+		listWatch,
+		&unstructured.Unstructured{},
+		0,
+		eventHandler,
+	)
+
+	return controller
+}
+
+// reconcileNftlbFarm programs a NftlbFarm if it's valid and this node matches its node selector, or deletes its farm
+// otherwise. The result is reported in the status of the NftlbFarm for this node.
+func reconcileNftlbFarm(nftlbFarm *unstructured.Unstructured) {
+	nftlbFarmsMutex.Lock()
+	defer nftlbFarmsMutex.Unlock()
+
+	key := nftlbFarmKey(nftlbFarm)
+	farmName := parser.FormatNftlbFarmName(nftlbFarm.GetNamespace(), nftlbFarm.GetName())
+
+	spec, podSelector, nodeSelector, errs := parser.NftlbFarmSpec(nftlbFarm)
+	if len(errs) > 0 {
+		releaseNftlbFarmLocked(nftlbFarm)
+		updateNftlbFarmStatus(nftlbFarm, &types.NftlbFarmNodeStatus{State: types.NftlbFarmInvalid, Message: errs.ToAggregate().Error()})
+		return
+	}
+
+	// Other nodes program this farm
+	if !parser.LocalNodeMatches(nodeSelector) {
+		releaseNftlbFarmLocked(nftlbFarm)
+		updateNftlbFarmStatus(nftlbFarm, nil)
+		return
+	}
+
+	if err := parser.ClaimNftlbFarm(key, farmName); err != nil {
+		updateNftlbFarmStatus(nftlbFarm, &types.NftlbFarmNodeStatus{State: types.NftlbFarmConflict, Farm: farmName, Message: err.Error()})
+		return
+	}
+
+	data, errs := parser.NftlbFarmAsNftlb(nftlbFarm, spec, selectedPods(nftlbFarm.GetNamespace(), podSelector))
+	if len(errs) > 0 {
+		releaseNftlbFarmLocked(nftlbFarm)
+		updateNftlbFarmStatus(nftlbFarm, &types.NftlbFarmNodeStatus{State: types.NftlbFarmInvalid, Farm: farmName, Message: errs.ToAggregate().Error()})
+		return
+	}
+
+	if err := applyNftlbFarmLocked(key, data); err != nil {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("reconcileNftlbFarm: NftlbFarm name: %s\n%s", nftlbFarm.GetName(), err.Error()))
+		updateNftlbFarmStatus(nftlbFarm, &types.NftlbFarmNodeStatus{State: types.NftlbFarmError, Farm: farmName, Message: err.Error()})
+		return
+	}
+	updateNftlbFarmStatus(nftlbFarm, &types.NftlbFarmNodeStatus{State: types.NftlbFarmProgrammed, Farm: farmName})
+}
+
+// applyNftlbFarmLocked sends a farm to nftlb if it has changed since it was sent, objects that aren't in the farm
+// anymore are deleted first.
+func applyNftlbFarmLocked(key string, data *types.Nftlb) error {
+	oldData := appliedPerNftlbFarm[key]
+	if reflect.DeepEqual(oldData, data) {
+		return nil
+	}
+	if oldData != nil {
+		deleteNftlbPaths(parser.NftlbFarmAsPaths(oldData, data), "applyNftlbFarmLocked: NftlbFarm key: "+key)
+	}
+	delete(appliedPerNftlbFarm, key)
+
+	nftlbJSON, err := parser.NftlbAsJSON(data)
+	if err != nil {
+		return err
+	}
+	log.WriteLog(types.StandardLog, fmt.Sprintf("applyNftlbFarmLocked: NftlbFarm key: %s\n%s", key, nftlbJSON))
+
+	response, err := http.Send(&types.RequestData{
+		Method: "POST",
+		Path:   "farms",
+		Body:   strings.NewReader(nftlbJSON),
+	})
+	if err != nil {
+		return err
+	}
+	log.WriteLog(types.StandardLog, fmt.Sprintf("applyNftlbFarmLocked: NftlbFarm key: %s\n%s", key, string(response)))
+
+	appliedPerNftlbFarm[key] = data
+	return nil
+}
+
+// releaseNftlbFarmLocked deletes the farm of a NftlbFarm if it was sent to nftlb, and applies again every Service that
+// wasn't applied because of that farm.
+func releaseNftlbFarmLocked(nftlbFarm *unstructured.Unstructured) {
+	key := nftlbFarmKey(nftlbFarm)
+	farmName := parser.FormatNftlbFarmName(nftlbFarm.GetNamespace(), nftlbFarm.GetName())
+
+	if oldData, ok := appliedPerNftlbFarm[key]; ok {
+		deleteNftlbPaths(parser.NftlbFarmAsPaths(oldData, nil), "releaseNftlbFarmLocked: NftlbFarm key: "+key)
+		delete(appliedPerNftlbFarm, key)
+	}
+
+	refused := make(map[string]bool)
+	for _, serviceKey := range parser.ReleaseNftlbFarm(key, farmName) {
+		refused[serviceKey] = true
+	}
+	if len(refused) > 0 {
+		reconcileServices(func(svc *corev1.Service) bool {
+			return refused[svc.Namespace+"/"+svc.Name]
+		})
+	}
+}
+
+// deleteNftlbPaths sends a DELETE request to nftlb for every path. Logs start with logPrefix.
+func deleteNftlbPaths(paths []string, logPrefix string) {
+	for _, path := range paths {
+		if response, err := http.Send(&types.RequestData{
+			Method: "DELETE",
+			Path:   path,
+		}); err != nil {
+			log.WriteLog(types.ErrorLog, fmt.Sprintf("%s, path: %s\n%s", logPrefix, path, err.Error()))
+		} else {
+			log.WriteLog(types.StandardLog, fmt.Sprintf("%s, path: %s\n%s", logPrefix, path, string(response)))
+		}
+	}
+}
+
+// reconcileNftlbFarmsByPod reconciles every NftlbFarm in the namespace of a Pod that makes backends for Pods, so
+// backends follow Pods that are ready, leave or change their labels.
+func reconcileNftlbFarmsByPod(pod *corev1.Pod) {
+	reconcileNftlbFarms(func(nftlbFarm *unstructured.Unstructured) bool {
+		_, found, _ := unstructured.NestedMap(nftlbFarm.Object, "spec", "podSelector")
+		return found && nftlbFarm.GetNamespace() == pod.Namespace
+	})
+}
+
+// reconcileNftlbFarmsByKey reconciles every NftlbFarm (namespace/name) given.
+func reconcileNftlbFarmsByKey(keys []string) {
+	if nftlbFarmStore == nil {
+		return
+	}
+
+	for _, key := range keys {
+		obj, exists, err := nftlbFarmStore.GetByKey(key)
+		if err != nil || !exists {
+			continue
+		}
+		reconcileNftlbFarm(obj.(*unstructured.Unstructured))
+	}
+}
+
+// reconcileNftlbFarms reconciles every known NftlbFarm that matches a filter.
+func reconcileNftlbFarms(match func(*unstructured.Unstructured) bool) {
+	// The NftlbFarm controller isn't running
+	if nftlbFarmStore == nil {
+		return
+	}
+
+	for _, obj := range nftlbFarmStore.List() {
+		if nftlbFarm := obj.(*unstructured.Unstructured); match(nftlbFarm) {
+			reconcileNftlbFarm(nftlbFarm)
+		}
+	}
+}
+
+// selectedPods returns every known Pod in a namespace that matches a selector. There aren't Pods without selector.
+func selectedPods(namespace string, selector labels.Selector) []*corev1.Pod {
+	pods := make([]*corev1.Pod, 0)
+	if selector == nil || podStore == nil {
+		return pods
+	}
+
+	for _, obj := range podStore.List() {
+		if pod := obj.(*corev1.Pod); pod.Namespace == namespace && selector.Matches(labels.Set(pod.Labels)) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods
+}
+
+// updateNftlbFarmStatus writes the status of a NftlbFarm in this node, only if it has changed. A nil status removes
+// this node from the status.
+func updateNftlbFarmStatus(nftlbFarm *unstructured.Unstructured, status *types.NftlbFarmNodeStatus) {
+	current, found, _ := unstructured.NestedMap(nftlbFarm.Object, "status", "nodes", config.NodeName)
+	if status == nil && !found {
+		return
+	}
+	if status != nil && found {
+		state, _ := current["state"].(string)
+		farm, _ := current["farm"].(string)
+		message, _ := current["message"].(string)
+		if state == status.State && farm == status.Farm && message == status.Message {
+			return
+		}
+	}
+
+	if status != nil {
+		status.LastUpdateTime = time.Now().UTC().Format(time.RFC3339)
+
+		message := fmt.Sprintf("farm %s is %s in node %s", status.Farm, strings.ToLower(status.State), config.NodeName)
+		if status.Message != "" {
+			message = fmt.Sprintf("%s in node %s: %s", status.State, config.NodeName, status.Message)
+		}
+		if status.State == types.NftlbFarmProgrammed {
+			events.Normal(nftlbFarm, "FarmProgrammed", message)
+		} else {
+			events.Warning(nftlbFarm, "Farm"+status.State, message)
+		}
+	}
+
+	// Every node only writes its own key, so nodes don't override each other
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"nodes": map[string]interface{}{
+				config.NodeName: status,
+			},
+		},
+	})
+	if err != nil {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("updateNftlbFarmStatus: NftlbFarm name: %s\n%s", nftlbFarm.GetName(), err.Error()))
+		return
+	}
+
+	client := auth.GetDynamicClient().Resource(types.NftlbFarmResource).Namespace(nftlbFarm.GetNamespace())
+	if _, err := client.Patch(context.TODO(), nftlbFarm.GetName(), k8stypes.MergePatchType, patch, metav1.PatchOptions{}, "status"); err != nil {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("updateNftlbFarmStatus: NftlbFarm name: %s\n%s", nftlbFarm.GetName(), err.Error()))
+	}
+}
+
+// nftlbFarmKey returns the key (namespace/name) of a NftlbFarm.
+func nftlbFarmKey(nftlbFarm *unstructured.Unstructured) string {
+	return nftlbFarm.GetNamespace() + "/" + nftlbFarm.GetName()
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"github.com/zevenet/kube-nftlb/pkg/parser"
+	"github.com/zevenet/kube-nftlb/pkg/watcher"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NewNodeController returns a k8s controller with a Node resource watcher, which reads the allocatable resources
+// and the zone of every Node.
+func NewNodeController(clientset *kubernetes.Clientset) cache.Controller {
+	listWatch := watcher.NewNodeListWatch(clientset)
+
+	eventHandler := lockedHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: UpdateNftlbNodeBackends,
+		DeleteFunc: func(obj interface{}) {
+			// Backends are deleted by the Endpoints controller
+			if node, ok := obj.(*corev1.Node); ok {
+				parser.DeleteNode(node)
+				queueDeletedNodeStatus(node.Name)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			UpdateNftlbNodeBackends(newObj)
+		},
+	})
+
+	_, controller := cache.NewInformer(
+		listWatch,
+		&corev1.Node{},
+		0,
+		eventHandler,
+	)
+
+	return controller
+}
+
+// UpdateNftlbNodeBackends takes in a Node object (k8s) and updates backends (nftlb) whose automatic weights or topology
+// priorities depend on that Node if its allocatable resources or its zone have changed.
+func UpdateNftlbNodeBackends(obj interface{}) {
+	node := obj.(*corev1.Node)
+
+	// Node-scoped Services and NftlbFarms are programmed (or deleted) when labels of this node change
+	if parser.SetLocalNode(node) {
+		nodeScoped := make(map[string]bool)
+		for _, key := range parser.NodeScopedServices() {
+			nodeScoped[key] = true
+		}
+		if len(nodeScoped) > 0 {
+			reconcileServices(func(svc *corev1.Service) bool {
+				return nodeScoped[svc.Namespace+"/"+svc.Name]
+			})
+		}
+
+		reconcileNftlbFarms(func(*unstructured.Unstructured) bool {
+			return true
+		})
+	}
+
+	if !parser.SetNode(node) {
+		return
+	}
+
+	sendNftlbBackends(parser.NodeAsNftlb(node), "UpdateNftlbNodeBackends: Node name: "+node.Name)
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zevenet/kube-nftlb/pkg/http"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+	"github.com/zevenet/kube-nftlb/pkg/parser"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/watcher"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Every Pod known by the Pod controller
+var podStore cache.Store
+
+// NewPodController returns a k8s controller with a Pod resource watcher, which reads backend settings from Pod
+// annotations.
+func NewPodController(clientset *kubernetes.Clientset) cache.Controller {
+	listWatch := watcher.NewPodListWatch(clientset)
+
+	eventHandler := lockedHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			UpdateNftlbPodBackends(obj)
+			reconcileNftlbFarmsByPod(obj.(*corev1.Pod))
+		},
+		DeleteFunc: func(obj interface{}) {
+			// Backends are deleted by the Endpoints controller
+			if pod, ok := obj.(*corev1.Pod); ok {
+				parser.DeletePod(pod)
+				reconcileNftlbFarmsByPod(pod)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			UpdateNftlbPodBackends(newObj)
+			reconcileNftlbFarmsByPod(newObj.(*corev1.Pod))
+			updateGatedPodEndpoints(oldObj.(*corev1.Pod), newObj.(*corev1.Pod))
+		},
+	})
+
+	var controller cache.Controller
+	podStore, controller = cache.NewInformer(
+		listWatch,
+		&corev1.Pod{},
+		0,
+		eventHandler,
+	)
+
+	return controller
+}
+
+// UpdateNftlbPodBackends takes in a Pod object (k8s) and updates only the backends made for it (nftlb) if its
+// settings or resources have changed.
+func UpdateNftlbPodBackends(obj interface{}) {
+	pod := obj.(*corev1.Pod)
+
+	if !parser.SetPod(pod) {
+		return
+	}
+
+	// Parse backends made for this Pod as a Nftlb struct
+	sendNftlbBackends(parser.PodAsNftlb(pod), "UpdateNftlbPodBackends: Pod name: "+pod.Name)
+}
+
+// sendNftlbBackends sends backends to nftlb, there's nothing to send if there aren't backends yet. Logs start with
+// logPrefix.
+func sendNftlbBackends(data *types.Nftlb, logPrefix string) {
+	if len(data.Farms) == 0 {
+		return
+	}
+
+	// Parse Nftlb struct as a JSON string
+	nftlbJSON, err := parser.NftlbAsJSON(data)
+	if err != nil {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("%s\n%s", logPrefix, err.Error()))
+		return
+	}
+	log.WriteLog(types.StandardLog, fmt.Sprintf("%s\n%s", logPrefix, nftlbJSON))
+
+	metrics.EndpointsChangesPending.Inc()
+	metrics.EndpointsChangesTotal.Inc()
+	// Get the response from that request
+	response, err := http.Send(&types.RequestData{
+		Method: "POST",
+		Path:   "farms",
+		Body:   strings.NewReader(nftlbJSON),
+	})
+	metrics.EndpointsChangesPending.Dec()
+
+	if err != nil {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("%s\n%s", logPrefix, err.Error()))
+		return
+	}
+
+	log.WriteLog(types.StandardLog, string(response))
+}
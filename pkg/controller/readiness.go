@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/events"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/parser"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/watcher"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// The report of this node is written at most every readinessReportStep, and at least every readinessHeartbeat
+	readinessReportStep = time.Second
+	readinessHeartbeat  = 30 * time.Second
+
+	// Reports that haven't been written for readinessReportTimeout are ignored (the node is down)
+	readinessReportTimeout = 4 * readinessHeartbeat
+
+	// Readiness gates are checked by the leader every readinessGatesStep
+	readinessGatesStep = 2 * time.Second
+
+	// Every node competes for this Lease, the leader sets the readiness gates
+	readinessLeaseName = "kube-nftlb-readiness"
+)
+
+// updateGatedPodEndpoints applies again every Endpoints where a gated Pod is a not ready address when the readiness
+// of its containers changes, so its backends are added or deleted.
+func updateGatedPodEndpoints(oldPod *corev1.Pod, newPod *corev1.Pod) {
+	if parser.PodGateReady(oldPod) == parser.PodGateReady(newPod) {
+		return
+	}
+	updateEndpointsByKey(parser.NotReadyEndpoints(newPod), "")
+}
+
+// RunReadinessReport writes the gated Pods programmed by this node in its report (a ConfigMap) until stopCh is closed.
+// It does nothing if readiness gates are disabled (CLIENT_READINESS_GATES).
+func RunReadinessReport(clientset *kubernetes.Clientset, stopCh <-chan struct{}) {
+	if !config.ReadinessGates {
+		return
+	}
+
+	ticker := time.NewTicker(readinessReportStep)
+	defer ticker.Stop()
+
+	var lastReport map[string]string
+	var lastWrite time.Time
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		report, changed := parser.ProgrammedPodsReport()
+		if !changed && reflect.DeepEqual(report, lastReport) && time.Since(lastWrite) < readinessHeartbeat {
+			continue
+		}
+
+		if err := writeReadinessReport(clientset, report); err != nil {
+			log.WriteLog(types.ErrorLog, fmt.Sprintf("RunReadinessReport: node name: %s\n%s", config.NodeName, err.Error()))
+			continue
+		}
+		lastReport, lastWrite = report, time.Now()
+	}
+}
+
+// writeReadinessReport creates or updates the report of this node. It's owned by the Node, so it's deleted with it.
+func writeReadinessReport(clientset *kubernetes.Clientset, report map[string]string) error {
+	client := clientset.CoreV1().ConfigMaps(config.ReadinessNamespace)
+	name := "kube-nftlb-programmed-" + config.NodeName
+	heartbeat := time.Now().UTC().Format(time.RFC3339)
+
+	configMap, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   config.ReadinessNamespace,
+				Labels:      map[string]string{types.ProgrammedPodsLabel: "true"},
+				Annotations: map[string]string{types.ProgrammedPodsHeartbeat: heartbeat},
+			},
+			Data: report,
+		}
+		if node, err := clientset.CoreV1().Nodes().Get(context.TODO(), config.NodeName, metav1.GetOptions{}); err == nil {
+			configMap.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "Node",
+				Name:       node.Name,
+				UID:        node.UID,
+			}}
+		}
+
+		_, err = client.Create(context.TODO(), configMap, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	if configMap.Annotations == nil {
+		configMap.Annotations = make(map[string]string)
+	}
+	configMap.Annotations[types.ProgrammedPodsHeartbeat] = heartbeat
+	configMap.Data = report
+
+	_, err = client.Update(context.TODO(), configMap, metav1.UpdateOptions{})
+	return err
+}
+
+// RunReadinessGates competes with every node to be the leader until stopCh is closed. The leader sets the readiness
+// gate of every gated Pod whose backends have been programmed by every node. It does nothing if readiness gates are
+// disabled (CLIENT_READINESS_GATES).
+func RunReadinessGates(clientset *kubernetes.Clientset, stopCh <-chan struct{}) {
+	if !config.ReadinessGates {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      readinessLeaseName,
+			Namespace: config.ReadinessNamespace,
+		},
+		Client: clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: config.NodeName,
+		},
+	}
+
+	// A new election begins when the leader loses its Lease
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   15 * time.Second,
+			RenewDeadline:   10 * time.Second,
+			RetryPeriod:     2 * time.Second,
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					log.WriteLog(types.StandardLog, fmt.Sprintf("RunReadinessGates: node name: %s\nThis node sets readiness gates", config.NodeName))
+					setReadinessGates(ctx, clientset)
+				},
+				OnStoppedLeading: func() {
+					log.WriteLog(types.StandardLog, fmt.Sprintf("RunReadinessGates: node name: %s\nThis node doesn't set readiness gates anymore", config.NodeName))
+				},
+			},
+		})
+	}
+}
+
+// setReadinessGates reads the report of every node, and sets the readiness gate of every gated Pod programmed by
+// every node with a recent report, until ctx is done.
+func setReadinessGates(ctx context.Context, clientset *kubernetes.Clientset) {
+	reportStore, reportController := cache.NewInformer(
+		watcher.NewProgrammedPodsListWatch(clientset, config.ReadinessNamespace),
+		&corev1.ConfigMap{},
+		0,
+		cache.ResourceEventHandlerFuncs{},
+	)
+	go reportController.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), reportController.HasSynced) {
+		return
+	}
+
+	ticker := time.NewTicker(readinessGatesStep)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Reports of nodes that are down are ignored
+		reports := make([]map[string]string, 0)
+		for _, obj := range reportStore.List() {
+			configMap := obj.(*corev1.ConfigMap)
+			heartbeat, err := time.Parse(time.RFC3339, configMap.Annotations[types.ProgrammedPodsHeartbeat])
+			if err != nil || time.Since(heartbeat) > readinessReportTimeout {
+				continue
+			}
+			reports = append(reports, configMap.Data)
+		}
+		if len(reports) == 0 || podStore == nil {
+			continue
+		}
+
+		for _, obj := range podStore.List() {
+			pod := obj.(*corev1.Pod)
+			if !parser.PodGateReady(pod) || parser.PodProgrammed(pod) || !programmedInEveryReport(pod, reports) {
+				continue
+			}
+			setPodProgrammed(ctx, clientset, pod, len(reports))
+		}
+	}
+}
+
+// programmedInEveryReport returns true if every report has the current UID of a Pod.
+func programmedInEveryReport(pod *corev1.Pod, reports []map[string]string) bool {
+	key := parser.ReportKey(pod.Namespace + "/" + pod.Name)
+	for _, report := range reports {
+		if report[key] != string(pod.UID) {
+			return false
+		}
+	}
+	return true
+}
+
+// setPodProgrammed sets the readiness gate of a Pod to True.
+func setPodProgrammed(ctx context.Context, clientset *kubernetes.Clientset, pod *corev1.Pod, nodes int) {
+	// Conditions are merged by type, so other conditions are kept
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []corev1.PodCondition{{
+				Type:               types.ProgrammedCondition,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: metav1.Now(),
+				Reason:             "BackendsProgrammed",
+			}},
+		},
+	})
+	if err != nil {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("setPodProgrammed: Pod name: %s\n%s", pod.Name, err.Error()))
+		return
+	}
+
+	if _, err := clientset.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, k8stypes.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status"); err != nil {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("setPodProgrammed: Pod name: %s\n%s", pod.Name, err.Error()))
+		return
+	}
+
+	log.WriteLog(types.StandardLog, fmt.Sprintf("setPodProgrammed: Pod name: %s\nBackends programmed in %d nodes", pod.Name, nodes))
+	events.Normal(pod, "BackendsProgrammed", fmt.Sprintf("backends of this Pod are programmed in %d nodes", nodes))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/zevenet/kube-nftlb/pkg/config"
 	"github.com/zevenet/kube-nftlb/pkg/http"
 	"github.com/zevenet/kube-nftlb/pkg/log"
 	"github.com/zevenet/kube-nftlb/pkg/metrics"
@@ -16,18 +17,42 @@ import (
 	corev1 "k8s.io/api/core/v1"
 )
 
+// Every Service known by the Service controller
+var serviceStore cache.Store
+
+// Displaced Services are applied again at most maxDisplacedPasses times after every Service event
+const maxDisplacedPasses = 10
+
 // NewServiceController returns a k8s controller with a Service resource watcher, and runs different functions based on the
 // event type that the watcher notifies.
 func NewServiceController(clientset *kubernetes.Clientset) cache.Controller {
 	listWatch := watcher.NewServiceListWatch(clientset)
 
-	eventHandler := cache.ResourceEventHandlerFuncs{
-		AddFunc:    AddNftlbFarm,
-		DeleteFunc: DeleteNftlbFarm,
-		UpdateFunc: UpdateNftlbFarm,
-	}
+	eventHandler := lockedHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			AddNftlbFarm(obj)
+			requeueDisplacedServices()
+		},
+		DeleteFunc: func(obj interface{}) {
+			DeleteNftlbFarm(obj)
+			parser.ReleaseVIPs(obj.(*corev1.Service))
+			parser.DeleteFarmStates(obj.(*corev1.Service))
+			forgetServiceStatus(obj.(*corev1.Service))
+			parser.CleanRemovedVIPs(obj.(*corev1.Service), nil)
+			requeueDisplacedServices()
+
+			// NftlbFarms can get farms owned by this Service
+			reconcileNftlbFarmsByKey(parser.ConflictedNftlbFarms())
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			UpdateNftlbFarm(oldObj, newObj)
+			parser.CleanRemovedVIPs(oldObj.(*corev1.Service), newObj.(*corev1.Service))
+			requeueDisplacedServices()
+		},
+	})
 
-	_, controller := cache.NewInformer(
+	var controller cache.Controller
+	serviceStore, controller = cache.NewInformer(
 		listWatch,
 		&corev1.Service{},
 		0,
@@ -41,6 +66,13 @@ func NewServiceController(clientset *kubernetes.Clientset) cache.Controller {
 func AddNftlbFarm(obj interface{}) {
 	svc := obj.(*corev1.Service)
 
+	// Show settings in effect as a Service annotation, without this node if its farms aren't programmed. It's written
+	// later without holding parserMutex
+	var programmed []types.Farm
+	defer func() {
+		queueServiceStatus(svc, programmed)
+	}()
+
 	// Reject an invalid Service
 	if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == "None" {
 		log.WriteLog(types.DetailedLog, fmt.Sprintf("AddNftlbFarms: Service name: %s\nInvalid Service, ClusterIP should not be empty", svc.Name))
@@ -49,6 +81,9 @@ func AddNftlbFarm(obj interface{}) {
 
 	// Parse Service as a Nftlb struct
 	data := parser.ServiceAsNftlb(svc)
+	if len(data.Farms) == 0 {
+		return
+	}
 
 	// Parse Nftlb struct as JSON
 	nftlbJSON, err := parser.NftlbAsJSON(data)
@@ -74,6 +109,7 @@ func AddNftlbFarm(obj interface{}) {
 
 	// Read the response
 	log.WriteLog(types.StandardLog, fmt.Sprintf("AddNftlbFarms: Service name: %s\n%s", svc.Name, string(response)))
+	programmed = data.Farms
 }
 
 // DeleteNftlbFarm takes in a Service object (k8s) and deletes the farm related to the service and its addresses (nftlb).
@@ -83,8 +119,10 @@ func DeleteNftlbFarm(obj interface{}) {
 
 	// Make channel where paths will come through
 	pathChan := make(chan string)
+	done := make(chan struct{})
 
 	go func() {
+		defer close(done)
 		for path := range pathChan {
 			// Get the response from that request
 			if response, err := http.Send(&types.RequestData{
@@ -98,13 +136,72 @@ func DeleteNftlbFarm(obj interface{}) {
 		}
 	}()
 
-	// Read paths and send them through the channel
+	// Read paths and send them through the channel, and wait until every path is deleted
 	parser.ServiceAsPaths(svc, pathChan)
+	<-done
 }
 
 // UpdateNftlbFarm takes in two Services (both are the same, but one it's before the update and the other it's updated)
 // and applies the changes from the updated Service.
 func UpdateNftlbFarm(oldObj, newObj interface{}) {
+	// Skip updates made by kube-nftlb itself
+	if !serviceChanged(oldObj.(*corev1.Service), newObj.(*corev1.Service)) {
+		return
+	}
+
 	DeleteNftlbFarm(oldObj)
 	AddNftlbFarm(newObj)
 }
+
+// requeueDisplacedServices applies again every Service that lost (or can now get) an externalIP or LoadBalancer IP.
+// Services displaced by the last pass are applied with the next Service event.
+func requeueDisplacedServices() {
+	for pass := 0; pass < maxDisplacedPasses; pass++ {
+		keys := parser.DisplacedServices()
+		if len(keys) == 0 {
+			return
+		}
+
+		for _, key := range keys {
+			obj, exists, err := serviceStore.GetByKey(key)
+			if err != nil || !exists {
+				continue
+			}
+
+			log.WriteLog(types.DetailedLog, fmt.Sprintf("requeueDisplacedServices: Service key: %s", key))
+			reconcileService(obj.(*corev1.Service))
+		}
+	}
+	if parser.HasDisplacedServices() {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("requeueDisplacedServices: node name: %s\nServices are still displaced after %d passes", config.NodeName, maxDisplacedPasses))
+	}
+}
+
+// reconcileServices applies again every known Service that matches a filter (for example, after defaults have changed).
+func reconcileServices(match func(*corev1.Service) bool) {
+	// The Service controller hasn't started yet, every Service will be applied with the current settings
+	if serviceStore == nil {
+		return
+	}
+
+	for _, obj := range serviceStore.List() {
+		if svc := obj.(*corev1.Service); match(svc) {
+			log.WriteLog(types.DetailedLog, fmt.Sprintf("reconcileServices: Service name: %s", svc.Name))
+			reconcileService(svc)
+		}
+	}
+	requeueDisplacedServices()
+}
+
+// reconcileService deletes and adds again the farms of a Service, and then its backends.
+func reconcileService(svc *corev1.Service) {
+	DeleteNftlbFarm(svc)
+	AddNftlbFarm(svc)
+
+	if endpointsStore == nil {
+		return
+	}
+	if obj, exists, err := endpointsStore.Get(svc); err == nil && exists {
+		AddNftlbBackends(obj)
+	}
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/parser"
+)
+
+// Weights of backends in slow start are raised every slowStartStep
+const slowStartStep = time.Second
+
+// RunSlowStart raises the weights of backends in slow start until stopCh is closed. It uses the same clock as the
+// parser, so it can be driven by a fake clock.
+func RunSlowStart(stopCh <-chan struct{}) {
+	ticker := parser.Clock.NewTicker(slowStartStep)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C():
+		}
+
+		runSlowStart()
+	}
+}
+
+// runSlowStart sends the weights of backends in slow start once, holding the lock of the controllers.
+func runSlowStart() {
+	parserMutex.Lock()
+	defer parserMutex.Unlock()
+
+	sendNftlbBackends(parser.SlowStartAsNftlb(), "RunSlowStart")
+}
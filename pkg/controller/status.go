@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/auth"
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/parser"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Every node merges its farms into the same annotation, so a patch is sent again (after a backoff) if another node has
+// changed the Service in the meantime
+const statusMaxRetries = 5
+
+// Status annotations are written statusDelay after a Service is queued, so a burst of changes is written once
+const statusDelay = time.Second
+
+var (
+	// It locks farmsPerServiceStatus
+	statusMutex sync.Mutex
+
+	// Map [Service (namespace/name)] to []{ farms programmed by this node }
+	farmsPerServiceStatus = make(map[string][]types.Farm)
+
+	// Services (namespace/name) whose status annotation must be written, it's written by RunStatusUpdates without
+	// holding parserMutex
+	statusQueue = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "status")
+)
+
+// queueServiceStatus keeps the farms programmed by this node for a Service (none if they aren't programmed), and
+// queues its status annotation.
+func queueServiceStatus(svc *corev1.Service, farms []types.Farm) {
+	key := svc.Namespace + "/" + svc.Name
+
+	statusMutex.Lock()
+	farmsPerServiceStatus[key] = farms
+	statusMutex.Unlock()
+
+	statusQueue.AddAfter(key, statusDelay)
+}
+
+// forgetServiceStatus forgets the farms of a deleted Service, its status annotation is deleted with it.
+func forgetServiceStatus(svc *corev1.Service) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+
+	delete(farmsPerServiceStatus, svc.Namespace+"/"+svc.Name)
+}
+
+// queueDeletedNodeStatus queues the status annotation of every Service that lists a deleted Node, so it's removed.
+func queueDeletedNodeStatus(nodeName string) {
+	if serviceStore == nil {
+		return
+	}
+
+	for _, obj := range serviceStore.List() {
+		if svc := obj.(*corev1.Service); parser.StatusHasNode(svc, nodeName) {
+			statusQueue.AddAfter(svc.Namespace+"/"+svc.Name, statusDelay)
+		}
+	}
+}
+
+// RunStatusUpdates writes the status annotation of queued Services until stopCh is closed.
+func RunStatusUpdates(stopCh <-chan struct{}) {
+	go func() {
+		<-stopCh
+		statusQueue.ShutDown()
+	}()
+
+	wait.Until(func() {
+		for processNextStatus() {
+		}
+	}, time.Second, stopCh)
+}
+
+// processNextStatus writes the status annotation of the next queued Service. It returns false once the queue is shut
+// down.
+func processNextStatus() bool {
+	item, shutdown := statusQueue.Get()
+	if shutdown {
+		return false
+	}
+	defer statusQueue.Done(item)
+
+	key := item.(string)
+	err := updateServiceStatus(key)
+	if err == nil {
+		statusQueue.Forget(item)
+		return true
+	}
+
+	if apierrors.IsConflict(err) && statusQueue.NumRequeues(item) < statusMaxRetries {
+		statusQueue.AddRateLimited(item)
+		return true
+	}
+	log.WriteLog(types.ErrorLog, fmt.Sprintf("updateServiceStatus: Service key: %s\n%s", key, err.Error()))
+	statusQueue.Forget(item)
+	return true
+}
+
+// updateServiceStatus merges the settings in effect for every farm programmed by this node into the status annotation
+// of a Service (namespace/name), only if they've changed. This node is removed from farms that it doesn't program, and
+// nodes that don't exist anymore are removed too. The annotation is deleted once it has no entries.
+func updateServiceStatus(key string) error {
+	obj, exists, err := serviceStore.GetByKey(key)
+	if err != nil {
+		return err
+	} else if !exists {
+		return nil
+	}
+	svc := obj.(*corev1.Service)
+
+	statusMutex.Lock()
+	farms := farmsPerServiceStatus[key]
+	statusMutex.Unlock()
+
+	status, changed := parser.ServiceStatus(svc, config.NodeName, farms, parser.NodeNames())
+	if !changed {
+		return nil
+	}
+
+	// A null value deletes the annotation
+	var value interface{} = status
+	if status == "" {
+		value = nil
+	}
+
+	// The resource version makes the patch fail if the annotation has been changed by another node
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": svc.ResourceVersion,
+			"annotations": map[string]interface{}{
+				parser.StatusAnnotation: value,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = auth.GetClientset().CoreV1().Services(svc.Namespace).Patch(context.TODO(), svc.Name, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// serviceChanged returns false if both Services only differ in metadata not read by kube-nftlb, like the status
+// annotation written by updateServiceStatus.
+func serviceChanged(oldSvc *corev1.Service, newSvc *corev1.Service) bool {
+	if !reflect.DeepEqual(oldSvc.Spec, newSvc.Spec) ||
+		!reflect.DeepEqual(oldSvc.Status, newSvc.Status) ||
+		!reflect.DeepEqual(oldSvc.Labels, newSvc.Labels) {
+		return true
+	}
+
+	oldAnnotations := make(map[string]string)
+	for key, value := range oldSvc.Annotations {
+		oldAnnotations[key] = value
+	}
+	newAnnotations := make(map[string]string)
+	for key, value := range newSvc.Annotations {
+		newAnnotations[key] = value
+	}
+	delete(oldAnnotations, parser.StatusAnnotation)
+	delete(newAnnotations, parser.StatusAnnotation)
+
+	return !reflect.DeepEqual(oldAnnotations, newAnnotations)
+}
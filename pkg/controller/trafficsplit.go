@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/zevenet/kube-nftlb/pkg/auth"
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/events"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/parser"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/watcher"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NewTrafficSplitController returns a k8s controller with a TrafficSplit resource watcher. It returns nil if
+// TrafficSplits aren't read (CLIENT_TRAFFIC_SPLITS) or their CRD isn't applied, its cache would never be synced.
+func NewTrafficSplitController(dynamicClient dynamic.Interface) cache.Controller {
+	if !config.TrafficSplits {
+		return nil
+	}
+	if err := watcher.CustomResourceServed(auth.GetClientset().Discovery(), types.TrafficSplitResource); err != nil {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("NewTrafficSplitController: TrafficSplits won't be read\n%s", err.Error()))
+		return nil
+	}
+
+	listWatch := watcher.NewTrafficSplitListWatch(dynamicClient)
+
+	eventHandler := lockedHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			updateTrafficSplit(obj.(*unstructured.Unstructured))
+		},
+		DeleteFunc: func(obj interface{}) {
+			split, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			updateEndpointsByKey(parser.DeleteTrafficSplit(split), "")
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			updateTrafficSplit(newObj.(*unstructured.Unstructured))
+		},
+	})
+
+	_, controller := cache.NewInformer(
+		listWatch,
+		&unstructured.Unstructured{},
+		0,
+		eventHandler,
+	)
+
+	return controller
+}
+
+// updateTrafficSplit reads a TrafficSplit and updates backends of its root Service. Only backends are sent to nftlb, so
+// a weight change doesn't touch farms or addresses.
+func updateTrafficSplit(split *unstructured.Unstructured) {
+	roots, errs := parser.SetTrafficSplit(split)
+	if len(errs) > 0 {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("updateTrafficSplit: TrafficSplit name: %s\n%s", split.GetName(), errs.ToAggregate().Error()))
+		events.Warning(split, "InvalidTrafficSplit", fmt.Sprintf("%s, the TrafficSplit will be ignored", errs.ToAggregate().Error()))
+	}
+
+	updateEndpointsByKey(roots, "")
+}
@@ -1,7 +0,0 @@
-package dsr
-
-import "github.com/zevenet/kube-nftlb/pkg/auth"
-
-var (
-	clientset = auth.GetClientset()
-)
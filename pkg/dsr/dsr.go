@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/zevenet/kube-nftlb/pkg/auth"
 	"github.com/zevenet/kube-nftlb/pkg/types"
 
 	corev1 "k8s.io/api/core/v1"
@@ -96,7 +97,7 @@ func getPodList(service *corev1.Service) []corev1.Pod {
 	}
 
 	// Get pod list
-	podList, err := clientset.CoreV1().Pods(corev1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	podList, err := auth.GetClientset().CoreV1().Pods(corev1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
 		// Don't continue if there are errors
 		return nil
@@ -119,7 +120,7 @@ func getPodList(service *corev1.Service) []corev1.Pod {
 }
 
 func getPodUID(backendName string) (string, error) {
-	pod, err := clientset.CoreV1().Pods(corev1.NamespaceAll).Get(context.TODO(), backendName, metav1.GetOptions{})
+	pod, err := auth.GetClientset().CoreV1().Pods(corev1.NamespaceAll).Get(context.TODO(), backendName, metav1.GetOptions{})
 	if err != nil {
 		// Don't continue if there are errors
 		return "", err
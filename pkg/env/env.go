@@ -37,6 +37,27 @@ func GetTime(key string) time.Duration {
 	return env
 }
 
+// GetStringDefault returns a string given the key from env, or defaultValue if that key is empty.
+func GetStringDefault(key string, defaultValue string) string {
+	if env := os.Getenv(key); env != "" {
+		return env
+	}
+	return defaultValue
+}
+
+// GetBoolDefault returns a bool given the key from env, or defaultValue if that key is empty.
+func GetBoolDefault(key string, defaultValue bool) bool {
+	if os.Getenv(key) == "" {
+		return defaultValue
+	}
+
+	env, err := strconv.ParseBool(GetString(key))
+	if err != nil {
+		panic(err)
+	}
+	return env
+}
+
 func init() {
 	// Read .env and panic if it couldn't be read
 	if err := godotenv.Load(); err != nil {
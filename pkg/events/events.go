@@ -0,0 +1,51 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/zevenet/kube-nftlb/pkg/auth"
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+
+	corev1 "k8s.io/api/core/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+var (
+	// The recorder is made the first time an Event is recorded
+	recorderOnce sync.Once
+	recorder     record.EventRecorder
+)
+
+// Warning records a Warning Event for a k8s object (for example, a Service with an invalid annotation).
+func Warning(obj runtime.Object, reason string, message string) {
+	getRecorder().Event(obj, corev1.EventTypeWarning, reason, message)
+}
+
+// Normal records a Normal Event for a k8s object.
+func Normal(obj runtime.Object, reason string, message string) {
+	getRecorder().Event(obj, corev1.EventTypeNormal, reason, message)
+}
+
+// getRecorder returns the EventRecorder, it's made the first time.
+func getRecorder() record.EventRecorder {
+	recorderOnce.Do(func() {
+		recorder = newRecorder()
+	})
+	return recorder
+}
+
+// newRecorder returns an EventRecorder that sends every Event to the API Server.
+func newRecorder() record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: auth.GetClientset().CoreV1().Events(corev1.NamespaceAll),
+	})
+
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{
+		Component: "kube-nftlb",
+		Host:      config.NodeName,
+	})
+}
@@ -0,0 +1,268 @@
+package health
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+)
+
+// Target is a backend probed by a health check.
+type Target struct {
+	Name string
+	IP   string
+	Port uint16
+}
+
+// Change is sent when a target of a group (farm) becomes healthy or unhealthy.
+type Change struct {
+	Group   string
+	Target  string
+	Healthy bool
+}
+
+// Checker runs the health checks of every group of targets (a farm and its backends). Every target is probed by its
+// own goroutine while its group has a check.
+type Checker struct {
+	mutex sync.Mutex
+
+	// Map [group] to { check }, only for groups with a check
+	checks map[string]*Check
+
+	// Map [group] to [target (name)] to { target }
+	targets map[string]map[string]Target
+
+	// Map [group] to [target (name)] to { prober }, only for groups with a check
+	probers map[string]map[string]*prober
+
+	changes chan Change
+}
+
+// prober probes a target until it's stopped.
+type prober struct {
+	target  Target
+	check   *Check
+	healthy bool
+	results int // Consecutive results that don't match the current state
+	stop    chan struct{}
+}
+
+// NewChecker returns a Checker without health checks.
+func NewChecker() *Checker {
+	return &Checker{
+		checks:  make(map[string]*Check),
+		targets: make(map[string]map[string]Target),
+		probers: make(map[string]map[string]*prober),
+		changes: make(chan Change, 100),
+	}
+}
+
+// Changes returns the channel where every change of a target is sent. Targets that stop being probed while they're
+// unhealthy are sent as healthy.
+func (c *Checker) Changes() <-chan Change {
+	return c.changes
+}
+
+// Healthy returns false only if a target of a group is probed and it's unhealthy.
+func (c *Checker) Healthy(group string, name string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if prober, ok := c.probers[group][name]; ok {
+		return prober.healthy
+	}
+	return true
+}
+
+// SetCheck sets the health check of a group, nil stops probing its targets. Targets that are probed again keep their
+// state.
+func (c *Checker) SetCheck(group string, check *Check) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if reflect.DeepEqual(c.checks[group], check) {
+		return
+	}
+	if check == nil {
+		delete(c.checks, group)
+	} else {
+		c.checks[group] = check
+	}
+	c.syncLocked(group)
+}
+
+// SetTargets sets every target of a group, targets that aren't given anymore stop being probed.
+func (c *Checker) SetTargets(group string, targets []Target) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.targets[group] = make(map[string]Target, len(targets))
+	for _, target := range targets {
+		c.targets[group][target.Name] = target
+	}
+	c.syncLocked(group)
+}
+
+// DeleteTargets stops probing every target of a group. Its check is kept.
+func (c *Checker) DeleteTargets(group string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.targets, group)
+	c.syncLocked(group)
+}
+
+// syncLocked starts a prober for every target of a group with a check, and stops probers that aren't needed anymore.
+// Probers whose target or check has changed are started again with the same state.
+func (c *Checker) syncLocked(group string) {
+	check := c.checks[group]
+	probers := c.probers[group]
+	if probers == nil {
+		probers = make(map[string]*prober)
+	}
+
+	for name, oldProber := range probers {
+		target, ok := c.targets[group][name]
+		ok = ok && probed(target, check)
+		if ok && target == oldProber.target && reflect.DeepEqual(check, oldProber.check) {
+			continue
+		}
+
+		close(oldProber.stop)
+		delete(probers, name)
+
+		// The backend is kept, but it's not probed anymore
+		if !ok {
+			metrics.BackendsHealth.DeleteLabelValues(group, name)
+			metrics.BackendsHealthCheckFailures.DeleteLabelValues(group, name)
+			if !oldProber.healthy {
+				go c.notify(Change{Group: group, Target: name, Healthy: true})
+			}
+			continue
+		}
+
+		// The same target with another check keeps its state, a moved target begins healthy
+		healthy := oldProber.healthy || target.IP != oldProber.target.IP
+		probers[name] = c.startLocked(group, target, check, healthy)
+		if healthy != oldProber.healthy {
+			go c.notify(Change{Group: group, Target: name, Healthy: healthy})
+		}
+	}
+
+	if check != nil {
+		for name, target := range c.targets[group] {
+			if _, ok := probers[name]; !ok && probed(target, check) {
+				probers[name] = c.startLocked(group, target, check, true)
+			}
+		}
+	}
+
+	if len(probers) == 0 {
+		delete(c.probers, group)
+	} else {
+		c.probers[group] = probers
+	}
+}
+
+// probed returns true if a target can be probed by a check: it must have an IP and a port.
+func probed(target Target, check *Check) bool {
+	return check != nil && target.IP != "" && (target.Port != 0 || check.Port != 0)
+}
+
+// startLocked starts probing a target.
+func (c *Checker) startLocked(group string, target Target, check *Check, healthy bool) *prober {
+	p := &prober{
+		target:  target,
+		check:   check,
+		healthy: healthy,
+		stop:    make(chan struct{}),
+	}
+	setHealthMetric(group, target.Name, healthy)
+
+	go c.run(group, p)
+	return p
+}
+
+// run probes a target every interval until it's stopped. The first probe is sent at once.
+func (c *Checker) run(group string, p *prober) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-p.stop
+		cancel()
+	}()
+
+	port := p.target.Port
+	if p.check.Port != 0 {
+		port = p.check.Port
+	}
+	address := net.JoinHostPort(p.target.IP, strconv.Itoa(int(port)))
+	ticker := time.NewTicker(p.check.Interval)
+	defer ticker.Stop()
+
+	for {
+		err := Probe(ctx, p.check, address)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			metrics.BackendsHealthCheckFailures.WithLabelValues(group, p.target.Name).Inc()
+		}
+		c.result(group, p, err == nil)
+
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// result counts the result of a probe, the state of the target changes when enough consecutive results don't match
+// it.
+func (c *Checker) result(group string, p *prober, success bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// The prober has been stopped while it was probing
+	if c.probers[group][p.target.Name] != p {
+		return
+	}
+
+	if success == p.healthy {
+		p.results = 0
+		return
+	}
+
+	p.results++
+	threshold := p.check.UnhealthyThreshold
+	if !p.healthy {
+		threshold = p.check.HealthyThreshold
+	}
+	if p.results < threshold {
+		return
+	}
+
+	p.healthy = success
+	p.results = 0
+	setHealthMetric(group, p.target.Name, p.healthy)
+	go c.notify(Change{Group: group, Target: p.target.Name, Healthy: p.healthy})
+}
+
+// notify sends a change, it's called in its own goroutine so the Checker is never blocked by a slow reader.
+func (c *Checker) notify(change Change) {
+	c.changes <- change
+}
+
+// setHealthMetric exports the state of a target: 1 if it's healthy and 0 otherwise.
+func setHealthMetric(group string, name string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	metrics.BackendsHealth.WithLabelValues(group, name).Set(value)
+}
@@ -0,0 +1,125 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Types of health checks
+const (
+	TypeTCP  = "tcp"
+	TypeHTTP = "http"
+	TypeUDP  = "udp"
+)
+
+// Check stores how backends of a farm are probed.
+type Check struct {
+	Type               string
+	Interval           time.Duration
+	Timeout            time.Duration
+	HealthyThreshold   int    // Consecutive successes needed by an unhealthy backend to be healthy again
+	UnhealthyThreshold int    // Consecutive failures needed by a healthy backend to be unhealthy
+	Port               uint16 // 0 probes the port of every backend
+	HTTPPath           string
+	HTTPStatusMin      int
+	HTTPStatusMax      int
+}
+
+// Probes don't reuse connections and don't follow redirects, so every probe reaches the backend and a redirect is a
+// valid status
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		DisableKeepAlives:  true,
+		DisableCompression: true,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Probe runs a single probe against an address (host:port), it returns nil if the backend is healthy:
+//
+// - tcp: a connection can be made.
+// - http: a GET request to the HTTP path gets a status code in the expected range.
+// - udp: a datagram sent to the address isn't answered with an ICMP port unreachable message before the timeout.
+func Probe(ctx context.Context, check *Check, address string) error {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	switch check.Type {
+	case TypeTCP:
+		return probeTCP(ctx, address)
+	case TypeHTTP:
+		return probeHTTP(ctx, address, check.HTTPPath, check.HTTPStatusMin, check.HTTPStatusMax)
+	case TypeUDP:
+		return probeUDP(ctx, address)
+	}
+	return fmt.Errorf("unknown health check type %q", check.Type)
+}
+
+// probeTCP opens and closes a TCP connection.
+func probeTCP(ctx context.Context, address string) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeHTTP sends a GET request and checks the status code of the response.
+func probeHTTP(ctx context.Context, address string, path string, statusMin int, statusMax int) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+address+path, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("User-Agent", "kube-nftlb-health-check/1.0")
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, 4096))
+
+	if response.StatusCode < statusMin || response.StatusCode > statusMax {
+		return fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+	return nil
+}
+
+// probeUDP sends an empty datagram and waits for an answer until the timeout. The backend is unhealthy only if the
+// port is closed (the answer is an ICMP port unreachable message), UDP services don't need to answer.
+func probeUDP(ctx context.Context, address string) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write([]byte{}); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, 512)
+	if _, err := conn.Read(buffer); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return fmt.Errorf("port unreachable")
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package health
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenTCP returns the address of a TCP listener that accepts every connection.
+func listenTCP(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// closedTCPAddress returns the address of a TCP port where nothing listens.
+func closedTCPAddress(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func TestProbeTCP(t *testing.T) {
+	check := &Check{Type: TypeTCP, Timeout: time.Second}
+
+	if err := Probe(context.Background(), check, listenTCP(t)); err != nil {
+		t.Fatalf("open port: got %v, want success", err)
+	}
+	if err := Probe(context.Background(), check, closedTCPAddress(t)); err == nil {
+		t.Fatal("closed port: got success, want an error")
+	}
+
+	// Probes that can't end before the timeout fail
+	if err := Probe(context.Background(), &Check{Type: TypeTCP, Timeout: time.Nanosecond}, listenTCP(t)); err == nil {
+		t.Fatal("timeout: got success, want an error")
+	}
+}
+
+func TestProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.UserAgent(), "kube-nftlb-health-check/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/healthz":
+			w.WriteHeader(http.StatusOK)
+		case "/moved":
+			http.Redirect(w, r, "/elsewhere", http.StatusFound)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		path    string
+		timeout time.Duration
+		success bool
+	}{
+		{"/healthz", time.Second, true},
+		// Redirects aren't followed, 302 is in the expected range
+		{"/moved", time.Second, true},
+		{"/unavailable", time.Second, false},
+		{"/slow", 50 * time.Millisecond, false},
+	}
+
+	for _, test := range tests {
+		check := &Check{Type: TypeHTTP, Timeout: test.timeout, HTTPPath: test.path, HTTPStatusMin: 200, HTTPStatusMax: 399}
+		if err := Probe(context.Background(), check, address); (err == nil) != test.success {
+			t.Fatalf("%s: got error %v, want success %t", test.path, err, test.success)
+		}
+	}
+
+	// Only the expected range is healthy
+	check := &Check{Type: TypeHTTP, Timeout: time.Second, HTTPPath: "/healthz", HTTPStatusMin: 204, HTTPStatusMax: 204}
+	if err := Probe(context.Background(), check, address); err == nil {
+		t.Fatal("status out of range: got success, want an error")
+	}
+}
+
+func TestProbeUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// UDP services don't need to answer
+	check := &Check{Type: TypeUDP, Timeout: 50 * time.Millisecond}
+	if err := Probe(context.Background(), check, conn.LocalAddr().String()); err != nil {
+		t.Fatalf("open port: got %v, want success", err)
+	}
+
+	closed, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := closed.LocalAddr().String()
+	closed.Close()
+	if err := Probe(context.Background(), check, address); err == nil {
+		t.Fatal("closed port: got success, want an error")
+	}
+}
+
+func TestCheckerThresholds(t *testing.T) {
+	checker := NewChecker()
+	defer checker.SetCheck("farm", nil)
+
+	address, _ := net.ResolveTCPAddr("tcp", closedTCPAddress(t))
+	target := Target{Name: "backend", IP: address.IP.String()}
+	checker.SetTargets("farm", []Target{target})
+	checker.SetCheck("farm", &Check{
+		Type:               TypeTCP,
+		Interval:           10 * time.Millisecond,
+		Timeout:            5 * time.Millisecond,
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 2,
+		Port:               uint16(address.Port),
+	})
+
+	select {
+	case change := <-checker.Changes():
+		if change.Group != "farm" || change.Target != "backend" || change.Healthy {
+			t.Fatalf("got change %+v, want backend unhealthy", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend wasn't set unhealthy")
+	}
+	if checker.Healthy("farm", "backend") {
+		t.Fatal("got healthy, want unhealthy")
+	}
+
+	// Targets that aren't probed anymore are healthy
+	checker.DeleteTargets("farm")
+	select {
+	case change := <-checker.Changes():
+		if !change.Healthy {
+			t.Fatalf("got change %+v, want backend healthy", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend wasn't set healthy")
+	}
+	if !checker.Healthy("farm", "backend") {
+		t.Fatal("got unhealthy, want healthy")
+	}
+}
@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ConntrackCleanupsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "kube_nftlb",
+		Name:      "conntrack_cleanups_total",
+		Help:      "How many batches of stale conntrack entries have been deleted",
+	})
+
+	ConntrackCleanupErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "kube_nftlb",
+		Name:      "conntrack_cleanup_errors_total",
+		Help:      "How many batches of stale conntrack entries have failed",
+	})
+
+	ConntrackEntriesDeletedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kube_nftlb",
+		Name:      "conntrack_entries_deleted_total",
+		Help:      "How many stale conntrack entries have been deleted, by destination (backend or vip)",
+	}, []string{"target"})
+)
@@ -16,4 +16,52 @@ var (
 		Name:      "rules_endpoints_changes_total",
 		Help:      "How many Endpoints changes have happened",
 	})
+
+	BackendsAutoWeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "backends_auto_weight",
+		Help:      "Weight of a backend found from the resources of its Pod or Node",
+	}, []string{"farm", "backend"})
+
+	BackendsTopologyPriority = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "backends_topology_priority",
+		Help:      "Priority of a backend found from the zone of its Node",
+	}, []string{"farm", "backend"})
+
+	FarmsWithoutEndpoints = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "farms_without_endpoints",
+		Help:      "Farms without endpoints, by what is done with their traffic (drop, reject or fallback)",
+	}, []string{"farm", "action"})
+
+	BackendsState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "backends_state",
+		Help:      "State of a backend made for a Pod, 1 for its current state (up, down or off)",
+	}, []string{"farm", "backend", "state"})
+
+	BackendsHealth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "backends_health",
+		Help:      "Result of the health check of a backend, 1 if it's healthy and 0 otherwise",
+	}, []string{"farm", "backend"})
+
+	BackendsHealthCheckFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kube_nftlb",
+		Name:      "backends_health_check_failures_total",
+		Help:      "How many health checks of a backend have failed",
+	}, []string{"farm", "backend"})
+
+	BackendsDraining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "backends_draining_connections",
+		Help:      "Connections tracked to a backend that is draining",
+	}, []string{"farm", "backend"})
+
+	BackendsDrainsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kube_nftlb",
+		Name:      "backends_drains_total",
+		Help:      "How many drains of backends have ended, by result (drained, timeout or cancelled)",
+	}, []string{"farm", "result"})
 )
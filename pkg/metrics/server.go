@@ -15,8 +15,27 @@ var (
 	collectors     = []prometheus.Collector{
 		EndpointsChangesPending,
 		EndpointsChangesTotal,
+		BackendsAutoWeight,
+		BackendsTopologyPriority,
+		BackendsState,
+		BackendsHealth,
+		BackendsHealthCheckFailures,
+		BackendsDraining,
+		BackendsDrainsTotal,
+		ConntrackCleanupsTotal,
+		ConntrackCleanupErrorsTotal,
+		ConntrackEntriesDeletedTotal,
+		FarmsWithoutEndpoints,
 		ServicesChangesPending,
 		ServicesChangesTotal,
+		ServicesVIPConflicts,
+		ServicesNewRtlimit,
+		ServicesNewRtlimitBurst,
+		ServicesRstRtlimit,
+		ServicesRstRtlimitBurst,
+		ServicesTCPStrict,
+		ServicesQueue,
+		ServicesFarmState,
 	}
 )
 
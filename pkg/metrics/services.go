@@ -16,4 +16,52 @@ var (
 		Name:      "rules_services_changes_total",
 		Help:      "How many Services changes have happened",
 	})
+
+	ServicesVIPConflicts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "services_vip_conflicts",
+		Help:      "How many externalIP or LoadBalancer IP ports of a Service are owned by an older Service",
+	}, []string{"namespace", "service"})
+
+	ServicesNewRtlimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "services_new_rtlimit",
+		Help:      "New connections per second allowed by a farm (0 is unlimited)",
+	}, []string{"namespace", "service", "farm"})
+
+	ServicesNewRtlimitBurst = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "services_new_rtlimit_burst",
+		Help:      "New connections burst allowed by a farm",
+	}, []string{"namespace", "service", "farm"})
+
+	ServicesRstRtlimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "services_rst_rtlimit",
+		Help:      "TCP resets per second allowed by a farm (0 is unlimited)",
+	}, []string{"namespace", "service", "farm"})
+
+	ServicesRstRtlimitBurst = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "services_rst_rtlimit_burst",
+		Help:      "TCP resets burst allowed by a farm",
+	}, []string{"namespace", "service", "farm"})
+
+	ServicesTCPStrict = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "services_tcp_strict",
+		Help:      "Whether a farm drops invalid TCP packets (1) or not (0)",
+	}, []string{"namespace", "service", "farm"})
+
+	ServicesFarmState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "services_farm_state",
+		Help:      "State of a farm, 1 for its current state (up, down or off)",
+	}, []string{"namespace", "service", "farm", "state"})
+
+	ServicesQueue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kube_nftlb",
+		Name:      "services_queue",
+		Help:      "NFQUEUE number where a farm sends its packets (-1 is disabled)",
+	}, []string{"namespace", "service", "farm"})
 )
@@ -0,0 +1,78 @@
+package nft
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Table is the nftables table (inet family) owned by kube-nftlb, nftlb tables are never changed.
+const Table = "kube-nftlb"
+
+var (
+	// It locks tableReady
+	tableMutex sync.Mutex
+
+	// The table has been made by this process
+	tableReady bool
+)
+
+// Run sends a script to nft through its standard input, so every command is applied at once.
+func Run(script string) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nft: %s: %s", err.Error(), strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// ensureTable makes the kube-nftlb table the first time it's needed. The table is made again from scratch, so elements
+// left by a previous kube-nftlb process are removed. If it can't be made, it's tried again the next time.
+func ensureTable() error {
+	tableMutex.Lock()
+	defer tableMutex.Unlock()
+
+	if tableReady {
+		return nil
+	}
+
+	err := Run(fmt.Sprintf(`add table inet %[1]s
+delete table inet %[1]s
+table inet %[1]s {
+	set reject-ipv4 {
+		type ipv4_addr . inet_proto . inet_service
+	}
+
+	set reject-ipv6 {
+		type ipv6_addr . inet_proto . inet_service
+	}
+
+	set reject-nodeports {
+		type inet_proto . inet_service
+	}
+
+	chain reject-vips {
+		meta l4proto tcp ip daddr . meta l4proto . th dport @reject-ipv4 reject with tcp reset
+		ip daddr . meta l4proto . th dport @reject-ipv4 reject
+		meta l4proto tcp ip6 daddr . meta l4proto . th dport @reject-ipv6 reject with tcp reset
+		ip6 daddr . meta l4proto . th dport @reject-ipv6 reject
+	}
+
+	chain prerouting {
+		type filter hook prerouting priority -110; policy accept;
+		jump reject-vips
+		meta l4proto tcp fib daddr type local meta l4proto . th dport @reject-nodeports reject with tcp reset
+		fib daddr type local meta l4proto . th dport @reject-nodeports reject
+	}
+
+	chain output {
+		type filter hook output priority -110; policy accept;
+		jump reject-vips
+	}
+}
+`, Table))
+	tableReady = err == nil
+	return err
+}
@@ -0,0 +1,54 @@
+package nft
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Reject is an IP, protocol and port whose traffic is rejected with a TCP reset (TCP) or an ICMP port unreachable
+// message (other protocols). An empty IP rejects the port in every local IP (NodePorts).
+type Reject struct {
+	IP       string
+	Protocol string
+	Port     string
+}
+
+// AddRejects starts rejecting traffic sent to every given IP, protocol and port.
+func AddRejects(rejects []Reject) error {
+	return updateRejects("add", rejects)
+}
+
+// DeleteRejects stops rejecting traffic sent to every given IP, protocol and port.
+func DeleteRejects(rejects []Reject) error {
+	return updateRejects("delete", rejects)
+}
+
+// updateRejects adds or deletes every reject with a single nft script.
+func updateRejects(command string, rejects []Reject) error {
+	if len(rejects) == 0 {
+		return nil
+	}
+	if err := ensureTable(); err != nil {
+		return err
+	}
+
+	// Map [set] to []{ elements }
+	elements := make(map[string][]string)
+	for _, reject := range rejects {
+		switch ip := net.ParseIP(reject.IP); {
+		case reject.IP == "":
+			elements["reject-nodeports"] = append(elements["reject-nodeports"], fmt.Sprintf("%s . %s", reject.Protocol, reject.Port))
+		case ip.To4() != nil:
+			elements["reject-ipv4"] = append(elements["reject-ipv4"], fmt.Sprintf("%s . %s . %s", reject.IP, reject.Protocol, reject.Port))
+		default:
+			elements["reject-ipv6"] = append(elements["reject-ipv6"], fmt.Sprintf("%s . %s . %s", reject.IP, reject.Protocol, reject.Port))
+		}
+	}
+
+	var script strings.Builder
+	for set, setElements := range elements {
+		fmt.Fprintf(&script, "%s element inet %s %s { %s }\n", command, Table, set, strings.Join(setElements, ", "))
+	}
+	return Run(script.String())
+}
@@ -1,68 +1,161 @@
 package parser
 
 import (
+	"fmt"
 	"regexp"
 	"strconv"
 
+	"github.com/zevenet/kube-nftlb/pkg/events"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/processor"
 	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
 
 	corev1 "k8s.io/api/core/v1"
 )
 
 // A regular expression is used to filter the annotation and get the field to configure,
 // always respecting the format of the annotation "service.kubernetes.io/kube-nftlb-load-balancer-X".
-var rgxAnnotations = regexp.MustCompile(`^service.kubernetes.io/kube-nftlb-load-balancer-`)
+var rgxAnnotations = regexp.MustCompile("^" + regexp.QuoteMeta(validation.ServiceAnnotationPrefix))
 
 func getAnnotations(service *corev1.Service) *types.Annotations {
-	// Default values
+	// Default values: built-in, cluster (ConfigMap) and namespace defaults
 	annotations := &types.Annotations{
-		Persistence:  "none",
-		PersistTTL:   "60",
-		Mode:         "snat",
-		Scheduler:    "rr",
-		SchedParam:   "none",
-		Helper:       "none",
-		Log:          "none",
-		EstConnlimit: "0",
+		Settings: serviceDefaults(service),
 	}
 
 	// Override default Persistence value if SessionAffinity is defined as "ClientIP"
 	if service.Spec.SessionAffinity == "ClientIP" {
-		annotations.Persistence = "srcip"
+		annotations.Settings["persistence"] = string(types.PersistenceSrcIP)
 	}
 
 	// Override default PersistTTL value if SessionAffinityConfig has TimeoutSeconds
 	if affConfig := service.Spec.SessionAffinityConfig; affConfig != nil && affConfig.ClientIP != nil && affConfig.ClientIP.TimeoutSeconds != nil {
 		// Value between 0 and 86400 seconds (1 day at most)
-		annotations.PersistTTL = strconv.FormatInt(int64(*affConfig.ClientIP.TimeoutSeconds), 32)
+		annotations.Settings["persistence-ttl"] = strconv.Itoa(int(*affConfig.ClientIP.TimeoutSeconds))
 	}
 
 	// Read every annotation from this Service
 	for key, value := range service.ObjectMeta.Annotations {
+		// Skip annotations not made for kube-nftlb
+		if !rgxAnnotations.MatchString(key) {
+			continue
+		}
+
+		// Invalid settings of a port are ignored one by one, so the other settings are kept
+		if rgxAnnotations.ReplaceAllString(key, "") == validation.PortsAnnotation {
+			annotations.Ports = readPortSettings(service, key, value)
+			continue
+		}
+
+		// Invalid values are ignored, so the default value is kept
+		if errs := validation.ServiceAnnotation(key, value); len(errs) > 0 {
+			log.WriteLog(types.ErrorLog, fmt.Sprintf("getAnnotations: Service name: %s\n%s", service.Name, errs.ToAggregate().Error()))
+			events.Warning(service, "InvalidAnnotation", fmt.Sprintf("%s, the default value will be used", errs.ToAggregate().Error()))
+			continue
+		}
+
 		// Match annotation key against the regex and remove the matched regex text
-		match := rgxAnnotations.ReplaceAllString(key, "")
-
-		// TODO Update README with changes made to annotations (more akin to how nftlb accepts values)
-		switch match {
-		case "mode":
-			annotations.Mode = value
-		case "persistence":
-			annotations.Persistence = value
-		case "scheduler":
-			annotations.Scheduler = value
-		case "sched-param":
-			annotations.SchedParam = value
-		case "helper":
-			annotations.Helper = value
-		case "est-connlimit":
-			annotations.EstConnlimit = value
-		case "log":
-			annotations.Log = value
-			annotations.LogPrefix = service.Name
+		name := rgxAnnotations.ReplaceAllString(key, "")
+		if _, ok := processor.Service(name); ok {
+			annotations.Settings[name] = value
+		}
+	}
+
+	// DSR can't be used without a virtual IP
+	annotationsPath := field.NewPath("metadata", "annotations")
+	if errs := validation.ModeForType(annotations.Settings["mode"], service.Spec.Type, annotationsPath.Key(validation.ServiceAnnotationPrefix+"mode")); len(errs) > 0 {
+		events.Warning(service, "InvalidAnnotation", fmt.Sprintf("%s, the default value will be used", errs.ToAggregate().Error()))
+		annotations.Settings["mode"] = string(types.ModeSNAT)
+	}
+
+	// Health checks must time out before the next one is sent
+	intervalName, timeoutName := processor.HealthCheckIntervalSetting, processor.HealthCheckTimeoutSetting
+	if errs := validation.HealthCheckTimeout(annotations.Settings[intervalName], annotations.Settings[timeoutName], annotationsPath.Key(validation.ServiceAnnotationPrefix+timeoutName)); len(errs) > 0 {
+		events.Warning(service, "InvalidAnnotation", fmt.Sprintf("%s, the default values will be used", errs.ToAggregate().Error()))
+		for _, name := range []string{intervalName, timeoutName} {
+			if settingProcessor, ok := processor.Service(name); ok {
+				annotations.Settings[name] = settingProcessor.Default()
+			}
 		}
 	}
 
-	annotations.Iface = findIface(annotations.Mode)
+	// Settings for every port must be made for ports of this Service
+	portsPath := annotationsPath.Key(validation.ServiceAnnotationPrefix + validation.PortsAnnotation)
+	for port, settings := range annotations.Ports {
+		if !validation.HasPort(service, port) {
+			events.Warning(service, "InvalidAnnotation", fmt.Sprintf("%s: port not found in this Service", portsPath.Key(port)))
+			delete(annotations.Ports, port)
+			continue
+		}
+
+		if errs := validation.ModeForType(settings["mode"], service.Spec.Type, portsPath.Key(port).Key("mode")); len(errs) > 0 {
+			events.Warning(service, "InvalidAnnotation", fmt.Sprintf("%s, the Service value will be used", errs.ToAggregate().Error()))
+			delete(settings, "mode")
+		}
+
+		portInterval, hasInterval := settings[intervalName]
+		portTimeout, hasTimeout := settings[timeoutName]
+		if !hasInterval && !hasTimeout {
+			continue
+		}
+		if !hasInterval {
+			portInterval = annotations.Settings[intervalName]
+		}
+		if !hasTimeout {
+			portTimeout = annotations.Settings[timeoutName]
+		}
+		if errs := validation.HealthCheckTimeout(portInterval, portTimeout, portsPath.Key(port).Key(timeoutName)); len(errs) > 0 {
+			events.Warning(service, "InvalidAnnotation", fmt.Sprintf("%s, the Service values will be used", errs.ToAggregate().Error()))
+			delete(settings, intervalName)
+			delete(settings, timeoutName)
+		}
+	}
 
 	return annotations
 }
+
+// readPortSettings reads the ports annotation of a Service. Every invalid setting is dropped and recorded as a Warning
+// Event, so the Service value is used for that port. Nothing is read if the annotation isn't a JSON object.
+func readPortSettings(service *corev1.Service, key string, value string) map[string]map[string]string {
+	portsPath := field.NewPath("metadata", "annotations").Key(key)
+	portSettings, errs := validation.PortSettings(value, portsPath)
+	if portSettings == nil {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("getAnnotations: Service name: %s\n%s", service.Name, errs.ToAggregate().Error()))
+		events.Warning(service, "InvalidAnnotation", fmt.Sprintf("%s, the default value will be used", errs.ToAggregate().Error()))
+		return nil
+	}
+
+	for port, settings := range portSettings {
+		for name, setting := range settings {
+			if errs := validation.Setting(name, setting, portsPath.Key(port)); len(errs) > 0 {
+				log.WriteLog(types.ErrorLog, fmt.Sprintf("getAnnotations: Service name: %s\n%s", service.Name, errs.ToAggregate().Error()))
+				events.Warning(service, "InvalidAnnotation", fmt.Sprintf("%s, the Service value will be used", errs.ToAggregate().Error()))
+				delete(settings, name)
+			}
+		}
+	}
+
+	return portSettings
+}
+
+// annotationsForPort returns the settings for a ServicePort: Service settings are overridden by the ports annotation,
+// first by port number and then by port name.
+func annotationsForPort(annotations *types.Annotations, servicePort *corev1.ServicePort) *types.Annotations {
+	portAnnotations := &types.Annotations{
+		Settings: make(map[string]string, len(annotations.Settings)),
+	}
+	for name, value := range annotations.Settings {
+		portAnnotations.Settings[name] = value
+	}
+
+	for _, port := range []string{strconv.Itoa(int(servicePort.Port)), servicePort.Name} {
+		for name, value := range annotations.Ports[port] {
+			portAnnotations.Settings[name] = value
+		}
+	}
+
+	return portAnnotations
+}
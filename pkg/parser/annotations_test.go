@@ -0,0 +1,171 @@
+package parser
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetAnnotationsInvalidValues(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "my-service",
+			Annotations: map[string]string{
+				"service.kubernetes.io/kube-nftlb-load-balancer-mode":      "dsr",
+				"service.kubernetes.io/kube-nftlb-load-balancer-scheduler": "roundrobin",
+				"service.kubernetes.io/kube-nftlb-load-balancer-log":       "input",
+				"other.io/scheduler": "hash",
+			},
+		},
+	}
+
+	annotations := getAnnotations(service)
+
+	// The invalid scheduler falls back to its default value
+	want := map[string]string{
+		"mode":            "dsr",
+		"scheduler":       "rr",
+		"log":             "input",
+		"persistence":     "none",
+		"persistence-ttl": "60",
+		"auto-weight":     "none",
+		"slow-start":      "0s",
+	}
+	for name, value := range want {
+		if annotations.Settings[name] != value {
+			t.Errorf("%s: got %q, want %q", name, annotations.Settings[name], value)
+		}
+	}
+}
+
+func TestAnnotationsForPort(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "dns",
+			Annotations: map[string]string{
+				"service.kubernetes.io/kube-nftlb-load-balancer-scheduler": "hash",
+				"service.kubernetes.io/kube-nftlb-load-balancer-ports":     `{"dns-tcp": {"scheduler": "rr"}, "53": {"scheduler": "symhash", "mode": "dnat"}, "8080": {"mode": "dnat"}}`,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{Name: "dns-tcp", Port: 53, Protocol: corev1.ProtocolTCP},
+				{Name: "dns-udp", Port: 53, Protocol: corev1.ProtocolUDP},
+				{Name: "metrics", Port: 9153, Protocol: corev1.ProtocolTCP},
+			},
+		},
+	}
+
+	annotations := getAnnotations(service)
+
+	// Ports that don't exist in the Service are dropped
+	if _, ok := annotations.Ports["8080"]; ok {
+		t.Fatalf("got settings for port 8080, want them dropped")
+	}
+
+	// Settings of the Service are overridden by port number and then by port name
+	tests := []struct {
+		port      int
+		scheduler string
+		mode      string
+	}{
+		{0, "rr", "dnat"},
+		{1, "symhash", "dnat"},
+		{2, "hash", "snat"},
+	}
+	for _, test := range tests {
+		servicePort := &service.Spec.Ports[test.port]
+		settings := annotationsForPort(annotations, servicePort).Settings
+		if settings["scheduler"] != test.scheduler || settings["mode"] != test.mode {
+			t.Errorf("%s: got scheduler %q and mode %q, want %q and %q", servicePort.Name, settings["scheduler"], settings["mode"], test.scheduler, test.mode)
+		}
+	}
+}
+
+func TestGetAnnotationsInvalidPortSetting(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "dns",
+			Annotations: map[string]string{
+				"service.kubernetes.io/kube-nftlb-load-balancer-scheduler": "hash",
+				"service.kubernetes.io/kube-nftlb-load-balancer-ports":     `{"dns-tcp": {"scheduler": "rr"}, "53": {"scheduler": "roundrobin", "mode": "dnat"}}`,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{Name: "dns-tcp", Port: 53, Protocol: corev1.ProtocolTCP},
+				{Name: "dns-udp", Port: 53, Protocol: corev1.ProtocolUDP},
+			},
+		},
+	}
+
+	annotations := getAnnotations(service)
+
+	// The invalid scheduler is dropped, and every other setting is kept
+	if settings := annotationsForPort(annotations, &service.Spec.Ports[0]).Settings; settings["scheduler"] != "rr" || settings["mode"] != "dnat" {
+		t.Fatalf("dns-tcp: got scheduler %q and mode %q, want rr and dnat", settings["scheduler"], settings["mode"])
+	}
+	if settings := annotationsForPort(annotations, &service.Spec.Ports[1]).Settings; settings["scheduler"] != "hash" || settings["mode"] != "dnat" {
+		t.Fatalf("dns-udp: got scheduler %q and mode %q, want hash and dnat", settings["scheduler"], settings["mode"])
+	}
+}
+
+func TestGetAnnotationsInvalidPortsJSON(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "web",
+			Annotations: map[string]string{
+				"service.kubernetes.io/kube-nftlb-load-balancer-ports": `{"http": "hash"}`,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP}},
+		},
+	}
+
+	if annotations := getAnnotations(service); len(annotations.Ports) != 0 {
+		t.Fatalf("got port settings %v, want none", annotations.Ports)
+	}
+}
+
+func TestGetAnnotationsHealthCheckTimeout(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "web",
+			Annotations: map[string]string{
+				"service.kubernetes.io/kube-nftlb-load-balancer-health-check-interval": "5s",
+				"service.kubernetes.io/kube-nftlb-load-balancer-health-check-timeout":  "5s",
+				"service.kubernetes.io/kube-nftlb-load-balancer-ports":                 `{"http": {"health-check-timeout": "1s"}, "admin": {"health-check-interval": "1s"}}`,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP},
+				{Name: "admin", Port: 8080, Protocol: corev1.ProtocolTCP},
+			},
+		},
+	}
+
+	// A timeout that isn't shorter than the interval isn't used, default values are used instead
+	annotations := getAnnotations(service)
+	if settings := annotations.Settings; settings["health-check-interval"] != "10s" || settings["health-check-timeout"] != "2s" {
+		t.Fatalf("got interval %q and timeout %q, want 10s and 2s", settings["health-check-interval"], settings["health-check-timeout"])
+	}
+
+	// Ports can change the timeout or the interval, unless the timeout isn't shorter than the interval
+	if settings := annotationsForPort(annotations, &service.Spec.Ports[0]).Settings; settings["health-check-interval"] != "10s" || settings["health-check-timeout"] != "1s" {
+		t.Fatalf("http: got interval %q and timeout %q, want 10s and 1s", settings["health-check-interval"], settings["health-check-timeout"])
+	}
+	if settings := annotationsForPort(annotations, &service.Spec.Ports[1]).Settings; settings["health-check-interval"] != "10s" || settings["health-check-timeout"] != "2s" {
+		t.Fatalf("admin: got interval %q and timeout %q, want 10s and 2s", settings["health-check-interval"], settings["health-check-timeout"])
+	}
+}
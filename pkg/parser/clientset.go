@@ -1,7 +0,0 @@
-package parser
-
-import (
-	"github.com/zevenet/kube-nftlb/pkg/auth"
-)
-
-var clientset = auth.GetClientset()
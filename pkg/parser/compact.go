@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zevenet/kube-nftlb/pkg/processor"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// compactFarm stores the farm made for every ServicePort of a Service, and how many ports a backend must have.
+type compactFarm struct {
+	name  string
+	ports int
+}
+
+// canCompact returns true if the ServicePorts of a Service programmed in this node can be programmed as a single farm.
+// nftlb can't map ports, so backends must keep the destination port (every targetPort must be the same number as its
+// port). Also, every ServicePort must have the same settings.
+func canCompact(service *corev1.Service, servicePorts []corev1.ServicePort, annotations *types.Annotations) bool {
+	// NodePorts are never the same as their targetPorts
+	if len(servicePorts) < 2 || service.Spec.Type != corev1.ServiceTypeClusterIP {
+		return false
+	}
+
+	var firstAnnotations *types.Annotations
+	for index := range servicePorts {
+		servicePort := &servicePorts[index]
+		if servicePort.TargetPort.StrVal != "" || servicePort.TargetPort.IntVal != servicePort.Port {
+			return false
+		}
+
+		// Settings found for every ServicePort must be the same
+		portAnnotations := annotationsForPort(annotations, servicePort)
+		if _, ok := portAnnotations.Settings["helper"]; !ok {
+			portAnnotations.Settings["helper"] = findHelper(servicePort)
+		}
+		if firstAnnotations == nil {
+			firstAnnotations = portAnnotations
+		} else if !reflect.DeepEqual(firstAnnotations, portAnnotations) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// servicePortsAsFarm returns a single Farm struct for every ServicePort. It has 1 address for every protocol and IP,
+// and those addresses have every port of that protocol.
+func servicePortsAsFarm(servicePorts []corev1.ServicePort, serviceData *types.ServiceData, annotations *types.Annotations) *types.Farm {
+	// Every ServicePort has the same settings
+	annotations = annotationsForPort(annotations, &servicePorts[0])
+	farm := annotationsAsFarm(FormatCompactName(serviceData.Name), serviceData.Name, annotations)
+	if farm.Helper == "" {
+		farm.Helper = types.Helper(findHelper(&servicePorts[0]))
+	}
+
+	// Map [protocol] to []{ ServicePorts }
+	portsPerProtocol := make(map[types.Protocol][]*corev1.ServicePort)
+	protocols := make([]types.Protocol, 0)
+	for index := range servicePorts {
+		protocol := types.Protocol(strings.ToLower(string(servicePorts[index].Protocol)))
+		if _, ok := portsPerProtocol[protocol]; !ok {
+			protocols = append(protocols, protocol)
+		}
+		portsPerProtocol[protocol] = append(portsPerProtocol[protocol], &servicePorts[index])
+	}
+
+	for _, protocol := range protocols {
+		portsName := fmt.Sprintf("ports--%s", protocol)
+
+		// ClusterIP address
+		farm.Addresses = append(farm.Addresses, types.Address{
+			Name:     fmt.Sprintf("%s--address", FormatName(serviceData.Name, portsName)),
+			Family:   serviceData.Family,
+			IPAddr:   serviceData.ClusterIP,
+			Ports:    formatPorts(portsPerProtocol[protocol], "", nil),
+			Protocol: protocol,
+		})
+
+		// Add externalIPs as addresses, skipping ports of VIPs owned by an older Service
+		for index, externalIP := range serviceData.ExternalIPs {
+			if ports := formatPorts(portsPerProtocol[protocol], externalIP, serviceData.VIPConflicts); ports != "" {
+				address := types.Address{
+					Family:   serviceData.Family,
+					IPAddr:   externalIP,
+					Ports:    ports,
+					Protocol: protocol,
+				}
+				address.Name = fmt.Sprintf("%s--address", vipAddressName(serviceData, FormatExternalIPName(serviceData.Name, portsName, index+1), &address))
+				farm.Addresses = append(farm.Addresses, address)
+			}
+		}
+	}
+
+	// Address settings are applied once every address has been added
+	processor.ApplyAddresses(farm, annotations.Settings)
+
+	return farm
+}
+
+// formatPorts returns a nftlb ports string, where consecutive ports are joined as ranges (example: "80,443,8000-8002").
+// Ports of a VIP found in conflicts are skipped.
+func formatPorts(servicePorts []*corev1.ServicePort, vip string, conflicts map[string]string) string {
+	ports := make([]int, 0, len(servicePorts))
+	for _, servicePort := range servicePorts {
+		if _, conflict := conflicts[formatVIPConflict(vip, formatVIPPort(servicePort))]; conflict {
+			continue
+		}
+		ports = append(ports, int(servicePort.Port))
+	}
+	sort.Ints(ports)
+
+	ranges := make([]string, 0)
+	for start := 0; start < len(ports); {
+		end := start
+		for end+1 < len(ports) && ports[end+1] == ports[end]+1 {
+			end++
+		}
+
+		if start == end {
+			ranges = append(ranges, strconv.Itoa(ports[start]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", ports[start], ports[end]))
+		}
+		start = end + 1
+	}
+
+	return strings.Join(ranges, ",")
+}
+
+// endpointsAsCompactFarm returns a single Farm struct for every EndpointPort. Backends don't have a port (nftlb keeps
+// the destination port), and only EndpointAddresses with every port are added.
+func endpointsAsCompactFarm(endpoints *corev1.Endpoints, compact compactFarm) types.Farm {
+	farm := types.Farm{
+		Name:     compact.name,
+		Backends: make([]types.Backend, 0),
+	}
+	backendsPerFarm[farm.Name] = make([]string, 0)
+	podBackends := make([]podBackend, 0)
+
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Ports) != compact.ports {
+			continue
+		}
+
+		backends := make([]types.Backend, 0, len(subset.Addresses))
+		for _, epAddress := range subset.Addresses {
+			backend := types.Backend{
+				IPAddr: epAddress.IP,
+				State:  types.StateUp,
+			}
+
+			if epAddress.TargetRef != nil {
+				backend.Name = FormatCompactName(epAddress.TargetRef.Name)
+			} else {
+				backend.Name = FormatCompactName(endpoints.Name)
+			}
+
+			backends = append(backends, backend)
+			backendsPerFarm[farm.Name] = append(backendsPerFarm[farm.Name], backend.Name)
+		}
+
+		podBackends = append(podBackends, trackPodBackends(backends, subset.Addresses, endpoints.Namespace)...)
+		farm.Backends = append(farm.Backends, backends...)
+	}
+
+	// Apply settings read from Pods
+	setPodBackends(farm.Name, podKey(endpoints.Namespace, endpoints.Name), podBackends)
+	applyPodSettings(farm.Name, farm.Backends)
+
+	return farm
+}
@@ -0,0 +1,204 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// newServicePort returns a ServicePort whose targetPort is the given one.
+func newServicePort(name string, port int32, protocol corev1.Protocol, targetPort intstr.IntOrString) corev1.ServicePort {
+	return corev1.ServicePort{Name: name, Port: port, Protocol: protocol, TargetPort: targetPort}
+}
+
+func TestCanCompact(t *testing.T) {
+	tests := []struct {
+		name        string
+		serviceType corev1.ServiceType
+		ports       []corev1.ServicePort
+		helper      string
+		compact     bool
+	}{
+		{
+			name:        "same targetPorts",
+			serviceType: corev1.ServiceTypeClusterIP,
+			ports: []corev1.ServicePort{
+				newServicePort("a", 8080, corev1.ProtocolTCP, intstr.FromInt(8080)),
+				newServicePort("b", 8081, corev1.ProtocolUDP, intstr.FromInt(8081)),
+			},
+			compact: true,
+		},
+		{
+			name:        "a single port",
+			serviceType: corev1.ServiceTypeClusterIP,
+			ports:       []corev1.ServicePort{newServicePort("a", 8080, corev1.ProtocolTCP, intstr.FromInt(8080))},
+		},
+		{
+			name:        "NodePort Service",
+			serviceType: corev1.ServiceTypeNodePort,
+			ports: []corev1.ServicePort{
+				newServicePort("a", 8080, corev1.ProtocolTCP, intstr.FromInt(8080)),
+				newServicePort("b", 8081, corev1.ProtocolTCP, intstr.FromInt(8081)),
+			},
+		},
+		{
+			name:        "mapped targetPort",
+			serviceType: corev1.ServiceTypeClusterIP,
+			ports: []corev1.ServicePort{
+				newServicePort("a", 8080, corev1.ProtocolTCP, intstr.FromInt(8080)),
+				newServicePort("b", 8081, corev1.ProtocolTCP, intstr.FromInt(80)),
+			},
+		},
+		{
+			name:        "named targetPort",
+			serviceType: corev1.ServiceTypeClusterIP,
+			ports: []corev1.ServicePort{
+				newServicePort("a", 8080, corev1.ProtocolTCP, intstr.FromInt(8080)),
+				newServicePort("b", 8081, corev1.ProtocolTCP, intstr.FromString("http")),
+			},
+		},
+		{
+			name:        "different helpers",
+			serviceType: corev1.ServiceTypeClusterIP,
+			ports: []corev1.ServicePort{
+				newServicePort("a", 21, corev1.ProtocolTCP, intstr.FromInt(21)),
+				newServicePort("b", 22, corev1.ProtocolTCP, intstr.FromInt(22)),
+			},
+		},
+		{
+			name:        "helper annotation",
+			serviceType: corev1.ServiceTypeClusterIP,
+			ports: []corev1.ServicePort{
+				newServicePort("a", 21, corev1.ProtocolTCP, intstr.FromInt(21)),
+				newServicePort("b", 22, corev1.ProtocolTCP, intstr.FromInt(22)),
+			},
+			helper:  "ftp",
+			compact: true,
+		},
+	}
+
+	for _, test := range tests {
+		service := &corev1.Service{Spec: corev1.ServiceSpec{Type: test.serviceType, Ports: test.ports}}
+		annotations := &types.Annotations{Settings: make(map[string]string)}
+		if test.helper != "" {
+			annotations.Settings["helper"] = test.helper
+		}
+		if compact := canCompact(service, service.Spec.Ports, annotations); compact != test.compact {
+			t.Errorf("%s: got %t, want %t", test.name, compact, test.compact)
+		}
+	}
+}
+
+func TestCanCompactPortsInScope(t *testing.T) {
+	service := &corev1.Service{Spec: corev1.ServiceSpec{
+		Type: corev1.ServiceTypeClusterIP,
+		Ports: []corev1.ServicePort{
+			newServicePort("a", 8080, corev1.ProtocolTCP, intstr.FromInt(8080)),
+			newServicePort("b", 8081, corev1.ProtocolTCP, intstr.FromInt(8081)),
+			newServicePort("admin", 9000, corev1.ProtocolTCP, intstr.FromString("admin")),
+		},
+	}}
+	annotations := &types.Annotations{Settings: make(map[string]string)}
+
+	// Only ports programmed in this node are compacted, a port out of scope doesn't prevent it
+	if canCompact(service, service.Spec.Ports, annotations) {
+		t.Fatal("every port: got true, want false")
+	}
+	if !canCompact(service, service.Spec.Ports[:2], annotations) {
+		t.Fatal("ports a and b: got false, want true")
+	}
+	if canCompact(service, service.Spec.Ports[:1], annotations) {
+		t.Fatal("port a: got true, want false")
+	}
+}
+
+func TestFormatPorts(t *testing.T) {
+	tests := []struct {
+		ports     []int32
+		conflicts map[string]string
+		want      string
+	}{
+		{ports: []int32{80}, want: "80"},
+		{ports: []int32{443, 80}, want: "80,443"},
+		{ports: []int32{8002, 8000, 8001, 9090}, want: "8000-8002,9090"},
+		{ports: []int32{80, 81, 83, 84, 85}, want: "80-81,83-85"},
+		{ports: []int32{80, 81, 82}, conflicts: map[string]string{"192.168.0.10:81/tcp": "default/other"}, want: "80,82"},
+		{ports: []int32{80}, conflicts: map[string]string{"192.168.0.10:80/tcp": "default/other"}, want: ""},
+	}
+
+	for _, test := range tests {
+		servicePorts := make([]*corev1.ServicePort, 0, len(test.ports))
+		for _, port := range test.ports {
+			servicePorts = append(servicePorts, &corev1.ServicePort{Port: port, Protocol: corev1.ProtocolTCP})
+		}
+
+		if ports := formatPorts(servicePorts, "192.168.0.10", test.conflicts); ports != test.want {
+			t.Errorf("ports %v (conflicts %v): got %q, want %q", test.ports, test.conflicts, ports, test.want)
+		}
+	}
+}
+
+func TestServicePortsAsFarm(t *testing.T) {
+	servicePorts := []corev1.ServicePort{
+		newServicePort("dns-udp", 53, corev1.ProtocolUDP, intstr.FromInt(53)),
+		newServicePort("http", 8080, corev1.ProtocolTCP, intstr.FromInt(8080)),
+		newServicePort("http-alt", 8081, corev1.ProtocolTCP, intstr.FromInt(8081)),
+	}
+	serviceData := &types.ServiceData{
+		Name:         "my-service",
+		Family:       "ipv4",
+		ClusterIP:    "10.0.0.1",
+		ExternalIPs:  []string{"192.168.0.10"},
+		VIPConflicts: map[string]string{"192.168.0.10:53/udp": "default/other"},
+	}
+
+	farm := servicePortsAsFarm(servicePorts, serviceData, &types.Annotations{Settings: map[string]string{"helper": "none"}})
+	if farm.Name != "my-service--ports" {
+		t.Fatalf("got farm name %q, want %q", farm.Name, "my-service--ports")
+	}
+
+	want := []types.Address{
+		{Name: "my-service--ports--udp--address", Family: "ipv4", IPAddr: "10.0.0.1", Ports: "53", Protocol: "udp"},
+		{Name: "my-service--ports--tcp--address", Family: "ipv4", IPAddr: "10.0.0.1", Ports: "8080-8081", Protocol: "tcp"},
+		{Name: "my-service--ports--tcp--externalIP-1--address", Family: "ipv4", IPAddr: "192.168.0.10", Ports: "8080-8081", Protocol: "tcp"},
+	}
+	if len(farm.Addresses) != len(want) {
+		t.Fatalf("got addresses %+v, want %+v", farm.Addresses, want)
+	}
+	for index := range want {
+		if farm.Addresses[index] != want[index] {
+			t.Errorf("address %d: got %+v, want %+v", index, farm.Addresses[index], want[index])
+		}
+	}
+}
+
+func TestEndpointsAsCompactFarm(t *testing.T) {
+	defer delete(backendsPerFarm, "my-service--ports")
+
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-service"},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{{IP: "10.1.0.1", TargetRef: &corev1.ObjectReference{Name: "pod-a"}}},
+				Ports:     []corev1.EndpointPort{{Port: 8080}, {Port: 8081}},
+			},
+			{
+				// Pods without every port aren't backends of the farm
+				Addresses: []corev1.EndpointAddress{{IP: "10.1.0.2", TargetRef: &corev1.ObjectReference{Name: "pod-b"}}},
+				Ports:     []corev1.EndpointPort{{Port: 8080}},
+			},
+		},
+	}
+
+	farm := endpointsAsCompactFarm(endpoints, compactFarm{name: "my-service--ports", ports: 2})
+	if len(farm.Backends) != 1 {
+		t.Fatalf("got backends %+v, want only pod-a", farm.Backends)
+	}
+	if backend := farm.Backends[0]; backend.Name != "pod-a--ports" || backend.IPAddr != "10.1.0.1" || backend.Port != nil {
+		t.Fatalf("got backend %+v, want pod-a--ports at 10.1.0.1 without a port", backend)
+	}
+}
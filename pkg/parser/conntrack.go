@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/vishvananda/netns"
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/conntrack"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ConntrackCleaner deletes conntrack entries of removed backends and VIPs, its batches are sent by the controller.
+var ConntrackCleaner = conntrack.NewCleaner(netns.None())
+
+// CleanRemovedVIPs deletes conntrack entries of every VIP port (ClusterIP, externalIPs and LoadBalancer IPs) of a
+// Service that the updated Service doesn't have anymore. The updated Service is nil if it has been deleted.
+func CleanRemovedVIPs(oldService *corev1.Service, newService *corev1.Service) {
+	if !config.ConntrackCleanup {
+		return
+	}
+
+	newVIPs := make(map[string]bool)
+	if newService != nil {
+		for _, target := range vipTargets(newService) {
+			newVIPs[vipTargetKey(target)] = true
+		}
+	}
+
+	for _, target := range vipTargets(oldService) {
+		if !newVIPs[vipTargetKey(target)] {
+			ConntrackCleaner.Add(target)
+		}
+	}
+}
+
+// cleanBackend deletes UDP conntrack entries sent from the VIPs of a farm to a backend that has been removed. Farms
+// without UDP addresses are skipped.
+func cleanBackend(farmName string, backend types.Backend) {
+	if !config.ConntrackCleanup {
+		return
+	}
+
+	vips := make([]conntrack.VIP, 0)
+	for _, vip := range vipsPerFarm[farmName] {
+		if vip.Protocol == 0 || vip.Protocol == syscall.IPPROTO_UDP {
+			vips = append(vips, vip)
+		}
+	}
+	if len(vips) == 0 {
+		return
+	}
+
+	// Backends of compact farms don't have a port, every port is matched
+	port := uint16(0)
+	if backend.Port != nil {
+		port = uint16(*backend.Port)
+	}
+	ConntrackCleaner.Add(conntrack.BackendTarget(backend.IPAddr, port, vips))
+}
+
+// vipTargets returns a conntrack target for every VIP port of a Service.
+func vipTargets(service *corev1.Service) []conntrack.Target {
+	vips := serviceVIPs(service)
+	if service.Spec.ClusterIP != "" && service.Spec.ClusterIP != corev1.ClusterIPNone {
+		vips = append(vips, service.Spec.ClusterIP)
+	}
+
+	targets := make([]conntrack.Target, 0, len(vips)*len(service.Spec.Ports))
+	for _, vip := range vips {
+		for _, servicePort := range service.Spec.Ports {
+			targets = append(targets, conntrack.VIPTarget(vip, uint16(servicePort.Port), protocolNumber(servicePort.Protocol)))
+		}
+	}
+	return targets
+}
+
+// vipTargetKey returns a key (IP, port and protocol) to compare targets.
+func vipTargetKey(target conntrack.Target) string {
+	return fmt.Sprintf("%s|%d|%d", target.IP, target.Port, target.Protocol)
+}
+
+// protocolNumber returns the IP protocol number of a ServicePort protocol.
+func protocolNumber(protocol corev1.Protocol) uint8 {
+	switch protocol {
+	case corev1.ProtocolUDP:
+		return syscall.IPPROTO_UDP
+	case corev1.ProtocolSCTP:
+		return syscall.IPPROTO_SCTP
+	}
+	return syscall.IPPROTO_TCP
+}
+
+// addressProtocolNumber returns the IP protocol number of a nftlb address protocol, 0 matches every protocol.
+func addressProtocolNumber(protocol types.Protocol) uint8 {
+	switch protocol {
+	case types.ProtocolTCP:
+		return syscall.IPPROTO_TCP
+	case types.ProtocolUDP:
+		return syscall.IPPROTO_UDP
+	case types.ProtocolSCTP:
+		return syscall.IPPROTO_SCTP
+	}
+	return 0
+}
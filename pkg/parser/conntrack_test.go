@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/conntrack"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVipTargets(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "dns", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Type:        corev1.ServiceTypeLoadBalancer,
+			ClusterIP:   "10.96.0.10",
+			ExternalIPs: []string{"192.168.1.10"},
+			Ports: []corev1.ServicePort{
+				{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP},
+				{Name: "dns-tcp", Port: 53, Protocol: corev1.ProtocolTCP},
+			},
+		},
+		Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+			Ingress: []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}},
+		}},
+	}
+
+	want := []conntrack.Target{
+		conntrack.VIPTarget("192.168.1.10", 53, syscall.IPPROTO_UDP),
+		conntrack.VIPTarget("192.168.1.10", 53, syscall.IPPROTO_TCP),
+		conntrack.VIPTarget("203.0.113.10", 53, syscall.IPPROTO_UDP),
+		conntrack.VIPTarget("203.0.113.10", 53, syscall.IPPROTO_TCP),
+		conntrack.VIPTarget("10.96.0.10", 53, syscall.IPPROTO_UDP),
+		conntrack.VIPTarget("10.96.0.10", 53, syscall.IPPROTO_TCP),
+	}
+	got := vipTargets(service)
+	if len(got) != len(want) {
+		t.Fatalf("got %d targets, want %d", len(got), len(want))
+	}
+	for index := range want {
+		if vipTargetKey(got[index]) != vipTargetKey(want[index]) {
+			t.Errorf("target %d: got %s, want %s", index, vipTargetKey(got[index]), vipTargetKey(want[index]))
+		}
+	}
+
+	// Headless Services don't have a ClusterIP to clean
+	service.Spec.ClusterIP = corev1.ClusterIPNone
+	for _, target := range vipTargets(service) {
+		if target.IP.Equal(net.ParseIP("10.96.0.10")) {
+			t.Errorf("headless Service: got target %s", vipTargetKey(target))
+		}
+	}
+}
+
+func TestProtocolNumber(t *testing.T) {
+	tests := []struct {
+		protocol corev1.Protocol
+		want     uint8
+	}{
+		{corev1.ProtocolTCP, syscall.IPPROTO_TCP},
+		{corev1.ProtocolUDP, syscall.IPPROTO_UDP},
+		{corev1.ProtocolSCTP, syscall.IPPROTO_SCTP},
+		{"", syscall.IPPROTO_TCP},
+	}
+
+	for _, test := range tests {
+		if got := protocolNumber(test.protocol); got != test.want {
+			t.Errorf("%q: got %d, want %d", test.protocol, got, test.want)
+		}
+	}
+}
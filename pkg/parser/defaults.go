@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/zevenet/kube-nftlb/pkg/events"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/processor"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	defaultsMutex sync.RWMutex
+
+	// Map [setting] to { value }, read from the defaults ConfigMap
+	clusterDefaults = make(map[string]string)
+
+	// Map [namespace name] to [setting] to { value }, read from Namespace annotations
+	namespaceDefaults = make(map[string]map[string]string)
+)
+
+// SetClusterDefaults reads default settings for every Service from a ConfigMap (nil if it doesn't exist).
+// It returns true if the defaults have changed.
+func SetClusterDefaults(configMap *corev1.ConfigMap) bool {
+	defaults := make(map[string]string)
+	if configMap != nil {
+		defaults = validDefaults(configMap, configMap.Data, field.NewPath("data"))
+	}
+
+	defaultsMutex.Lock()
+	defer defaultsMutex.Unlock()
+
+	changed := !reflect.DeepEqual(clusterDefaults, defaults)
+	clusterDefaults = defaults
+	return changed
+}
+
+// SetNamespaceDefaults reads default settings for every Service in a Namespace from its annotations.
+// It returns true if the defaults have changed.
+func SetNamespaceDefaults(namespace *corev1.Namespace) bool {
+	settings := make(map[string]string)
+	for key, value := range namespace.Annotations {
+		if validation.IsServiceAnnotation(key) {
+			settings[strings.TrimPrefix(key, validation.ServiceAnnotationPrefix)] = value
+		}
+	}
+	defaults := validDefaults(namespace, settings, field.NewPath("metadata", "annotations"))
+
+	defaultsMutex.Lock()
+	defer defaultsMutex.Unlock()
+
+	oldDefaults := namespaceDefaults[namespace.Name]
+	changed := len(oldDefaults) != len(defaults) || (len(defaults) > 0 && !reflect.DeepEqual(oldDefaults, defaults))
+	if len(defaults) == 0 {
+		delete(namespaceDefaults, namespace.Name)
+	} else {
+		namespaceDefaults[namespace.Name] = defaults
+	}
+	return changed
+}
+
+// DeleteNamespaceDefaults forgets default settings of a deleted Namespace.
+func DeleteNamespaceDefaults(namespace *corev1.Namespace) {
+	defaultsMutex.Lock()
+	defer defaultsMutex.Unlock()
+
+	delete(namespaceDefaults, namespace.Name)
+}
+
+// serviceDefaults returns default settings for a Service: namespace defaults override cluster defaults, and both
+// override built-in defaults (given by annotation processors).
+func serviceDefaults(service *corev1.Service) map[string]string {
+	defaultsMutex.RLock()
+	defer defaultsMutex.RUnlock()
+
+	defaults := processor.Defaults()
+	for _, settings := range []map[string]string{clusterDefaults, namespaceDefaults[service.Namespace]} {
+		for name, value := range settings {
+			defaults[name] = value
+		}
+	}
+	return defaults
+}
+
+// validDefaults returns every valid setting. Invalid settings are reported as Warning Events of the object where
+// they were found.
+func validDefaults(obj runtime.Object, settings map[string]string, fldPath *field.Path) map[string]string {
+	defaults := make(map[string]string)
+	for name, value := range settings {
+		if errs := validation.Setting(name, value, fldPath); len(errs) > 0 {
+			log.WriteLog(types.ErrorLog, fmt.Sprintf("validDefaults: %s", errs.ToAggregate().Error()))
+			events.Warning(obj, "InvalidDefault", fmt.Sprintf("%s, the value will be ignored", errs.ToAggregate().Error()))
+			continue
+		}
+		defaults[name] = value
+	}
+	return defaults
+}
@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServiceDefaultsPrecedence(t *testing.T) {
+	tests := []struct {
+		name        string
+		cluster     map[string]string
+		namespace   map[string]string
+		annotations map[string]string
+		want        map[string]string // scheduler and est-connlimit
+	}{
+		{
+			name: "built-in defaults",
+			want: map[string]string{"scheduler": "rr", "est-connlimit": ""},
+		},
+		{
+			name:    "cluster defaults override built-in defaults",
+			cluster: map[string]string{"scheduler": "weight", "est-connlimit": "10"},
+			want:    map[string]string{"scheduler": "weight", "est-connlimit": "10"},
+		},
+		{
+			name:      "namespace defaults override cluster defaults",
+			cluster:   map[string]string{"scheduler": "weight", "est-connlimit": "10"},
+			namespace: map[string]string{"scheduler": "hash"},
+			want:      map[string]string{"scheduler": "hash", "est-connlimit": "10"},
+		},
+		{
+			name:        "annotations override namespace defaults",
+			cluster:     map[string]string{"scheduler": "weight", "est-connlimit": "10"},
+			namespace:   map[string]string{"scheduler": "hash", "est-connlimit": "20"},
+			annotations: map[string]string{"scheduler": "symhash"},
+			want:        map[string]string{"scheduler": "symhash", "est-connlimit": "20"},
+		},
+		{
+			name:      "invalid defaults are ignored",
+			cluster:   map[string]string{"scheduler": "weight"},
+			namespace: map[string]string{"scheduler": "fastest", "est-connlimit": "many"},
+			want:      map[string]string{"scheduler": "weight", "est-connlimit": ""},
+		},
+	}
+
+	prefixed := func(settings map[string]string) map[string]string {
+		annotations := make(map[string]string, len(settings))
+		for name, value := range settings {
+			annotations[validation.ServiceAnnotationPrefix+name] = value
+		}
+		return annotations
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			SetClusterDefaults(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "kube-nftlb-defaults"},
+				Data:       test.cluster,
+			})
+			SetNamespaceDefaults(&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Annotations: prefixed(test.namespace)},
+			})
+			defer func() {
+				SetClusterDefaults(nil)
+				DeleteNamespaceDefaults(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "web"}})
+			}()
+
+			annotations := getAnnotations(&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "front", Annotations: prefixed(test.annotations)},
+				Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP},
+			})
+			got := map[string]string{"scheduler": annotations.Settings["scheduler"], "est-connlimit": annotations.Settings["est-connlimit"]}
+			if got["scheduler"] != test.want["scheduler"] || got["est-connlimit"] != test.want["est-connlimit"] {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	// Services in other namespaces don't read the defaults of a namespace
+	SetNamespaceDefaults(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Annotations: prefixed(map[string]string{"scheduler": "hash"})},
+	})
+	defer DeleteNamespaceDefaults(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "web"}})
+	if defaults := serviceDefaults(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default"}}); defaults["scheduler"] != "rr" {
+		t.Fatalf("got scheduler %s in another namespace, want rr", defaults["scheduler"])
+	}
+}
+
+func TestServiceDefaultsHealthCheckTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		cluster     map[string]string
+		namespace   map[string]string
+		annotations map[string]string
+		want        [2]string // interval and timeout
+	}{
+		{
+			name:        "timeout shorter than the namespace interval",
+			namespace:   map[string]string{"health-check-interval": "20s"},
+			annotations: map[string]string{"health-check-timeout": "15s"},
+			want:        [2]string{"20s", "15s"},
+		},
+		{
+			name:        "timeout longer than the built-in interval",
+			annotations: map[string]string{"health-check-timeout": "15s"},
+			want:        [2]string{"10s", "2s"},
+		},
+		{
+			name:        "interval shorter than the cluster timeout",
+			cluster:     map[string]string{"health-check-timeout": "5s"},
+			annotations: map[string]string{"health-check-interval": "4s"},
+			want:        [2]string{"10s", "2s"},
+		},
+	}
+
+	prefixed := func(settings map[string]string) map[string]string {
+		annotations := make(map[string]string, len(settings))
+		for name, value := range settings {
+			annotations[validation.ServiceAnnotationPrefix+name] = value
+		}
+		return annotations
+	}
+
+	// The timeout is compared to the interval once defaults are applied, default values are used if it isn't shorter
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			SetClusterDefaults(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "kube-nftlb-defaults"},
+				Data:       test.cluster,
+			})
+			SetNamespaceDefaults(&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Annotations: prefixed(test.namespace)},
+			})
+			defer func() {
+				SetClusterDefaults(nil)
+				DeleteNamespaceDefaults(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "web"}})
+			}()
+
+			annotations := getAnnotations(&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "front", Annotations: prefixed(test.annotations)},
+				Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP},
+			})
+			got := [2]string{annotations.Settings["health-check-interval"], annotations.Settings["health-check-timeout"]}
+			if got != test.want {
+				t.Fatalf("got interval and timeout %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package parser
+
+import (
+	"sort"
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/conntrack"
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Results of a drain
+const (
+	DrainDrained   = "drained"
+	DrainTimeout   = "timeout"
+	DrainCancelled = "cancelled"
+)
+
+// drain is a backend made for a Pod that has left its Endpoints, it's kept off while it drains.
+type drain struct {
+	endpoints string // Endpoints (namespace/name)
+	backend   types.Backend
+	start     time.Time
+}
+
+// Drain is a backend that is draining, as read by the controller.
+type Drain struct {
+	Farm      string
+	Backend   string
+	IP        string
+	Port      uint16          // 0 for backends of compact farms
+	Endpoints string          // Endpoints (namespace/name)
+	VIPs      []conntrack.VIP // VIPs of its farm
+	Expired   bool            // Its drain timeout has expired
+}
+
+var (
+	// Map [farm (name)] to { drain timeout }, only for farms with drain
+	drainTimeoutPerFarm = make(map[string]time.Duration)
+
+	// Map [farm (name)] to [backend (name)] to { drain }
+	drains = make(map[string]map[string]drain)
+)
+
+// Drains returns every backend that is draining, sorted by farm and backend.
+func Drains() []Drain {
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	list := make([]Drain, 0)
+	for farmName, backendDrains := range drains {
+		for backendName, drain := range backendDrains {
+			item := Drain{
+				Farm:      farmName,
+				Backend:   backendName,
+				IP:        drain.backend.IPAddr,
+				Endpoints: drain.endpoints,
+				VIPs:      vipsPerFarm[farmName],
+				Expired:   Clock.Since(drain.start) >= drainTimeoutPerFarm[farmName],
+			}
+			if drain.backend.Port != nil {
+				item.Port = uint16(*drain.backend.Port)
+			}
+			list = append(list, item)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Farm != list[j].Farm {
+			return list[i].Farm < list[j].Farm
+		}
+		return list[i].Backend < list[j].Backend
+	})
+	return list
+}
+
+// FinishDrain ends the drain of a backend, it's deleted the next time its Endpoints are applied. It returns false if
+// the backend wasn't draining anymore.
+func FinishDrain(farmName string, backendName string, result string) bool {
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	if _, ok := drains[farmName][backendName]; !ok {
+		return false
+	}
+	stopDrainLocked(farmName, backendName, result)
+	return true
+}
+
+// setDrainTimeout keeps the drain timeout of a farm. Backends that are draining keep their drain.
+func setDrainTimeout(farmName string, drainTimeout string) {
+	duration, _ := time.ParseDuration(drainTimeout)
+
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	if duration <= 0 {
+		delete(drainTimeoutPerFarm, farmName)
+		return
+	}
+	drainTimeoutPerFarm[farmName] = duration
+}
+
+// hasDrainTimeout returns true if backends of a farm drain when they leave.
+func hasDrainTimeout(farmName string) bool {
+	podsMutex.RLock()
+	defer podsMutex.RUnlock()
+
+	_, ok := drainTimeoutPerFarm[farmName]
+	return ok
+}
+
+// hasDrains returns true if a farm has backends that are draining.
+func hasDrains(farmName string) bool {
+	podsMutex.RLock()
+	defer podsMutex.RUnlock()
+
+	return len(drains[farmName]) > 0
+}
+
+// startDrainLocked begins the drain of a backend that has left if its farm has a drain timeout. It returns false if
+// the farm doesn't have a drain timeout.
+func startDrainLocked(farmName string, endpointsKey string, backend types.Backend) bool {
+	if _, ok := drainTimeoutPerFarm[farmName]; !ok {
+		return false
+	}
+
+	if _, ok := drains[farmName]; !ok {
+		drains[farmName] = make(map[string]drain)
+	}
+	drains[farmName][backend.Name] = drain{
+		endpoints: endpointsKey,
+		backend:   backend,
+		start:     Clock.Now(),
+	}
+	metrics.BackendsDraining.WithLabelValues(farmName, backend.Name).Set(0)
+	return true
+}
+
+// stopDrainLocked ends the drain of a backend (for example, when its Pod comes back). An empty result isn't counted.
+// Conntrack entries of the backend are deleted unless it's cancelled.
+func stopDrainLocked(farmName string, backendName string, result string) {
+	drain, ok := drains[farmName][backendName]
+	if !ok {
+		return
+	}
+	if result != DrainCancelled {
+		cleanBackend(farmName, drain.backend)
+	}
+
+	delete(drains[farmName], backendName)
+	if len(drains[farmName]) == 0 {
+		delete(drains, farmName)
+	}
+	metrics.BackendsDraining.DeleteLabelValues(farmName, backendName)
+	if result != "" {
+		metrics.BackendsDrainsTotal.WithLabelValues(farmName, result).Inc()
+	}
+}
+
+// isDrainingLocked returns true if a backend is draining.
+func isDrainingLocked(farmName string, backendName string) bool {
+	_, ok := drains[farmName][backendName]
+	return ok
+}
+
+// drainingAsNftlb adds every backend that is draining to its farm with the state off, so it doesn't get new
+// connections and it isn't deleted as a stale backend. Backends of farms that have lost every EndpointPort begin their
+// drain too.
+func drainingAsNftlb(endpoints *corev1.Endpoints, nftlb *types.Nftlb) {
+	farms := make(map[string]bool)
+	for _, farm := range nftlb.Farms {
+		farms[farm.Name] = true
+	}
+	for _, farmName := range farmsPerService[endpoints.Name] {
+		if farms[farmName] || !hasDrainTimeout(farmName) {
+			continue
+		}
+
+		setPodBackends(farmName, podKey(endpoints.Namespace, endpoints.Name), []podBackend{})
+		if hasDrains(farmName) {
+			nftlb.Farms = append(nftlb.Farms, types.Farm{Name: farmName})
+			backendsPerFarm[farmName] = make([]string, 0)
+		}
+	}
+
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	for index := range nftlb.Farms {
+		farm := &nftlb.Farms[index]
+		backendDrains, ok := drains[farm.Name]
+		if !ok {
+			continue
+		}
+
+		backends := make(map[string]bool)
+		for _, backend := range farm.Backends {
+			backends[backend.Name] = true
+		}
+
+		names := make([]string, 0, len(backendDrains))
+		for backendName := range backendDrains {
+			names = append(names, backendName)
+		}
+		sort.Strings(names)
+
+		for _, backendName := range names {
+			if backends[backendName] {
+				continue
+			}
+
+			backend := backendDrains[backendName].backend
+			backend.State = types.StateOff
+			farm.Backends = append(farm.Backends, backend)
+			backendsPerFarm[farm.Name] = append(backendsPerFarm[farm.Name], backend.Name)
+		}
+	}
+}
+
+// SetDrainConnections exports how many connections a draining backend still has.
+func SetDrainConnections(farmName string, backendName string, connections int) {
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	if isDrainingLocked(farmName, backendName) {
+		metrics.BackendsDraining.WithLabelValues(farmName, backendName).Set(float64(connections))
+	}
+}
@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestDrain(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	oldClock := Clock
+	Clock = fakeClock
+	defer func() { Clock = oldClock }()
+
+	farmName := "web--http"
+	setDrainTimeout(farmName, "30s")
+	defer setDrainTimeout(farmName, "0s")
+	defer deletePodBackends(farmName)
+
+	backend := func(name string) podBackend {
+		return podBackend{pod: "default/" + name, backend: types.Backend{Name: name, IPAddr: "10.1.0.1", Port: types.NewPort(8080)}}
+	}
+	setPodBackends(farmName, "default/web", []podBackend{backend("web-0"), backend("web-1")})
+
+	// Backends that leave begin their drain
+	setPodBackends(farmName, "default/web", []podBackend{backend("web-0")})
+	drains := Drains()
+	if len(drains) != 1 || drains[0].Backend != "web-1" || drains[0].Port != 8080 || drains[0].Endpoints != "default/web" || drains[0].Expired {
+		t.Fatalf("got drains %+v, want web-1 draining", drains)
+	}
+
+	// They're kept off in their farm, so they don't get new connections
+	nftlb := &types.Nftlb{Farms: []types.Farm{{Name: farmName, Backends: []types.Backend{{Name: "web-0"}}}}}
+	drainingAsNftlb(&corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}, nftlb)
+	if backends := nftlb.Farms[0].Backends; len(backends) != 2 || backends[1].Name != "web-1" || backends[1].State != types.StateOff {
+		t.Fatalf("got backends %+v, want web-1 off", backends)
+	}
+
+	fakeClock.Step(30 * time.Second)
+	if drains := Drains(); len(drains) != 1 || !drains[0].Expired {
+		t.Fatalf("got drains %+v, want the drain timeout of web-1 expired", drains)
+	}
+	if !FinishDrain(farmName, "web-1", DrainTimeout) || FinishDrain(farmName, "web-1", DrainTimeout) {
+		t.Fatal("got the drain of web-1 finished twice, want once")
+	}
+
+	// Backends that come back while they're draining never left
+	setPodBackends(farmName, "default/web", []podBackend{})
+	setPodBackends(farmName, "default/web", []podBackend{backend("web-0")})
+	if drains := Drains(); len(drains) != 0 {
+		t.Fatalf("got drains %+v, want none", drains)
+	}
+
+	// Farms without drain timeout delete backends that leave
+	setDrainTimeout(farmName, "0s")
+	setPodBackends(farmName, "default/web", []podBackend{})
+	if drains := Drains(); len(drains) != 0 {
+		t.Fatalf("got drains %+v, want none", drains)
+	}
+}
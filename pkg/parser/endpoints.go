@@ -10,12 +10,59 @@ import (
 )
 
 // EndpointsAsPaths sends backend paths through a channel to the controller. The controller then deletes every backend.
+// Backends aren't drained here: Endpoints are deleted with their Service, whose farms are deleted too, so there's no
+// farm left to keep them off in. Backends that were draining end their drain.
 func EndpointsAsPaths(endpoints *corev1.Endpoints, pathsChan chan<- string) {
 	for _, farmName := range farmsPerService[endpoints.Name] {
 		for _, backendName := range backendsPerFarm[farmName] {
 			pathsChan <- fmt.Sprintf("farms/%s/backends/%s", farmName, backendName)
 		}
 		delete(backendsPerFarm, farmName)
+		deletePodBackends(farmName)
+		deleteEndpointsState(farmName)
+	}
+	deleteEndpointsReadiness(endpoints)
+
+	close(pathsChan)
+}
+
+// BackendsPerEndpoints returns a copy of the backend names of every farm made for an Endpoints object.
+func BackendsPerEndpoints(endpoints *corev1.Endpoints) map[string][]string {
+	backends := make(map[string][]string)
+	for _, farmName := range farmsPerService[endpoints.Name] {
+		if backendNames, ok := backendsPerFarm[farmName]; ok {
+			backends[farmName] = append([]string{}, backendNames...)
+		}
+	}
+	return backends
+}
+
+// StaleBackendsAsPaths sends paths of backends found in oldBackends (see BackendsPerEndpoints) that aren't in the
+// updated Nftlb struct through a channel to the controller. The controller then deletes every backend.
+func StaleBackendsAsPaths(oldBackends map[string][]string, nftlb *types.Nftlb, pathsChan chan<- string) {
+	// Map [farm (name)] to [backend (name)] to { exists }
+	newBackends := make(map[string]map[string]bool)
+	for _, farm := range nftlb.Farms {
+		if newBackends[farm.Name] == nil {
+			newBackends[farm.Name] = make(map[string]bool)
+		}
+		for _, backend := range farm.Backends {
+			newBackends[farm.Name][backend.Name] = true
+		}
+	}
+
+	for farmName, backendNames := range oldBackends {
+		for _, backendName := range backendNames {
+			if !newBackends[farmName][backendName] {
+				pathsChan <- fmt.Sprintf("farms/%s/backends/%s", farmName, backendName)
+			}
+		}
+
+		// Remove from memory backends of farms without EndpointPort
+		if _, ok := newBackends[farmName]; !ok {
+			delete(backendsPerFarm, farmName)
+			deletePodBackends(farmName)
+		}
 	}
 
 	close(pathsChan)
@@ -27,14 +74,55 @@ func EndpointsAsNftlb(endpoints *corev1.Endpoints) *types.Nftlb {
 		Farms: make([]types.Farm, 0),
 	}
 
+	// Gated Pods with ready containers are backends before they're Ready
+	endpoints = withGatedAddresses(endpoints)
+
+	// Backends aren't programmed without farms, and gated Pods are reported because this node doesn't program them
+	if serviceSkipped(podKey(endpoints.Namespace, endpoints.Name)) {
+		SetEndpointsProgrammed(endpoints)
+		return nftlb
+	}
+
+	// 1 compact Service (k8s) = 1 Farm (nftlb)
+	if compact, ok := compactFarmPerService[endpoints.Name]; ok {
+		nftlb.Farms = append(nftlb.Farms, endpointsAsCompactFarm(endpoints, compact))
+		trafficSplitAsNftlb(endpoints, nftlb)
+		noEndpointsAsNftlb(endpoints, nftlb)
+		drainingAsNftlb(endpoints, nftlb)
+		return nftlb
+	}
+
+	skippedFarms := false
+
+	// Map [farm (name)] to { index in nftlb.Farms }, subsets with the same port name (for example, while a rollout
+	// changes the targetPort) are backends of the same farm
+	farmIndexes := make(map[string]int)
+
+	// Map [farm (name)] to []{ backends made for Pods in every subset }
+	podBackends := make(map[string][]podBackend)
+
 	for idxSubset, subset := range endpoints.Subsets {
 		// 1 EndpointPort (k8s) = 1 Farm (nftlb)
 		for idxPort, port := range subset.Ports {
-			farm := types.Farm{
-				Name:     FormatName(endpoints.Name, port.Name),
-				Backends: make([]types.Backend, len(subset.Addresses)),
+			farmName := FormatName(endpoints.Name, port.Name)
+
+			// Farms of ServicePorts with their own node selector can be skipped
+			if farmSkipped(farmName) {
+				skippedFarms = true
+				continue
 			}
-			backendsPerFarm[farm.Name] = make([]string, len(subset.Addresses))
+
+			index, ok := farmIndexes[farmName]
+			if !ok {
+				index = len(nftlb.Farms)
+				farmIndexes[farmName] = index
+				nftlb.Farms = append(nftlb.Farms, types.Farm{
+					Name:     farmName,
+					Backends: make([]types.Backend, 0, len(subset.Addresses)),
+				})
+				backendsPerFarm[farmName] = make([]string, 0, len(subset.Addresses))
+			}
+			backends := make([]types.Backend, len(subset.Addresses))
 
 			// Add a lock for every EndpointAddress
 			wg := new(sync.WaitGroup)
@@ -47,8 +135,8 @@ func EndpointsAsNftlb(endpoints *corev1.Endpoints) *types.Nftlb {
 
 					backend := types.Backend{
 						IPAddr: epAddress.IP,
-						State:  "up",
-						Port:   fmt.Sprint(epPort.Port),
+						State:  types.StateUp,
+						Port:   types.NewPort(uint16(epPort.Port)),
 					}
 
 					if epAddress.TargetRef != nil {
@@ -57,18 +145,40 @@ func EndpointsAsNftlb(endpoints *corev1.Endpoints) *types.Nftlb {
 						backend.Name = FormatName(endpoints.Name, epPort.Name)
 					}
 
-					farm.Backends[idxAddress] = backend
-					backendsPerFarm[farm.Name][idxAddress] = backend.Name
+					backends[idxAddress] = backend
 				}(&endpoints.Subsets[idxSubset].Ports[idxPort], &endpoints.Subsets[idxSubset].Addresses[idxAddress], idxAddress)
 			}
 
 			// Wait until all EndpointPort locks are released
 			wg.Wait()
 
-			nftlb.Farms = append(nftlb.Farms, farm)
+			podBackends[farmName] = append(podBackends[farmName], trackPodBackends(backends, subset.Addresses, endpoints.Namespace)...)
+			nftlb.Farms[index].Backends = append(nftlb.Farms[index].Backends, backends...)
+			for _, backend := range backends {
+				backendsPerFarm[farmName] = append(backendsPerFarm[farmName], backend.Name)
+			}
 		}
 	}
 
+	// Apply settings read from Pod annotations, once every subset is read so backends of the other subsets aren't
+	// seen as backends that have left
+	for index := range nftlb.Farms {
+		farm := &nftlb.Farms[index]
+		setPodBackends(farm.Name, podKey(endpoints.Namespace, endpoints.Name), podBackends[farm.Name])
+		applyPodSettings(farm.Name, farm.Backends)
+	}
+
+	// Farms of a TrafficSplit root get the endpoints of its backend Services, and then farms without endpoints use their
+	// fallback Service or reject traffic (if they must). Backends that are draining are kept off
+	trafficSplitAsNftlb(endpoints, nftlb)
+	noEndpointsAsNftlb(endpoints, nftlb)
+	drainingAsNftlb(endpoints, nftlb)
+
+	// Gated Pods are reported if every farm is skipped, as there's nothing to program
+	if skippedFarms && len(nftlb.Farms) == 0 {
+		SetEndpointsProgrammed(endpoints)
+	}
+
 	// Return a filled Nftlb struct
 	return nftlb
 }
@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newRolloutEndpoints returns Endpoints with 2 subsets that share the port name http (with other targetPorts), like
+// the Endpoints of a Deployment while a rollout changes its targetPort.
+func newRolloutEndpoints(name string) *corev1.Endpoints {
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{{IP: "10.1.0.1", TargetRef: &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "old-0"}}},
+				Ports:     []corev1.EndpointPort{{Name: "http", Port: 8080}},
+			},
+			{
+				Addresses: []corev1.EndpointAddress{{IP: "10.1.0.2", TargetRef: &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "new-0"}}},
+				Ports:     []corev1.EndpointPort{{Name: "http", Port: 9090}},
+			},
+		},
+	}
+}
+
+func TestEndpointsAsNftlbSubsetsWithTheSamePort(t *testing.T) {
+	farmsPerService["web"] = []string{"web--http"}
+	defer delete(farmsPerService, "web")
+	defer deletePodBackends("web--http")
+	defer delete(backendsPerFarm, "web--http")
+
+	// Subsets with the same port name are backends of 1 farm
+	endpoints := newRolloutEndpoints("web")
+	nftlb := EndpointsAsNftlb(endpoints)
+	if len(nftlb.Farms) != 1 || len(nftlb.Farms[0].Backends) != 2 {
+		t.Fatalf("got farms %+v, want 1 farm with 2 backends", nftlb.Farms)
+	}
+	for index, want := range []string{"old-0--http", "new-0--http"} {
+		if backend := nftlb.Farms[0].Backends[index]; backend.Name != want {
+			t.Fatalf("got backend %d %s, want %s", index, backend.Name, want)
+		}
+	}
+	if backendNames := backendsPerFarm["web--http"]; len(backendNames) != 2 {
+		t.Fatalf("got backends %v, want old-0--http and new-0--http", backendNames)
+	}
+
+	// Applying them again doesn't delete any of them
+	oldBackends := BackendsPerEndpoints(endpoints)
+	nftlb = EndpointsAsNftlb(endpoints)
+	pathsChan := make(chan string)
+	go StaleBackendsAsPaths(oldBackends, nftlb, pathsChan)
+	for path := range pathsChan {
+		t.Errorf("got stale backend %s, want none", path)
+	}
+
+	// Every backend is deleted with its Endpoints
+	pathsChan = make(chan string)
+	go EndpointsAsPaths(endpoints, pathsChan)
+	paths := make([]string, 0)
+	for path := range pathsChan {
+		paths = append(paths, path)
+	}
+	if len(paths) != 2 || paths[0] != "farms/web--http/backends/old-0--http" || paths[1] != "farms/web--http/backends/new-0--http" {
+		t.Fatalf("got paths %v, want both backends", paths)
+	}
+}
+
+func TestEndpointsAsNftlbSubsetsDontDrain(t *testing.T) {
+	farmsPerService["web"] = []string{"web--http"}
+	defer delete(farmsPerService, "web")
+	setDrainTimeout("web--http", "30s")
+	defer setDrainTimeout("web--http", "0s")
+	defer deletePodBackends("web--http")
+	defer delete(backendsPerFarm, "web--http")
+
+	// Backends of every subset are kept, none of them has left
+	for i := 0; i < 2; i++ {
+		EndpointsAsNftlb(newRolloutEndpoints("web"))
+		if drains := Drains(); len(drains) != 0 {
+			t.Fatalf("pass %d: got drains %+v, want none", i, drains)
+		}
+		if podBackends := podBackendsPerFarm["web--http"]; len(podBackends) != 2 {
+			t.Fatalf("pass %d: got Pod backends %+v, want old-0--http and new-0--http", i, podBackends)
+		}
+	}
+}
+
+func TestEndpointsAsPathsDoesntDrain(t *testing.T) {
+	farmsPerService["web"] = []string{"web--http"}
+	defer delete(farmsPerService, "web")
+	setDrainTimeout("web--http", "30s")
+	defer setDrainTimeout("web--http", "0s")
+	defer deletePodBackends("web--http")
+	defer delete(backendsPerFarm, "web--http")
+
+	// The old Pod leaves and begins its drain
+	endpoints := newRolloutEndpoints("web")
+	EndpointsAsNftlb(endpoints)
+	endpoints.Subsets = endpoints.Subsets[1:]
+	EndpointsAsNftlb(endpoints)
+	if drains := Drains(); len(drains) != 1 || drains[0].Backend != "old-0--http" {
+		t.Fatalf("got drains %+v, want old-0--http draining", drains)
+	}
+
+	// Endpoints are deleted with their Service, so every backend is deleted at once (draining or not)
+	pathsChan := make(chan string)
+	go EndpointsAsPaths(endpoints, pathsChan)
+	paths := make([]string, 0)
+	for path := range pathsChan {
+		paths = append(paths, path)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("got paths %v, want new-0--http and old-0--http", paths)
+	}
+	if drains := Drains(); len(drains) != 0 {
+		t.Fatalf("got drains %+v, want none", drains)
+	}
+}
@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/health"
+	"github.com/zevenet/kube-nftlb/pkg/processor"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+)
+
+// HealthChecker probes backends of farms with a health check, its changes are read by the controller.
+var HealthChecker = health.NewChecker()
+
+// HealthAsNftlb returns a Nftlb struct with the backend whose health has changed and its current settings.
+func HealthAsNftlb(change health.Change) *types.Nftlb {
+	return podBackendsAsNftlb(func(farmName string, podBackend podBackend) bool {
+		return farmName == change.Group && podBackend.backend.Name == change.Target
+	})
+}
+
+// setHealthCheck keeps the health check of a farm. Its backends aren't probed if it's "none" or health checks are
+// disabled in this node.
+func setHealthCheck(farmName string, annotations *types.Annotations) {
+	settings := annotations.Settings
+	checkType := settings[processor.HealthCheckSetting]
+	if !config.HealthChecks || checkType == "" || checkType == "none" {
+		HealthChecker.SetCheck(farmName, nil)
+		return
+	}
+
+	// Every value was checked with the annotations
+	check := &health.Check{Type: checkType}
+	check.Interval, _ = time.ParseDuration(settings[processor.HealthCheckIntervalSetting])
+	check.Timeout, _ = time.ParseDuration(settings[processor.HealthCheckTimeoutSetting])
+	check.HealthyThreshold, _ = strconv.Atoi(settings[processor.HealthCheckHealthyThresholdSetting])
+	check.UnhealthyThreshold, _ = strconv.Atoi(settings[processor.HealthCheckUnhealthyThresholdSetting])
+	if port, err := strconv.ParseUint(settings[processor.HealthCheckPortSetting], 10, 16); err == nil {
+		check.Port = uint16(port)
+	}
+	if checkType == health.TypeHTTP {
+		check.HTTPPath = settings[processor.HealthCheckHTTPPathSetting]
+		check.HTTPStatusMin, check.HTTPStatusMax, _ = validation.ParseHTTPStatus(settings[processor.HealthCheckHTTPStatusSetting])
+	}
+
+	HealthChecker.SetCheck(farmName, check)
+}
+
+// setHealthTargets sets backends made for Pods as the targets of the health check of a farm. Backends without a port
+// (compact farms) are only probed if the health check has a port.
+func setHealthTargets(farmName string, podBackends []podBackend) {
+	targets := make([]health.Target, 0, len(podBackends))
+	for _, podBackend := range podBackends {
+		target := health.Target{
+			Name: podBackend.backend.Name,
+			IP:   podBackend.backend.IPAddr,
+		}
+		if podBackend.backend.Port != nil {
+			target.Port = uint16(*podBackend.backend.Port)
+		}
+		targets = append(targets, target)
+	}
+	HealthChecker.SetTargets(farmName, targets)
+}
+
+// applyHealth sets a backend down while its health check fails. Backends set off by Pod annotations stay off.
+func applyHealth(farmName string, backend *types.Backend) {
+	if backend.State == types.StateUp && !HealthChecker.Healthy(farmName, backend.Name) {
+		backend.State = types.StateDown
+	}
+}
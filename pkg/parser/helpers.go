@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// defaultHelpersMap maps appProtocols, port names and well-known ports ("port/protocol") to nftlb helpers.
+// It can be replaced with CLIENT_HELPERS_MAP, using the same format.
+const defaultHelpersMap = "ftp=ftp,21/tcp=ftp," +
+	"sip=sip,5060/udp=sip,5060/tcp=sip," +
+	"tftp=tftp,69/udp=tftp," +
+	"amanda=amanda,10080/udp=amanda," +
+	"h323=h323,1720/tcp=h323," +
+	"irc=irc,6667/tcp=irc," +
+	"netbios-ns=netbios-ns,137/udp=netbios-ns," +
+	"pptp=pptp,1723/tcp=pptp," +
+	"sane=sane,6566/tcp=sane," +
+	"snmp=snmp,161/udp=snmp"
+
+// Map [appProtocol, port name or "port/protocol"] to { helper }
+var helpersMap = parseHelpersMap(config.HelpersMap)
+
+// findHelper returns the helper for a ServicePort. It's looked up by its appProtocol, its name (only if
+// CLIENT_HELPERS_BY_PORT_NAME is enabled) and its port, in that order. If nothing matches, it returns "none".
+func findHelper(servicePort *corev1.ServicePort) string {
+	// appProtocol
+	if servicePort.AppProtocol != nil {
+		if helper, ok := helpersMap[strings.ToLower(*servicePort.AppProtocol)]; ok {
+			return helper
+		}
+	}
+
+	// Port name, it can be the helper itself or the helper followed by a suffix (example: "ftp" or "ftp-control").
+	// The longest key wins, so the result doesn't depend on the order of the map.
+	if config.HelpersByPortName && servicePort.Name != "" {
+		name := strings.ToLower(servicePort.Name)
+		longestKey := ""
+		for key := range helpersMap {
+			if len(key) > len(longestKey) && (name == key || strings.HasPrefix(name, key+"-")) {
+				longestKey = key
+			}
+		}
+		if longestKey != "" {
+			return helpersMap[longestKey]
+		}
+	}
+
+	// Well-known port
+	if helper, ok := helpersMap[fmt.Sprintf("%d/%s", servicePort.Port, strings.ToLower(string(servicePort.Protocol)))]; ok {
+		return helper
+	}
+
+	return "none"
+}
+
+// parseHelpersMap reads a "key=helper,key=helper" string. Stops the container if a helper isn't valid.
+func parseHelpersMap(mapping string) map[string]string {
+	if mapping == "" {
+		mapping = defaultHelpersMap
+	}
+
+	helpersMap := make(map[string]string)
+	for _, entry := range strings.Split(mapping, ",") {
+		keyValue := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(keyValue) != 2 || keyValue[0] == "" {
+			panic(fmt.Errorf("CLIENT_HELPERS_MAP: invalid entry %q", entry))
+		} else if errs := validation.Helper(keyValue[1], field.NewPath("CLIENT_HELPERS_MAP").Key(keyValue[0])); len(errs) > 0 {
+			panic(errs.ToAggregate())
+		}
+
+		helpersMap[strings.ToLower(keyValue[0])] = keyValue[1]
+	}
+
+	return helpersMap
+}
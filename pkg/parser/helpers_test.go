@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestFindHelperLongestPortName(t *testing.T) {
+	config.HelpersByPortName = true
+	defer func() { config.HelpersByPortName = false }()
+
+	oldHelpersMap := helpersMap
+	helpersMap = parseHelpersMap("sip=sip,sip-tls=tftp,ftp=ftp")
+	defer func() { helpersMap = oldHelpersMap }()
+
+	tests := []struct {
+		name   string
+		helper string
+	}{
+		{"sip", "sip"},
+		{"sip-udp", "sip"},
+		{"sip-tls", "tftp"},
+		{"sip-tls-1", "tftp"},
+		{"ftp-control", "ftp"},
+		{"ftpd", "none"},
+	}
+
+	for _, test := range tests {
+		// The result can't depend on the order of the map
+		for i := 0; i < 20; i++ {
+			servicePort := &corev1.ServicePort{Name: test.name, Port: 8080, Protocol: corev1.ProtocolTCP}
+			if helper := findHelper(servicePort); helper != test.helper {
+				t.Fatalf("port name %q: got helper %q, want %q", test.name, helper, test.helper)
+			}
+		}
+	}
+}
+
+func TestFindHelperOrder(t *testing.T) {
+	appProtocol := "ftp"
+	servicePort := &corev1.ServicePort{Name: "sip", Port: 69, Protocol: corev1.ProtocolUDP, AppProtocol: &appProtocol}
+	if helper := findHelper(servicePort); helper != "ftp" {
+		t.Fatalf("appProtocol: got helper %q, want %q", helper, "ftp")
+	}
+
+	servicePort.AppProtocol = nil
+	if helper := findHelper(servicePort); helper != "tftp" {
+		t.Fatalf("well-known port: got helper %q, want %q", helper, "tftp")
+	}
+}
+
+func TestParseHelpersMap(t *testing.T) {
+	helpersMap := parseHelpersMap("FTP=ftp, 21/tcp=ftp")
+	if len(helpersMap) != 2 || helpersMap["ftp"] != "ftp" || helpersMap["21/tcp"] != "ftp" {
+		t.Fatalf("got %v", helpersMap)
+	}
+
+	for _, mapping := range []string{"ftp", "=ftp", "ftp=unknown"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("mapping %q: want a panic", mapping)
+				}
+			}()
+			parseHelpersMap(mapping)
+		}()
+	}
+}
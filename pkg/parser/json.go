@@ -2,13 +2,25 @@ package parser
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 
+	"github.com/zevenet/kube-nftlb/pkg/log"
 	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
 )
 
 // NftlbAsJSON parses a given Nftlb struct and returns a JSON string that can be interpreted by nftlb.
+// Invalid objects are never sent to nftlb, they're logged and removed from the struct. An error is returned if
+// every object was invalid.
 func NftlbAsJSON(data *types.Nftlb) (string, error) {
+	if errs := validation.DropInvalid(data); len(errs) > 0 {
+		if len(data.Farms) == 0 && len(data.Addresses) == 0 && len(data.Policies) == 0 {
+			return "", errs.ToAggregate()
+		}
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("NftlbAsJSON: invalid objects aren't sent to nftlb\n%s", errs.ToAggregate().Error()))
+	}
+
 	indentedJSON, err := json.MarshalIndent(data, "", "\t")
 	if err != nil {
 		return "", err
@@ -1,12 +1,20 @@
 package parser
 
+import "github.com/zevenet/kube-nftlb/pkg/conntrack"
+
 var (
 	// Map [Service-Endpoints (name)] to []{ farms }
 	farmsPerService = make(map[string][]string)
 
+	// Map [Service-Endpoints (name)] to { farm made for every port }, only for compact Services
+	compactFarmPerService = make(map[string]compactFarm)
+
 	// Map [farm (name)] to []{ backends }
 	backendsPerFarm = make(map[string][]string)
 
 	// Map [farm (name)] to []{ addresses }
 	addressesPerFarm = make(map[string][]string)
+
+	// Map [farm (name)] to []{ VIPs of its addresses }
+	vipsPerFarm = make(map[string][]conntrack.VIP)
 )
@@ -1,6 +1,11 @@
 package parser
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+)
 
 // FormatName returns a formatted name string for any nftlb object.
 func FormatName(resourceName string, resourcePortName string) string {
@@ -20,6 +25,12 @@ func FormatName(resourceName string, resourcePortName string) string {
 	return fmt.Sprintf("%s--%s", resourceName, resourcePortName)
 }
 
+// FormatCompactName returns a formatted name (--ports suffix) for any nftlb object made for every port of a resource.
+func FormatCompactName(resourceName string) string {
+	// Example: "address" => "address--ports".
+	return FormatName(resourceName, "ports")
+}
+
 // FormatNodePortName returns a formatted name (--nodePort suffix) for any nftlb object.
 func FormatNodePortName(resourceName string, resourcePortName string) string {
 	// The NodePort resource is called the same as the original resource by appending the string "nodePort".
@@ -33,3 +44,25 @@ func FormatExternalIPName(resourceName string, resourcePortName string, index in
 	// Example: "address--http" => "address--http--externalIP-index".
 	return fmt.Sprintf("%s--externalIP-%d", FormatName(resourceName, resourcePortName), index)
 }
+
+// FormatLoadBalancerIPName returns a formatted name (--loadBalancerIP-index suffix) string for any nftlb object.
+func FormatLoadBalancerIPName(resourceName string, resourcePortName string, index int) string {
+	// The LoadBalancer IP resource is called the same as the original resource by appending the string "loadBalancerIP-index".
+	// Example: "address--http" => "address--http--loadBalancerIP-index".
+	return fmt.Sprintf("%s--loadBalancerIP-%d", FormatName(resourceName, resourcePortName), index)
+}
+
+// FormatSharedName returns a formatted name (shared-- prefix) for the address of a VIP shared by every Service with
+// the same shared key, so it doesn't depend on the Service that programs it.
+func FormatSharedName(sharedKey string, vip string, ports string, protocol types.Protocol) string {
+	// Addresses of shared VIPs start with "shared", followed by the shared key, the VIP, its ports and its protocol.
+	// Example: "dns", "192.168.0.10", "53,5353", "udp" => "shared--dns--192.168.0.10--53_5353-udp".
+	return fmt.Sprintf("shared--%s--%s--%s-%s", sharedKey, vip, strings.ReplaceAll(ports, ",", "_"), protocol)
+}
+
+// FormatNftlbFarmName returns a formatted name (nftlbfarm-- prefix) for the farm made from a NftlbFarm.
+func FormatNftlbFarmName(namespace string, name string) string {
+	// Farms made from NftlbFarms start with "nftlbfarm", followed by the namespace and the name of the NftlbFarm.
+	// Example: "default", "legacy-db" => "nftlbfarm--default--legacy-db".
+	return fmt.Sprintf("nftlbfarm--%s--%s", namespace, name)
+}
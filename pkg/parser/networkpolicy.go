@@ -9,6 +9,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/zevenet/kube-nftlb/pkg/auth"
 	"github.com/zevenet/kube-nftlb/pkg/types"
 
 	networkingv1 "k8s.io/api/networking/v1"
@@ -200,7 +201,7 @@ func getPodIPListFromSelectors(labelNamespaceSelector *metav1.LabelSelector, lab
 	}
 
 	// Get namespaces selected by labelNamespaceSelector
-	namespaces, _ := clientset.CoreV1().Namespaces().List(context.TODO(), opts)
+	namespaces, _ := auth.GetClientset().CoreV1().Namespaces().List(context.TODO(), opts)
 	for _, namespace := range namespaces.Items {
 		// Get pods inside this namespace that are also matched by labelPodSelector
 		podIPList = append(podIPList, getPodIPListFromPodSelector(namespace.Name, labelPodSelector)...)
@@ -219,7 +220,7 @@ func getPodIPListFromPodSelector(namespace string, labelPodSelector *metav1.Labe
 	}
 
 	// Get selected pods in this namespace
-	pods, _ := clientset.CoreV1().Pods(namespace).List(context.TODO(), opts)
+	pods, _ := auth.GetClientset().CoreV1().Pods(namespace).List(context.TODO(), opts)
 	for _, pod := range pods.Items {
 		// Get IPs from this pod
 		for _, podIP := range pod.Status.PodIPs {
@@ -0,0 +1,323 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/zevenet/kube-nftlb/pkg/events"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/processor"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	// It locks every map of this file
+	nftlbFarmsMutex sync.Mutex
+
+	// Map [farm (name)] to { NftlbFarm (namespace/name) that owns it }
+	ownerPerFarm = make(map[string]string)
+
+	// Map [NftlbFarm (namespace/name)] to { its farm is owned by a Service }
+	conflictedNftlbFarms = make(map[string]bool)
+
+	// Map [farm (name)] to [Service (namespace/name)] to { it wasn't applied because a NftlbFarm owns the farm }
+	refusedServices = make(map[string]map[string]bool)
+)
+
+// NftlbFarmSpec reads and checks the spec of a NftlbFarm. Selectors are returned as label selectors, the pod selector
+// is nil if backends aren't made for Pods, and the node selector matches every node if it isn't set.
+func NftlbFarmSpec(obj *unstructured.Unstructured) (*types.NftlbFarmSpec, labels.Selector, labels.Selector, field.ErrorList) {
+	fldPath := field.NewPath("spec")
+	spec := &types.NftlbFarmSpec{}
+
+	specMap, _, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return spec, nil, nil, field.ErrorList{field.Invalid(fldPath, nil, err.Error())}
+	}
+
+	// The spec is decoded as JSON, numbers of the nftlb model are accepted as strings or integers
+	specJSON, err := json.Marshal(specMap)
+	if err == nil {
+		err = json.Unmarshal(specJSON, spec)
+	}
+	if err != nil {
+		return spec, nil, nil, field.ErrorList{field.Invalid(fldPath, nil, err.Error())}
+	}
+
+	allErrs := field.ErrorList{}
+	if len(spec.Addresses) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("addresses"), "at least 1 address"))
+	}
+	if spec.BackendPort != nil && *spec.BackendPort == 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("backendPort"), spec.BackendPort.String(), "must be between 1 and 65535"))
+	}
+
+	var podSelector labels.Selector
+	if spec.PodSelector != nil {
+		if podSelector, err = metav1.LabelSelectorAsSelector(spec.PodSelector); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("podSelector"), spec.PodSelector, err.Error()))
+		}
+	}
+
+	nodeSelector := labels.Everything()
+	if spec.NodeSelector != nil {
+		if nodeSelector, err = metav1.LabelSelectorAsSelector(spec.NodeSelector); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("nodeSelector"), spec.NodeSelector, err.Error()))
+		}
+	}
+
+	return spec, podSelector, nodeSelector, allErrs
+}
+
+// NftlbFarmAsNftlb returns a Nftlb struct with the farm of a NftlbFarm, its policies and its backends: static backends
+// and a backend for every ready Pod. Names of addresses and policies start with the farm name, so they're unique.
+func NftlbFarmAsNftlb(obj *unstructured.Unstructured, spec *types.NftlbFarmSpec, pods []*corev1.Pod) (*types.Nftlb, field.ErrorList) {
+	fldPath := field.NewPath("spec")
+
+	farm := spec.Farm
+	farm.Name = FormatNftlbFarmName(obj.GetNamespace(), obj.GetName())
+	if farm.State == "" {
+		farm.State = types.StateUp
+	}
+	if farm.Log != "" && farm.Log != types.LogNone && farm.LogPrefix == "" {
+		farm.LogPrefix = farm.Name
+	}
+	if farm.Iface == "" {
+		farm.Iface = findIface(farm.Mode)
+	}
+
+	farm.Addresses = make([]types.Address, len(spec.Addresses))
+	for index, address := range spec.Addresses {
+		name := address.Name
+		if name == "" {
+			name = strconv.Itoa(index)
+		}
+		address.Name = fmt.Sprintf("%s--address", FormatName(farm.Name, name))
+		farm.Addresses[index] = address
+	}
+
+	farm.Backends = append([]types.Backend{}, spec.Backends...)
+	for _, pod := range pods {
+		if !podIsReady(pod) {
+			continue
+		}
+
+		backend := types.Backend{
+			Name:   pod.Name,
+			IPAddr: pod.Status.PodIP,
+			State:  types.StateUp,
+			Port:   spec.BackendPort,
+		}
+		processor.ApplyBackend(&backend, podSettings(podKey(pod.Namespace, pod.Name)))
+		farm.Backends = append(farm.Backends, backend)
+	}
+	sort.SliceStable(farm.Backends[len(spec.Backends):], func(i, j int) bool {
+		return farm.Backends[len(spec.Backends)+i].Name < farm.Backends[len(spec.Backends)+j].Name
+	})
+
+	policies := make([]types.Policy, len(spec.Policies))
+	farm.Policies = make([]types.FarmPolicy, len(spec.Policies))
+	for index, policy := range spec.Policies {
+		policy.Name = FormatName(farm.Name, policy.Name)
+		policies[index] = policy
+		farm.Policies[index] = types.FarmPolicy{Name: policy.Name}
+	}
+
+	allErrs := validation.Farm(&farm, fldPath)
+	allErrs = append(allErrs, duplicateNames(len(farm.Addresses), func(index int) string {
+		return farm.Addresses[index].Name
+	}, fldPath.Child("addresses"))...)
+	allErrs = append(allErrs, duplicateNames(len(farm.Backends), func(index int) string {
+		return farm.Backends[index].Name
+	}, fldPath.Child("backends"))...)
+	for index := range policies {
+		allErrs = append(allErrs, validation.Policy(&policies[index], fldPath.Child("policies").Index(index))...)
+	}
+
+	return &types.Nftlb{
+		Farms:    []types.Farm{farm},
+		Policies: policies,
+	}, allErrs
+}
+
+// NftlbFarmAsPaths returns paths of every object sent for a NftlbFarm (oldNftlb) that isn't in its updated Nftlb
+// struct (newNftlb), which is nil if the farm is deleted. The controller then deletes every path.
+func NftlbFarmAsPaths(oldNftlb *types.Nftlb, newNftlb *types.Nftlb) []string {
+	paths := make([]string, 0)
+	oldFarm := oldNftlb.Farms[0]
+
+	// Deleting the farm deletes its backends
+	if newNftlb == nil {
+		paths = append(paths, fmt.Sprintf("farms/%s", oldFarm.Name))
+		for _, address := range oldFarm.Addresses {
+			paths = append(paths, fmt.Sprintf("addresses/%s", address.Name))
+		}
+		for _, policy := range oldNftlb.Policies {
+			paths = append(paths, fmt.Sprintf("policies/%s", policy.Name))
+		}
+		return paths
+	}
+	newFarm := newNftlb.Farms[0]
+
+	// Map [object (name)] to { exists }
+	newBackends := make(map[string]bool)
+	for _, backend := range newFarm.Backends {
+		newBackends[backend.Name] = true
+	}
+	newAddresses := make(map[string]bool)
+	for _, address := range newFarm.Addresses {
+		newAddresses[address.Name] = true
+	}
+	newPolicies := make(map[string]bool)
+	for _, policy := range newNftlb.Policies {
+		newPolicies[policy.Name] = true
+	}
+
+	for _, backend := range oldFarm.Backends {
+		if !newBackends[backend.Name] {
+			paths = append(paths, fmt.Sprintf("farms/%s/backends/%s", oldFarm.Name, backend.Name))
+		}
+	}
+	for _, address := range oldFarm.Addresses {
+		if !newAddresses[address.Name] {
+			paths = append(paths, fmt.Sprintf("farms/%s/addresses/%s", oldFarm.Name, address.Name))
+			paths = append(paths, fmt.Sprintf("addresses/%s", address.Name))
+		}
+	}
+	for _, policy := range oldNftlb.Policies {
+		if !newPolicies[policy.Name] {
+			paths = append(paths, fmt.Sprintf("farms/%s/policies/%s", oldFarm.Name, policy.Name))
+			paths = append(paths, fmt.Sprintf("policies/%s", policy.Name))
+		}
+	}
+	return paths
+}
+
+// ClaimNftlbFarm makes a NftlbFarm (namespace/name) the owner of its farm. It returns an error if the farm is owned by
+// a Service, the NftlbFarm is retried when that Service is deleted (see ConflictedNftlbFarms).
+func ClaimNftlbFarm(key string, farmName string) error {
+	nftlbFarmsMutex.Lock()
+	defer nftlbFarmsMutex.Unlock()
+
+	for serviceName, farms := range farmsPerService {
+		for _, serviceFarm := range farms {
+			if serviceFarm == farmName {
+				conflictedNftlbFarms[key] = true
+				return fmt.Errorf("farm %s is owned by the Service %s", farmName, serviceName)
+			}
+		}
+	}
+
+	delete(conflictedNftlbFarms, key)
+	ownerPerFarm[farmName] = key
+	return nil
+}
+
+// ReleaseNftlbFarm forgets the owner of a farm that isn't programmed anymore. It returns every Service
+// (namespace/name) that wasn't applied because of that farm.
+func ReleaseNftlbFarm(key string, farmName string) []string {
+	nftlbFarmsMutex.Lock()
+	defer nftlbFarmsMutex.Unlock()
+
+	delete(conflictedNftlbFarms, key)
+	if ownerPerFarm[farmName] != key {
+		return nil
+	}
+	delete(ownerPerFarm, farmName)
+
+	services := make([]string, 0, len(refusedServices[farmName]))
+	for service := range refusedServices[farmName] {
+		services = append(services, service)
+	}
+	delete(refusedServices, farmName)
+	return services
+}
+
+// ConflictedNftlbFarms returns every NftlbFarm (namespace/name) whose farm is owned by a Service.
+func ConflictedNftlbFarms() []string {
+	nftlbFarmsMutex.Lock()
+	defer nftlbFarmsMutex.Unlock()
+
+	keys := make([]string, 0, len(conflictedNftlbFarms))
+	for key := range conflictedNftlbFarms {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// nftlbFarmConflict returns the NftlbFarm (namespace/name) that owns a farm that would be made for a Service, if any.
+// The Service is applied again when that NftlbFarm releases the farm.
+func nftlbFarmConflict(service *corev1.Service) string {
+	farmNames := []string{FormatCompactName(service.Name)}
+	for _, servicePort := range service.Spec.Ports {
+		farmNames = append(farmNames, FormatName(service.Name, servicePort.Name))
+	}
+
+	nftlbFarmsMutex.Lock()
+	defer nftlbFarmsMutex.Unlock()
+
+	for _, farmName := range farmNames {
+		if owner, ok := ownerPerFarm[farmName]; ok {
+			if refusedServices[farmName] == nil {
+				refusedServices[farmName] = make(map[string]bool)
+			}
+			refusedServices[farmName][podKey(service.Namespace, service.Name)] = true
+
+			log.WriteLog(types.ErrorLog, fmt.Sprintf("nftlbFarmConflict: Service name: %s\nFarm %s is owned by the NftlbFarm %s", service.Name, farmName, owner))
+			events.Warning(service, "FarmConflict", fmt.Sprintf("farm %s is owned by the NftlbFarm %s, the Service won't be applied until it's deleted", farmName, owner))
+			return owner
+		}
+	}
+	return ""
+}
+
+// podIsReady returns true if a Pod has an IP and it's ready to get traffic.
+func podIsReady(pod *corev1.Pod) bool {
+	if pod.Status.PodIP == "" || pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podSettings returns the backend settings read from the annotations of a Pod (namespace/name), and the default value
+// of settings removed from them.
+func podSettings(key string) map[string]string {
+	podsMutex.RLock()
+	defer podsMutex.RUnlock()
+
+	settings := make(map[string]string)
+	for _, values := range []map[string]string{podsData[key].resets, podsData[key].settings} {
+		for name, value := range values {
+			settings[name] = value
+		}
+	}
+	return settings
+}
+
+// duplicateNames checks that every name of a list is unique.
+func duplicateNames(length int, name func(int) string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	seen := make(map[string]bool)
+	for index := 0; index < length; index++ {
+		if seen[name(index)] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Index(index).Child("name"), name(index)))
+		}
+		seen[name(index)] = true
+	}
+	return allErrs
+}
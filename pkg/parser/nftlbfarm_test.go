@@ -0,0 +1,224 @@
+package parser
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// newNftlbFarm returns a NftlbFarm in the default namespace.
+func newNftlbFarm(name string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	return obj
+}
+
+// readyPod returns a running Pod with an IP, ready or not.
+func readyPod(name string, ip string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			PodIP:      ip,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+		},
+	}
+}
+
+func TestNftlbFarmSpec(t *testing.T) {
+	address := map[string]interface{}{"family": "ipv4", "ip-addr": "192.168.0.10", "ports": "5432", "protocol": "tcp"}
+
+	tests := []struct {
+		name        string
+		spec        map[string]interface{}
+		fields      []string // Fields with errors
+		podSelector bool
+		nodes       string // Labels of a node that must match the node selector
+	}{
+		{
+			name:  "static backends",
+			spec:  map[string]interface{}{"addresses": []interface{}{address}, "mode": "dnat"},
+			nodes: "zone=a",
+		},
+		{
+			name: "numbers as integers or strings",
+			spec: map[string]interface{}{
+				"addresses":     []interface{}{address},
+				"est-connlimit": "100",
+				"priority":      int64(2),
+				"backendPort":   int64(5432),
+			},
+		},
+		{
+			name: "selectors",
+			spec: map[string]interface{}{
+				"addresses":    []interface{}{address},
+				"podSelector":  map[string]interface{}{"matchLabels": map[string]interface{}{"app": "db"}},
+				"nodeSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"zone": "a"}},
+			},
+			podSelector: true,
+			nodes:       "zone=a",
+		},
+		{
+			name:   "without addresses",
+			spec:   map[string]interface{}{},
+			fields: []string{"spec.addresses"},
+		},
+		{
+			name:   "backend port 0",
+			spec:   map[string]interface{}{"addresses": []interface{}{address}, "backendPort": "0"},
+			fields: []string{"spec.backendPort"},
+		},
+		{
+			name: "invalid selectors",
+			spec: map[string]interface{}{
+				"addresses":    []interface{}{address},
+				"podSelector":  map[string]interface{}{"matchExpressions": []interface{}{map[string]interface{}{"key": "app", "operator": "Near"}}},
+				"nodeSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"zone": "a b"}},
+			},
+			fields: []string{"spec.podSelector", "spec.nodeSelector"},
+		},
+		{
+			name:   "invalid number",
+			spec:   map[string]interface{}{"addresses": []interface{}{address}, "priority": "high"},
+			fields: []string{"spec"},
+		},
+	}
+
+	for _, test := range tests {
+		_, podSelector, nodeSelector, errs := NftlbFarmSpec(newNftlbFarm("db", test.spec))
+		fields := make([]string, 0, len(errs))
+		for _, err := range errs {
+			fields = append(fields, err.Field)
+		}
+		if len(fields) != len(test.fields) || (len(fields) > 0 && !reflect.DeepEqual(fields, test.fields)) {
+			t.Errorf("%s: got errors %v, want errors in %v", test.name, errs, test.fields)
+			continue
+		}
+		if len(errs) > 0 {
+			continue
+		}
+
+		if (podSelector != nil) != test.podSelector {
+			t.Errorf("%s: got pod selector %v, want one: %t", test.name, podSelector, test.podSelector)
+		}
+		nodeLabels, _ := labels.ConvertSelectorToLabelsMap(test.nodes)
+		if !nodeSelector.Matches(nodeLabels) || (test.podSelector && nodeSelector.Matches(labels.Set{"zone": "b"})) {
+			t.Errorf("%s: got node selector %q", test.name, nodeSelector.String())
+		}
+	}
+}
+
+func TestNftlbFarmAsNftlb(t *testing.T) {
+	obj := newNftlbFarm("db", map[string]interface{}{
+		"addresses": []interface{}{
+			map[string]interface{}{"family": "ipv4", "ip-addr": "192.168.0.10", "ports": "5432", "protocol": "tcp"},
+			map[string]interface{}{"name": "v6", "family": "ipv6", "ip-addr": "fd00::10", "ports": "5432", "protocol": "tcp"},
+		},
+		"log":         "input",
+		"backends":    []interface{}{map[string]interface{}{"name": "legacy", "ip-addr": "10.0.0.5"}},
+		"backendPort": "5432",
+		"policies":    []interface{}{map[string]interface{}{"name": "blacklist", "type": "blacklist"}},
+	})
+	spec, _, _, errs := NftlbFarmSpec(obj)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	pods := []*corev1.Pod{readyPod("db-1", "172.17.0.3", true), readyPod("db-0", "172.17.0.2", true), readyPod("db-2", "172.17.0.4", false)}
+	nftlb, errs := NftlbFarmAsNftlb(obj, spec, pods)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	farm := nftlb.Farms[0]
+	if farm.Name != "nftlbfarm--default--db" || farm.State != types.StateUp || farm.LogPrefix != farm.Name {
+		t.Fatalf("got farm %+v, want nftlbfarm--default--db up and logged with its name", farm)
+	}
+
+	// Names of addresses and policies start with the farm name
+	addresses := []string{farm.Addresses[0].Name, farm.Addresses[1].Name}
+	if want := []string{"nftlbfarm--default--db--0--address", "nftlbfarm--default--db--v6--address"}; !reflect.DeepEqual(addresses, want) {
+		t.Fatalf("got addresses %v, want %v", addresses, want)
+	}
+	if len(nftlb.Policies) != 1 || nftlb.Policies[0].Name != "nftlbfarm--default--db--blacklist" || farm.Policies[0].Name != nftlb.Policies[0].Name {
+		t.Fatalf("got policies %+v of the farm %+v, want nftlbfarm--default--db--blacklist", nftlb.Policies, farm.Policies)
+	}
+
+	// Static backends go first, then a backend for every ready Pod sorted by name
+	backends := make([]string, 0, len(farm.Backends))
+	for _, backend := range farm.Backends {
+		backends = append(backends, backend.Name)
+	}
+	if want := []string{"legacy", "db-0", "db-1"}; !reflect.DeepEqual(backends, want) {
+		t.Fatalf("got backends %v, want %v", backends, want)
+	}
+	if backend := farm.Backends[1]; backend.IPAddr != "172.17.0.2" || backend.Port == nil || *backend.Port != 5432 || backend.Weight != nil {
+		t.Fatalf("got backend %+v, want 172.17.0.2:5432 without weight", backend)
+	}
+
+	// Invalid farms and duplicated names are reported
+	spec.Farm.Backends = append(spec.Farm.Backends, types.Backend{Name: "db-0", IPAddr: "10.0.0.6"})
+	spec.Policies[0].Type = "greylist"
+	_, errs = NftlbFarmAsNftlb(obj, spec, pods)
+	fields := make([]string, 0, len(errs))
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+	sort.Strings(fields)
+	if want := []string{"spec.backends[2].name", "spec.policies[0].type"}; !reflect.DeepEqual(fields, want) {
+		t.Fatalf("got errors %v, want errors in %v", errs, want)
+	}
+}
+
+func TestClaimNftlbFarm(t *testing.T) {
+	farmsPerService["web"] = []string{"web--http"}
+	defer delete(farmsPerService, "web")
+
+	// Farms owned by a Service can't be claimed, the NftlbFarm is retried later
+	if err := ClaimNftlbFarm("default/web", "web--http"); err == nil {
+		t.Fatal("got no error, want the farm owned by the Service")
+	}
+	if conflicted := ConflictedNftlbFarms(); !reflect.DeepEqual(conflicted, []string{"default/web"}) {
+		t.Fatalf("got conflicted NftlbFarms %v, want default/web", conflicted)
+	}
+
+	delete(farmsPerService, "web")
+	if err := ClaimNftlbFarm("default/web", "web--http"); err != nil {
+		t.Fatal(err)
+	}
+	if conflicted := ConflictedNftlbFarms(); len(conflicted) != 0 {
+		t.Fatalf("got conflicted NftlbFarms %v, want none", conflicted)
+	}
+
+	// Services whose farms are owned by a NftlbFarm aren't applied until the farm is released
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+	}
+	if owner := nftlbFarmConflict(service); owner != "default/web" {
+		t.Fatalf("got owner %q, want default/web", owner)
+	}
+
+	if services := ReleaseNftlbFarm("default/other", "web--http"); len(services) != 0 {
+		t.Fatalf("got Services %v released by another NftlbFarm, want none", services)
+	}
+	if services := ReleaseNftlbFarm("default/web", "web--http"); !reflect.DeepEqual(services, []string{"default/web"}) {
+		t.Fatalf("got Services %v, want default/web", services)
+	}
+	if owner := nftlbFarmConflict(service); owner != "" {
+		t.Fatalf("got owner %q of a released farm, want none", owner)
+	}
+}
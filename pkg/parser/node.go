@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"sync"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"k8s.io/apimachinery/pkg/labels"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	// It locks localNodeLabels
+	localNodeMutex sync.RWMutex
+
+	// Labels of the node where kube-nftlb is running (NODE_NAME)
+	localNodeLabels labels.Set
+)
+
+// SetLocalNode reads the labels of a Node if it's the node where kube-nftlb is running. It returns true if they have
+// changed.
+func SetLocalNode(node *corev1.Node) bool {
+	if node.Name != config.NodeName {
+		return false
+	}
+
+	localNodeMutex.Lock()
+	defer localNodeMutex.Unlock()
+
+	if localNodeLabels != nil && labels.Equals(localNodeLabels, node.Labels) {
+		return false
+	}
+	localNodeLabels = labels.Merge(labels.Set{}, node.Labels)
+	return true
+}
+
+// LocalNodeMatches returns true if the labels of the node where kube-nftlb is running match a selector. Nothing
+// matches until the node has been read.
+func LocalNodeMatches(selector labels.Selector) bool {
+	localNodeMutex.RLock()
+	defer localNodeMutex.RUnlock()
+
+	return localNodeLabels != nil && selector.Matches(localNodeLabels)
+}
@@ -0,0 +1,306 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+	"github.com/zevenet/kube-nftlb/pkg/nft"
+	"github.com/zevenet/kube-nftlb/pkg/processor"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// noEndpoints stores what is done with traffic of a farm without endpoints.
+type noEndpoints struct {
+	action   string
+	fallback string // Service (namespace/name)
+	portName string // ServicePort name, it's empty for compact farms (backends keep the destination port)
+	rejects  []nft.Reject
+}
+
+var (
+	// It locks every map of this file
+	noEndpointsMutex sync.Mutex
+
+	// Map [farm (name)] to { what is done without endpoints }
+	noEndpointsPerFarm = make(map[string]noEndpoints)
+
+	// Map [farm (name)] to { it has endpoints }, only for farms whose Endpoints have been read
+	hasEndpointsPerFarm = make(map[string]bool)
+
+	// Map [farm (name)] to []{ rejects added to nft }
+	rejectsPerFarm = make(map[string][]nft.Reject)
+
+	// Map [fallback Service (namespace/name)] to [farm (name)] to { Endpoints (namespace/name) of that farm }
+	fallbackUsers = make(map[string]map[string]string)
+
+	// Every Endpoints known by the Endpoints controller, backends made from other Services are read from it
+	endpointsStore cache.Store
+)
+
+// SetEndpointsStore sets the store of the Endpoints controller, so backends made from the endpoints of other Services
+// are read without requests to the API Server.
+func SetEndpointsStore(store cache.Store) {
+	endpointsStore = store
+}
+
+// setNoEndpoints keeps what is done with traffic of a farm without endpoints. The farm must have every address.
+func setNoEndpoints(farm *types.Farm, namespace string, portName string, annotations *types.Annotations) {
+	setting := noEndpoints{
+		action:   annotations.Settings[processor.NoEndpointsSetting],
+		fallback: annotations.Settings[processor.FallbackServiceSetting],
+		portName: portName,
+	}
+	if setting.fallback != "" && !strings.Contains(setting.fallback, "/") {
+		setting.fallback = namespace + "/" + setting.fallback
+	}
+
+	for _, address := range farm.Addresses {
+		// Traffic of every protocol can't be rejected by port
+		if address.Protocol == types.ProtocolAll {
+			continue
+		}
+		for _, port := range expandPorts(address.Ports) {
+			setting.rejects = append(setting.rejects, nft.Reject{
+				IP:       address.IPAddr,
+				Protocol: string(address.Protocol),
+				Port:     port,
+			})
+		}
+	}
+
+	noEndpointsMutex.Lock()
+	defer noEndpointsMutex.Unlock()
+
+	noEndpointsPerFarm[farm.Name] = setting
+	applyNoEndpointsLocked(farm.Name)
+}
+
+// deleteNoEndpoints forgets what is done with traffic of a deleted farm, and stops rejecting its traffic.
+func deleteNoEndpoints(farmName string) {
+	noEndpointsMutex.Lock()
+	defer noEndpointsMutex.Unlock()
+
+	delete(noEndpointsPerFarm, farmName)
+	applyNoEndpointsLocked(farmName)
+}
+
+// deleteEndpointsState forgets if a farm had endpoints, its Endpoints have been deleted.
+func deleteEndpointsState(farmName string) {
+	noEndpointsMutex.Lock()
+	defer noEndpointsMutex.Unlock()
+
+	delete(hasEndpointsPerFarm, farmName)
+	deleteFallbackUserLocked(farmName)
+	applyNoEndpointsLocked(farmName)
+}
+
+// FallbackUsers returns every Endpoints (namespace/name) whose farms don't have endpoints and send their traffic to a
+// fallback Service (namespace/name), so they're updated when the fallback Service changes.
+func FallbackUsers(fallback string) []string {
+	noEndpointsMutex.Lock()
+	defer noEndpointsMutex.Unlock()
+
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+	for _, key := range fallbackUsers[fallback] {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// noEndpointsAsNftlb checks every farm made for an Endpoints object. Farms without endpoints get the backends of their
+// fallback Service (if any), or their traffic is rejected (if it must be). Farms with endpoints go back to normal.
+func noEndpointsAsNftlb(endpoints *corev1.Endpoints, nftlb *types.Nftlb) {
+	noEndpointsMutex.Lock()
+	defer noEndpointsMutex.Unlock()
+
+	for _, farmName := range farmsPerService[endpoints.Name] {
+		index := -1
+		for idxFarm := range nftlb.Farms {
+			if nftlb.Farms[idxFarm].Name == farmName {
+				index = idxFarm
+			}
+		}
+
+		hasEndpoints := index >= 0 && len(nftlb.Farms[index].Backends) > 0
+		hasEndpointsPerFarm[farmName] = hasEndpoints
+		deleteFallbackUserLocked(farmName)
+
+		setting, ok := noEndpointsPerFarm[farmName]
+		if !hasEndpoints && ok && setting.action == "fallback" {
+			if setting.fallback == "" {
+				log.WriteLog(types.ErrorLog, fmt.Sprintf("noEndpointsAsNftlb: farm name: %s\nFallback Service isn't set, traffic will be dropped", farmName))
+			} else {
+				if fallbackUsers[setting.fallback] == nil {
+					fallbackUsers[setting.fallback] = make(map[string]string)
+				}
+				fallbackUsers[setting.fallback][farmName] = podKey(endpoints.Namespace, endpoints.Name)
+
+				// Backends made for Pods of this Service have left
+				deletePodBackends(farmName)
+
+				backends := serviceBackends(farmName, setting.fallback, setting.portName, "fallback")
+				backendsPerFarm[farmName] = make([]string, len(backends))
+				for idxBackend, backend := range backends {
+					backendsPerFarm[farmName][idxBackend] = backend.Name
+				}
+
+				if index < 0 {
+					nftlb.Farms = append(nftlb.Farms, types.Farm{Name: farmName})
+					index = len(nftlb.Farms) - 1
+				}
+				nftlb.Farms[index].Backends = backends
+			}
+		}
+
+		applyNoEndpointsLocked(farmName)
+	}
+}
+
+// applyNoEndpointsLocked rejects traffic of a farm without endpoints if it must be rejected, and stops rejecting it
+// otherwise. Farms without endpoints are exported by what is done with their traffic.
+func applyNoEndpointsLocked(farmName string) {
+	setting, ok := noEndpointsPerFarm[farmName]
+	hasEndpoints, known := hasEndpointsPerFarm[farmName]
+	withoutEndpoints := ok && known && !hasEndpoints
+
+	var rejects []nft.Reject
+	if withoutEndpoints && setting.action == "reject" {
+		rejects = setting.rejects
+	}
+
+	if oldRejects := rejectsPerFarm[farmName]; !reflect.DeepEqual(oldRejects, rejects) {
+		if err := nft.DeleteRejects(oldRejects); err != nil {
+			log.WriteLog(types.ErrorLog, fmt.Sprintf("applyNoEndpointsLocked: farm name: %s\n%s", farmName, err.Error()))
+		}
+		delete(rejectsPerFarm, farmName)
+
+		if err := nft.AddRejects(rejects); err != nil {
+			log.WriteLog(types.ErrorLog, fmt.Sprintf("applyNoEndpointsLocked: farm name: %s\n%s", farmName, err.Error()))
+		} else if len(rejects) > 0 {
+			rejectsPerFarm[farmName] = rejects
+		}
+	}
+
+	for _, action := range validation.NoEndpointsActions {
+		if withoutEndpoints && action == setting.action {
+			metrics.FarmsWithoutEndpoints.WithLabelValues(farmName, action).Set(1)
+		} else {
+			metrics.FarmsWithoutEndpoints.DeleteLabelValues(farmName, action)
+		}
+	}
+}
+
+// farmPortName returns the ServicePort name of a farm, it's empty for compact farms.
+func farmPortName(farmName string) string {
+	noEndpointsMutex.Lock()
+	defer noEndpointsMutex.Unlock()
+
+	return noEndpointsPerFarm[farmName].portName
+}
+
+// deleteFallbackUserLocked forgets that a farm sends its traffic to a fallback Service.
+func deleteFallbackUserLocked(farmName string) {
+	for fallback, farms := range fallbackUsers {
+		delete(farms, farmName)
+		if len(farms) == 0 {
+			delete(fallbackUsers, fallback)
+		}
+	}
+}
+
+// serviceBackends returns backends of a farm made from the endpoints of another Service (namespace/name), their names
+// have a suffix. Every backend uses the EndpointPort with the same name as the ServicePort of the farm, or the only
+// EndpointPort if there's only one. Compact farms (portName is empty) keep the destination port.
+func serviceBackends(farmName string, key string, portName string, suffix string) []types.Backend {
+	backends := make([]types.Backend, 0)
+
+	// Nothing to read until the Endpoints controller is made
+	if endpointsStore == nil {
+		return backends
+	}
+
+	obj, exists, err := endpointsStore.GetByKey(key)
+	if err != nil {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("serviceBackends: farm name: %s\n%s", farmName, err.Error()))
+		return backends
+	} else if !exists {
+		// Farms are updated again when the Endpoints of that Service are added
+		log.WriteLog(types.DetailedLog, fmt.Sprintf("serviceBackends: farm name: %s\nEndpoints %s not found", farmName, key))
+		return backends
+	}
+	endpoints := obj.(*corev1.Endpoints)
+
+	for _, subset := range endpoints.Subsets {
+		var epPort *corev1.EndpointPort
+		for index := range subset.Ports {
+			if subset.Ports[index].Name == portName || len(subset.Ports) == 1 {
+				epPort = &subset.Ports[index]
+				break
+			}
+		}
+
+		// A ServicePort needs the port of the other Service
+		if epPort == nil && portName != "" {
+			continue
+		}
+
+		for _, epAddress := range subset.Addresses {
+			backend := types.Backend{
+				IPAddr: epAddress.IP,
+				State:  types.StateUp,
+			}
+
+			name := endpoints.Name
+			if epAddress.TargetRef != nil {
+				name = epAddress.TargetRef.Name
+			}
+			if portName != "" {
+				backend.Port = types.NewPort(uint16(epPort.Port))
+				backend.Name = fmt.Sprintf("%s--%s", FormatName(name, epPort.Name), suffix)
+			} else {
+				backend.Name = fmt.Sprintf("%s--%s", FormatCompactName(name), suffix)
+			}
+
+			backends = append(backends, backend)
+		}
+	}
+
+	return backends
+}
+
+// expandPorts returns every port of a nftlb ports string (example: "80,8000-8002" returns 80, 8000, 8001 and 8002).
+func expandPorts(ports string) []string {
+	expanded := make([]string, 0)
+	for _, portRange := range strings.Split(ports, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(portRange), "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			continue
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				continue
+			}
+		}
+
+		for port := first; port <= last; port++ {
+			expanded = append(expanded, strconv.Itoa(port))
+		}
+	}
+	return expanded
+}
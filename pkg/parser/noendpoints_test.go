@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestExpandPorts(t *testing.T) {
+	tests := []struct {
+		ports string
+		want  []string
+	}{
+		{"80", []string{"80"}},
+		{"80,443", []string{"80", "443"}},
+		{"8000-8002", []string{"8000", "8001", "8002"}},
+		{"53, 8000-8001", []string{"53", "8000", "8001"}},
+		{"http,8080", []string{"8080"}},
+		{"", []string{}},
+	}
+
+	for _, test := range tests {
+		if got := expandPorts(test.ports); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.ports, got, test.want)
+		}
+	}
+}
+
+func TestNoEndpointsAsNftlb(t *testing.T) {
+	farm := &types.Farm{
+		Name:      "web--http",
+		Addresses: []types.Address{{IPAddr: "10.0.0.1", Ports: "80", Protocol: types.ProtocolTCP}},
+	}
+	annotations := &types.Annotations{Settings: map[string]string{"no-endpoints": "reject"}}
+	endpoints := &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	labels := map[string]string{"farm": "web--http", "action": "reject"}
+
+	farmsPerService["web"] = []string{"web--http"}
+	defer delete(farmsPerService, "web")
+	setNoEndpoints(farm, "default", "http", annotations)
+	defer deleteEndpointsState("web--http")
+	defer deleteNoEndpoints("web--http")
+
+	// Every port of every address is rejected
+	if rejects := noEndpointsPerFarm["web--http"].rejects; len(rejects) != 1 || rejects[0].IP != "10.0.0.1" || rejects[0].Port != "80" {
+		t.Fatalf("got rejects %+v, want 10.0.0.1 tcp 80", rejects)
+	}
+
+	// Farms aren't exported until their Endpoints are read
+	if _, exported := gaugeValue(t, metrics.FarmsWithoutEndpoints, labels); exported {
+		t.Fatal("got a farm without endpoints before its Endpoints are read")
+	}
+
+	noEndpointsAsNftlb(endpoints, &types.Nftlb{})
+	if _, exported := gaugeValue(t, metrics.FarmsWithoutEndpoints, labels); !exported {
+		t.Fatal("got no farm without endpoints, want web--http")
+	}
+
+	nftlb := &types.Nftlb{Farms: []types.Farm{{Name: "web--http", Backends: []types.Backend{{Name: "pod-a--http"}}}}}
+	noEndpointsAsNftlb(endpoints, nftlb)
+	if _, exported := gaugeValue(t, metrics.FarmsWithoutEndpoints, labels); exported {
+		t.Fatal("got a farm without endpoints after it has backends")
+	}
+}
+
+func TestServiceBackendsFromStore(t *testing.T) {
+	oldStore := endpointsStore
+	defer SetEndpointsStore(oldStore)
+
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	SetEndpointsStore(store)
+
+	if backends := serviceBackends("web--http", "default/fallback", "http", "fallback"); len(backends) != 0 {
+		t.Fatalf("got backends %+v before the Endpoints are known, want none", backends)
+	}
+
+	store.Add(&corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "fallback"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{
+				{IP: "172.17.0.2", TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "fallback-0"}},
+				{IP: "172.17.0.3", TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "fallback-1"}},
+			},
+			Ports: []corev1.EndpointPort{{Name: "metrics", Port: 9090}, {Name: "http", Port: 8080}},
+		}},
+	})
+
+	backends := serviceBackends("web--http", "default/fallback", "http", "fallback")
+	if len(backends) != 2 {
+		t.Fatalf("got backends %+v, want 2 backends", backends)
+	}
+	for _, backend := range backends {
+		if backend.Port == nil || *backend.Port != 8080 {
+			t.Fatalf("got backend %+v, want the port of the ServicePort with the same name", backend)
+		}
+	}
+
+	// Compact farms keep the destination port
+	for _, backend := range serviceBackends("web", "default/fallback", "", "fallback") {
+		if backend.Port != nil {
+			t.Fatalf("got backend %+v, want it without port", backend)
+		}
+	}
+}
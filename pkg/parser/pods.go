@@ -0,0 +1,353 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/zevenet/kube-nftlb/pkg/events"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/processor"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// podBackend is a backend made for a Pod (without Pod settings), it's kept to update that backend when the Pod changes.
+type podBackend struct {
+	pod      string
+	nodeName string // Node of its EndpointAddress, if it's set
+	backend  types.Backend
+}
+
+// podData stores what kube-nftlb needs from a Pod to make its backends.
+type podData struct {
+	settings  map[string]string
+	resets    map[string]string // Default values of settings removed by the last change, so nftlb doesn't keep them
+	resources resources
+	nodeName  string
+	gateReady bool // It has the readiness gate of kube-nftlb and its containers are ready
+}
+
+var (
+	// It locks every map of this file and weights.go
+	podsMutex sync.RWMutex
+
+	// Map [Pod (namespace/name)] to { settings read from annotations, resources }
+	podsData = make(map[string]podData)
+
+	// Map [farm (name)] to []{ backends made for Pods }, it's read by the Pod and Node controllers
+	podBackendsPerFarm = make(map[string][]podBackend)
+)
+
+// SetPod reads backend settings from the annotations of a Pod, and the resources that it requests.
+// It returns true if they have changed.
+func SetPod(pod *corev1.Pod) bool {
+	settings := make(map[string]string)
+	for key, value := range pod.Annotations {
+		if !validation.IsPodAnnotation(key) {
+			continue
+		}
+
+		// Invalid values are ignored, so the nftlb default value is kept
+		if errs := validation.PodAnnotation(key, value); len(errs) > 0 {
+			log.WriteLog(types.ErrorLog, fmt.Sprintf("SetPod: Pod name: %s\n%s", pod.Name, errs.ToAggregate().Error()))
+			events.Warning(pod, "InvalidAnnotation", fmt.Sprintf("%s, the default value will be used", errs.ToAggregate().Error()))
+			continue
+		}
+		settings[strings.TrimPrefix(key, validation.PodAnnotationPrefix)] = value
+	}
+
+	data := podData{
+		settings:  settings,
+		resources: podResources(pod),
+		nodeName:  pod.Spec.NodeName,
+		gateReady: PodGateReady(pod),
+	}
+	key := podKey(pod.Namespace, pod.Name)
+
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	oldData, exists := podsData[key]
+	data.resets = podResets(oldData, settings)
+	podsData[key] = data
+
+	// Backends of this Pod are drained (or back to normal) when its state annotation changes
+	oldState, newState := podState(oldData), podState(data)
+	if oldState != newState {
+		events.Normal(pod, "BackendStateChanged", fmt.Sprintf("backends of this Pod are %s (they were %s)", newState, oldState))
+	}
+
+	return !exists || !reflect.DeepEqual(oldData, data)
+}
+
+// podResets returns the default value of every setting that a Pod doesn't have anymore. Settings that were never set
+// aren't sent, so nftlb keeps its own default value.
+func podResets(oldData podData, settings map[string]string) map[string]string {
+	if reflect.DeepEqual(oldData.settings, settings) {
+		return oldData.resets
+	}
+
+	resets := make(map[string]string)
+	for name, value := range processor.PodDefaults() {
+		if _, removed := oldData.settings[name]; removed {
+			if _, ok := settings[name]; !ok {
+				resets[name] = value
+			}
+		}
+	}
+	return resets
+}
+
+// podState returns the state of the backends made for a Pod.
+func podState(data podData) string {
+	if state, ok := data.settings["state"]; ok {
+		return state
+	}
+	return string(types.StateUp)
+}
+
+// DeletePod forgets backend settings and resources of a deleted Pod.
+func DeletePod(pod *corev1.Pod) {
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	delete(podsData, podKey(pod.Namespace, pod.Name))
+}
+
+// PodAsNftlb returns a Nftlb struct with every backend made for a Pod and its current settings, so only those
+// backends are updated. Every backend of a farm with automatic weights or topology priorities is returned, because
+// the weights and priorities of the other backends depend on this Pod.
+func PodAsNftlb(pod *corev1.Pod) *types.Nftlb {
+	key := podKey(pod.Namespace, pod.Name)
+
+	return podBackendsAsNftlb(func(farmName string, podBackend podBackend) bool {
+		return podBackend.pod == key
+	})
+}
+
+// podBackendsAsNftlb returns a Nftlb struct with backends that match a filter and their current settings. Settings
+// removed from a Pod go back to their default value.
+func podBackendsAsNftlb(match func(string, podBackend) bool) *types.Nftlb {
+	nftlb := &types.Nftlb{
+		Farms: make([]types.Farm, 0),
+	}
+
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	for farmName, podBackends := range podBackendsPerFarm {
+		matches := false
+		for _, podBackend := range podBackends {
+			if match(farmName, podBackend) {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		weights := autoWeightsLocked(farmName)
+		priorities := topologyPrioritiesLocked(farmName)
+		farm := types.Farm{
+			Name:     farmName,
+			Backends: make([]types.Backend, 0),
+		}
+
+		for _, podBackend := range podBackends {
+			_, auto := weights[podBackend.pod]
+			_, topology := priorities[podBackend.pod]
+			if !auto && !topology && !match(farmName, podBackend) {
+				continue
+			}
+
+			backend := podBackend.backend
+			applyPodSettingsLocked(farmName, &backend, podBackend.pod, weights, priorities)
+			farm.Backends = append(farm.Backends, backend)
+		}
+
+		nftlb.Farms = append(nftlb.Farms, farm)
+	}
+
+	return nftlb
+}
+
+// trackPodBackends returns backends made for Pods. The backend at every index is made from the EndpointAddress at
+// the same index.
+func trackPodBackends(backends []types.Backend, epAddresses []corev1.EndpointAddress, namespace string) []podBackend {
+	podBackends := make([]podBackend, 0, len(backends))
+	for index := range backends {
+		targetRef := epAddresses[index].TargetRef
+		if targetRef == nil || targetRef.Kind != "Pod" {
+			continue
+		}
+
+		podNamespace := namespace
+		if targetRef.Namespace != "" {
+			podNamespace = targetRef.Namespace
+		}
+
+		var nodeName string
+		if epAddresses[index].NodeName != nil {
+			nodeName = *epAddresses[index].NodeName
+		}
+
+		podBackends = append(podBackends, podBackend{
+			pod:      podKey(podNamespace, targetRef.Name),
+			nodeName: nodeName,
+			backend:  backends[index],
+		})
+	}
+	return podBackends
+}
+
+// setPodBackends keeps backends made for Pods in a farm of an Endpoints object (namespace/name), instead of the
+// backends kept before. New backends begin their slow start if the farm has one, and backends that have left begin
+// their drain if the farm has a drain timeout.
+func setPodBackends(farmName string, endpointsKey string, podBackends []podBackend) {
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	oldBackends := make(map[string]types.Backend)
+	for _, podBackend := range podBackendsPerFarm[farmName] {
+		oldBackends[podBackend.backend.Name] = podBackend.backend
+	}
+
+	newBackends := make(map[string]bool)
+	for _, podBackend := range podBackends {
+		newBackends[podBackend.backend.Name] = true
+	}
+
+	// Backends that have left don't have an automatic weight, a topology priority or a slow start anymore
+	for backendName, backend := range oldBackends {
+		if !newBackends[backendName] {
+			deleteAutoWeightMetric(farmName, backendName)
+			deleteTopologyMetric(farmName, backendName)
+			deleteBackendStateMetric(farmName, backendName)
+			stopSlowStartLocked(farmName, backendName)
+			if !startDrainLocked(farmName, endpointsKey, backend) {
+				cleanBackend(farmName, backend)
+			}
+		}
+	}
+
+	for backendName := range newBackends {
+		if _, ok := oldBackends[backendName]; ok {
+			continue
+		}
+
+		// Backends that come back while they're draining never left, so they don't begin a slow start
+		if isDrainingLocked(farmName, backendName) {
+			stopDrainLocked(farmName, backendName, DrainCancelled)
+			continue
+		}
+
+		// Backends that have joined begin their slow start, unless the farm didn't have backends (nothing to protect)
+		if len(oldBackends) > 0 {
+			startSlowStartLocked(farmName, backendName)
+		}
+	}
+
+	podBackendsPerFarm[farmName] = podBackends
+	setHealthTargets(farmName, podBackends)
+}
+
+// deletePodBackends forgets backends made for Pods in a farm.
+func deletePodBackends(farmName string) {
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	deletePodBackendsLocked(farmName)
+}
+
+func deletePodBackendsLocked(farmName string) {
+	for _, podBackend := range podBackendsPerFarm[farmName] {
+		deleteAutoWeightMetric(farmName, podBackend.backend.Name)
+		deleteTopologyMetric(farmName, podBackend.backend.Name)
+		deleteBackendStateMetric(farmName, podBackend.backend.Name)
+		stopSlowStartLocked(farmName, podBackend.backend.Name)
+		cleanBackend(farmName, podBackend.backend)
+	}
+	for backendName := range drains[farmName] {
+		stopDrainLocked(farmName, backendName, "")
+	}
+	delete(podBackendsPerFarm, farmName)
+	HealthChecker.DeleteTargets(farmName)
+}
+
+// applyPodSettings sets backend settings read from Pods (automatic weights, topology priorities and Pod annotations)
+// to every backend of a farm. Backends made for Pods must be kept before.
+func applyPodSettings(farmName string, backends []types.Backend) {
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	// Map [backend (name)] to { Pod (namespace/name) }
+	podPerBackend := make(map[string]string)
+	for _, podBackend := range podBackendsPerFarm[farmName] {
+		podPerBackend[podBackend.backend.Name] = podBackend.pod
+	}
+
+	weights := autoWeightsLocked(farmName)
+	priorities := topologyPrioritiesLocked(farmName)
+	for index := range backends {
+		if key, ok := podPerBackend[backends[index].Name]; ok {
+			applyPodSettingsLocked(farmName, &backends[index], key, weights, priorities)
+		}
+	}
+}
+
+// applyPodSettingsLocked sets the default value of settings removed from the Pod, then the automatic weight and
+// topology priority of a backend (if any), then settings read from Pod annotations, then the weight of its slow start
+// (if any), and then its state if its health check fails.
+func applyPodSettingsLocked(farmName string, backend *types.Backend, key string, weights map[string]types.Number, priorities map[string]types.Number) {
+	processor.ApplyBackend(backend, podsData[key].resets)
+	if weight, ok := weights[key]; ok {
+		backend.Weight = types.NewNumber(uint32(weight))
+	}
+	if priority, ok := priorities[key]; ok {
+		backend.Priority = types.NewNumber(uint32(priority))
+	}
+	processor.ApplyBackend(backend, podsData[key].settings)
+	applySlowStartLocked(farmName, backend, key)
+	applyHealth(farmName, backend)
+	setBackendStateMetric(farmName, backend)
+}
+
+// setFarmSettings keeps settings of a farm made for a Service that are applied to its backends.
+func setFarmSettings(farm *types.Farm, service *corev1.Service, annotations *types.Annotations) {
+	setAutoWeight(farm.Name, annotations.Settings[processor.AutoWeightSetting])
+	setTopology(farm.Name, annotations.Settings[processor.TopologySetting], annotations.Settings[processor.TopologyMinLocalSetting])
+	setSlowStart(farm.Name, farmSlowStart(farm, service, annotations))
+	setHealthCheck(farm.Name, annotations)
+	setDrainTimeout(farm.Name, annotations.Settings[processor.DrainTimeoutSetting])
+}
+
+// deleteFarmSettings forgets settings of a deleted farm that are applied to its backends.
+func deleteFarmSettings(farmName string) {
+	setAutoWeight(farmName, "none")
+	setTopology(farmName, "none", "")
+	setSlowStart(farmName, "0s")
+	HealthChecker.SetCheck(farmName, nil)
+	setDrainTimeout(farmName, "0s")
+	deleteNoEndpoints(farmName)
+}
+
+// podReference returns a Pod with only the namespace and name of a Pod key, so Events can be recorded in it.
+func podReference(key string) *corev1.Pod {
+	namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+}
+
+// podKey returns the key of a Pod (namespace/name).
+func podKey(namespace string, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newPod returns a Pod with kube-nftlb annotations (without prefix).
+func newPod(name string, settings map[string]string) *corev1.Pod {
+	annotations := make(map[string]string, len(settings))
+	for name, value := range settings {
+		annotations[validation.PodAnnotationPrefix+name] = value
+	}
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Annotations: annotations}}
+}
+
+// newPodEndpoints returns Endpoints with 1 port, and an EndpointAddress for every Pod (at 10.1.0.1, 10.1.0.2...).
+func newPodEndpoints(name string, pods ...string) *corev1.Endpoints {
+	subset := corev1.EndpointSubset{Ports: []corev1.EndpointPort{{Name: "http", Port: 8080}}}
+	for index, pod := range pods {
+		subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{
+			IP:        fmt.Sprintf("10.1.0.%d", index+1),
+			TargetRef: &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: pod},
+		})
+	}
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Subsets:    []corev1.EndpointSubset{subset},
+	}
+}
+
+func TestSetPod(t *testing.T) {
+	defer DeletePod(newPod("pod-a", nil))
+
+	if !SetPod(newPod("pod-a", map[string]string{"weight": "5", "priority": "0", "mark": "0x10"})) {
+		t.Fatal("new Pod: got unchanged")
+	}
+
+	// Invalid settings are ignored
+	want := map[string]string{"weight": "5", "mark": "0x10"}
+	if settings := podsData["default/pod-a"].settings; len(settings) != len(want) || settings["weight"] != "5" || settings["mark"] != "0x10" {
+		t.Fatalf("got settings %v, want %v", settings, want)
+	}
+
+	if SetPod(newPod("pod-a", map[string]string{"weight": "5", "mark": "0x10", "other": "1"})) {
+		t.Fatal("same settings: got changed")
+	}
+	if resets := podsData["default/pod-a"].resets; len(resets) != 0 {
+		t.Fatalf("got resets %v, want none", resets)
+	}
+	if !SetPod(newPod("pod-a", nil)) {
+		t.Fatal("removed settings: got unchanged")
+	}
+
+	// Removed settings go back to their default value, and they're kept until the settings change again
+	want = map[string]string{"weight": "1", "mark": "0x0"}
+	if resets := podsData["default/pod-a"].resets; len(resets) != len(want) || resets["weight"] != "1" || resets["mark"] != "0x0" {
+		t.Fatalf("got resets %v, want %v", resets, want)
+	}
+	if SetPod(newPod("pod-a", nil)) {
+		t.Fatal("no settings: got changed")
+	}
+	if resets := podsData["default/pod-a"].resets; len(resets) != len(want) {
+		t.Fatalf("no settings: got resets %v, want %v", resets, want)
+	}
+}
+
+func TestPodSettingsAsBackends(t *testing.T) {
+	defer DeletePod(newPod("pod-a", nil))
+	defer deletePodBackends("web--http")
+	defer delete(backendsPerFarm, "web--http")
+
+	SetPod(newPod("pod-a", map[string]string{"weight": "5", "priority": "2"}))
+
+	// Settings are applied to the backends of the Pod
+	nftlb := EndpointsAsNftlb(newPodEndpoints("web", "pod-a", "pod-b"))
+	if len(nftlb.Farms) != 1 || len(nftlb.Farms[0].Backends) != 2 {
+		t.Fatalf("got farms %+v, want 1 farm with 2 backends", nftlb.Farms)
+	}
+	if backend := nftlb.Farms[0].Backends[0]; formatNumber(backend.Weight) != "5" || formatNumber(backend.Priority) != "2" {
+		t.Fatalf("pod-a: got backend %+v, want weight 5 and priority 2", backend)
+	}
+	if backend := nftlb.Farms[0].Backends[1]; backend.Weight != nil || backend.Priority != nil {
+		t.Fatalf("pod-b: got backend %+v, want nftlb defaults", backend)
+	}
+
+	// When the Pod changes, only its backends are updated, and removed settings go back to their default value (settings
+	// that were never set aren't sent)
+	SetPod(newPod("pod-a", map[string]string{"weight": "3"}))
+	nftlb = PodAsNftlb(newPod("pod-a", nil))
+	if len(nftlb.Farms) != 1 || len(nftlb.Farms[0].Backends) != 1 {
+		t.Fatalf("got farms %+v, want 1 farm with the backend of pod-a", nftlb.Farms)
+	}
+	backend := nftlb.Farms[0].Backends[0]
+	if backend.Name != "pod-a--http" || formatNumber(backend.Weight) != "3" || formatNumber(backend.Priority) != "1" || backend.Mark != nil {
+		t.Fatalf("got backend %+v, want pod-a--http with weight 3, default priority and without mark", backend)
+	}
+
+	// Backends of deleted Endpoints aren't updated
+	farmsPerService["web"] = []string{"web--http"}
+	defer delete(farmsPerService, "web")
+	pathsChan := make(chan string)
+	go EndpointsAsPaths(newPodEndpoints("web"), pathsChan)
+	for range pathsChan {
+	}
+	if nftlb := PodAsNftlb(newPod("pod-a", nil)); len(nftlb.Farms) != 0 {
+		t.Fatalf("got farms %+v, want none", nftlb.Farms)
+	}
+}
+
+// formatNumber returns an optional number as it's sent to nftlb, or an empty string if it's omitted.
+func formatNumber(number *types.Number) string {
+	if number == nil {
+		return ""
+	}
+	return number.String()
+}
@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	// It locks every map of this file
+	readinessMutex sync.Mutex
+
+	// Map [Endpoints (namespace/name)] to [Pod (namespace/name)] to { it's a not ready address }
+	notReadyPodsPerEndpoints = make(map[string]map[string]bool)
+
+	// Map [Endpoints (namespace/name)] to [Pod (namespace/name)] to { Pod UID }, for gated Pods added as backends by
+	// the last change of every Endpoints
+	pendingPods = make(map[string]map[string]string)
+
+	// Map [Endpoints (namespace/name)] to [Pod (namespace/name)] to { Pod UID }, for gated Pods whose backends have
+	// been programmed
+	programmedPods = make(map[string]map[string]string)
+
+	// The report of programmed Pods has changed since it was read
+	programmedPodsChanged bool
+)
+
+// PodGateReady returns true if a Pod has the readiness gate of kube-nftlb and its containers are ready, so its
+// backends can be programmed before the Pod is Ready.
+func PodGateReady(pod *corev1.Pod) bool {
+	if !config.ReadinessGates || pod.DeletionTimestamp != nil || !hasReadinessGate(pod) {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.ContainersReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// PodProgrammed returns true if the readiness gate of kube-nftlb is True in a Pod.
+func PodProgrammed(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == types.ProgrammedCondition {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// NotReadyEndpoints returns every Endpoints (namespace/name) where a Pod is a not ready address, so they're applied
+// again when the readiness of its containers changes.
+func NotReadyEndpoints(pod *corev1.Pod) []string {
+	key := podKey(pod.Namespace, pod.Name)
+
+	readinessMutex.Lock()
+	defer readinessMutex.Unlock()
+
+	endpoints := make([]string, 0)
+	for endpointsKey, pods := range notReadyPodsPerEndpoints {
+		if pods[key] {
+			endpoints = append(endpoints, endpointsKey)
+		}
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+// SetEndpointsProgrammed keeps that the backends of an Endpoints object have been programmed, so its gated Pods are
+// reported as programmed by this node.
+func SetEndpointsProgrammed(endpoints *corev1.Endpoints) {
+	key := podKey(endpoints.Namespace, endpoints.Name)
+
+	readinessMutex.Lock()
+	defer readinessMutex.Unlock()
+
+	if len(programmedPods[key]) == 0 && len(pendingPods[key]) == 0 || reflect.DeepEqual(programmedPods[key], pendingPods[key]) {
+		return
+	}
+	if len(pendingPods[key]) == 0 {
+		delete(programmedPods, key)
+	} else {
+		programmedPods[key] = pendingPods[key]
+	}
+	programmedPodsChanged = true
+}
+
+// ProgrammedPodsReport returns every gated Pod programmed by this node, as the data of its report (namespace.name to
+// Pod UID), and true if it has changed since the last time it was read. Pods that are backends of several Services
+// are only reported when every Endpoints has been programmed.
+func ProgrammedPodsReport() (map[string]string, bool) {
+	readinessMutex.Lock()
+	defer readinessMutex.Unlock()
+
+	report := make(map[string]string)
+	for _, pods := range programmedPods {
+		for key, uid := range pods {
+			report[ReportKey(key)] = uid
+		}
+	}
+	for endpointsKey, pods := range pendingPods {
+		for key, uid := range pods {
+			if programmedPods[endpointsKey][key] != uid {
+				delete(report, ReportKey(key))
+			}
+		}
+	}
+
+	changed := programmedPodsChanged
+	programmedPodsChanged = false
+	return report, changed
+}
+
+// ReportKey returns the key of a Pod (namespace/name) in the reports of programmed Pods. ConfigMap keys can't have
+// slashes, and namespaces can't have dots.
+func ReportKey(key string) string {
+	return strings.Replace(key, "/", ".", 1)
+}
+
+// withGatedAddresses returns a copy of an Endpoints object where gated Pods with ready containers are ready
+// addresses, so their backends are programmed before the Pods are Ready. Endpoints without them aren't copied.
+func withGatedAddresses(endpoints *corev1.Endpoints) *corev1.Endpoints {
+	if !config.ReadinessGates {
+		return endpoints
+	}
+	key := podKey(endpoints.Namespace, endpoints.Name)
+
+	notReadyPods := make(map[string]bool)
+	pods := make(map[string]string)
+	gated := endpoints
+	for idxSubset, subset := range endpoints.Subsets {
+		for _, epAddress := range subset.NotReadyAddresses {
+			targetRef := epAddress.TargetRef
+			if targetRef == nil || targetRef.Kind != "Pod" {
+				continue
+			}
+
+			podNamespace := endpoints.Namespace
+			if targetRef.Namespace != "" {
+				podNamespace = targetRef.Namespace
+			}
+			pod := podKey(podNamespace, targetRef.Name)
+			notReadyPods[pod] = true
+
+			podsMutex.RLock()
+			gateReady := podsData[pod].gateReady
+			podsMutex.RUnlock()
+			if !gateReady {
+				continue
+			}
+
+			if gated == endpoints {
+				gated = endpoints.DeepCopy()
+			}
+			gated.Subsets[idxSubset].Addresses = append(gated.Subsets[idxSubset].Addresses, epAddress)
+			pods[pod] = string(targetRef.UID)
+		}
+	}
+
+	readinessMutex.Lock()
+	defer readinessMutex.Unlock()
+
+	if len(notReadyPods) == 0 {
+		delete(notReadyPodsPerEndpoints, key)
+	} else {
+		notReadyPodsPerEndpoints[key] = notReadyPods
+	}
+	if len(pods) > 0 || len(pendingPods[key]) > 0 {
+		programmedPodsChanged = programmedPodsChanged || !reflect.DeepEqual(pendingPods[key], pods)
+	}
+	pendingPods[key] = pods
+
+	return gated
+}
+
+// deleteEndpointsReadiness forgets gated Pods of a deleted Endpoints object.
+func deleteEndpointsReadiness(endpoints *corev1.Endpoints) {
+	key := podKey(endpoints.Namespace, endpoints.Name)
+
+	readinessMutex.Lock()
+	defer readinessMutex.Unlock()
+
+	delete(notReadyPodsPerEndpoints, key)
+	delete(pendingPods, key)
+	if _, ok := programmedPods[key]; ok {
+		delete(programmedPods, key)
+		programmedPodsChanged = true
+	}
+}
+
+// hasReadinessGate returns true if a Pod has the readiness gate of kube-nftlb.
+func hasReadinessGate(pod *corev1.Pod) bool {
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == types.ProgrammedCondition {
+			return true
+		}
+	}
+	return false
+}
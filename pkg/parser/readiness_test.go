@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+// gatedPod returns a Pod with the readiness gate of kube-nftlb, its containers are ready or not.
+func gatedPod(name string, containersReady bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if containersReady {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: k8stypes.UID(name + "-uid")},
+		Spec:       corev1.PodSpec{ReadinessGates: []corev1.PodReadinessGate{{ConditionType: types.ProgrammedCondition}}},
+		Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.ContainersReady, Status: status}}},
+	}
+}
+
+// notReadyEndpoints returns Endpoints where every Pod is a not ready address.
+func notReadyEndpoints(name string, pods ...string) *corev1.Endpoints {
+	subset := corev1.EndpointSubset{Ports: []corev1.EndpointPort{{Name: "http", Port: 8080}}}
+	for _, pod := range pods {
+		subset.NotReadyAddresses = append(subset.NotReadyAddresses, corev1.EndpointAddress{
+			IP:        "10.1.0.1",
+			TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: pod, UID: k8stypes.UID(pod + "-uid")},
+		})
+	}
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Subsets:    []corev1.EndpointSubset{subset},
+	}
+}
+
+func TestPodGateReady(t *testing.T) {
+	config.ReadinessGates = true
+	defer func() { config.ReadinessGates = false }()
+
+	deleted := gatedPod("web-0", true)
+	deleted.DeletionTimestamp = &metav1.Time{}
+	withoutGate := gatedPod("web-0", true)
+	withoutGate.Spec.ReadinessGates = nil
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want bool
+	}{
+		{"containers ready", gatedPod("web-0", true), true},
+		{"containers not ready", gatedPod("web-0", false), false},
+		{"deleted", deleted, false},
+		{"without readiness gate", withoutGate, false},
+	}
+
+	for _, test := range tests {
+		if got := PodGateReady(test.pod); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+
+	config.ReadinessGates = false
+	if PodGateReady(gatedPod("web-0", true)) {
+		t.Fatal("readiness gates disabled: got true, want false")
+	}
+}
+
+func TestProgrammedPodsReport(t *testing.T) {
+	config.ReadinessGates = true
+	defer func() { config.ReadinessGates = false }()
+
+	SetPod(gatedPod("web-0", true))
+	SetPod(gatedPod("web-1", false))
+	defer DeletePod(gatedPod("web-0", true))
+	defer DeletePod(gatedPod("web-1", false))
+
+	web := notReadyEndpoints("web", "web-0", "web-1")
+	admin := notReadyEndpoints("admin", "web-0")
+	defer deleteEndpointsReadiness(web)
+	defer deleteEndpointsReadiness(admin)
+	ProgrammedPodsReport()
+
+	// Only gated Pods with ready containers are ready addresses
+	gated := withGatedAddresses(web)
+	if addresses := gated.Subsets[0].Addresses; len(addresses) != 1 || addresses[0].TargetRef.Name != "web-0" {
+		t.Fatalf("got addresses %+v, want only web-0", addresses)
+	}
+	if len(web.Subsets[0].Addresses) != 0 {
+		t.Fatal("got the Endpoints changed, want a copy")
+	}
+	if endpoints := NotReadyEndpoints(gatedPod("web-1", false)); !reflect.DeepEqual(endpoints, []string{"default/web"}) {
+		t.Fatalf("got Endpoints %v, want default/web", endpoints)
+	}
+
+	// Pods aren't reported until their backends are programmed
+	if report, changed := ProgrammedPodsReport(); len(report) != 0 || !changed {
+		t.Fatalf("got report %v (changed %t), want an empty changed report", report, changed)
+	}
+	SetEndpointsProgrammed(web)
+	report, changed := ProgrammedPodsReport()
+	if want := map[string]string{"default.web-0": "web-0-uid"}; !reflect.DeepEqual(report, want) || !changed {
+		t.Fatalf("got report %v (changed %t), want %v changed", report, changed, want)
+	}
+	if _, changed := ProgrammedPodsReport(); changed {
+		t.Fatal("got the report changed, want it unchanged")
+	}
+
+	// Pods that are backends of several Services are reported when every Endpoints has been programmed
+	withGatedAddresses(admin)
+	if report, _ := ProgrammedPodsReport(); len(report) != 0 {
+		t.Fatalf("got report %v, want web-0 pending in admin", report)
+	}
+	SetEndpointsProgrammed(admin)
+	if report, _ := ProgrammedPodsReport(); report["default.web-0"] != "web-0-uid" {
+		t.Fatalf("got report %v, want web-0", report)
+	}
+
+	// Pods of deleted Endpoints aren't reported anymore
+	deleteEndpointsReadiness(web)
+	deleteEndpointsReadiness(admin)
+	if report, changed := ProgrammedPodsReport(); len(report) != 0 || !changed {
+		t.Fatalf("got report %v (changed %t), want an empty changed report", report, changed)
+	}
+}
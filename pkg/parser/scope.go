@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/processor"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"k8s.io/apimachinery/pkg/labels"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	// It locks every map of this file
+	scopeMutex sync.Mutex
+
+	// Map [Service (namespace/name)] to { its farms aren't programmed in this node }
+	skippedServices = make(map[string]bool)
+
+	// Map [farm (name)] to { it isn't programmed in this node }, only for farms of ServicePorts with their own node
+	// selector when the rest of the Service is programmed
+	skippedFarms = make(map[string]bool)
+
+	// Map [Service (namespace/name)] to []{ farms (names) skipped by the node selector of their ServicePort }
+	skippedFarmsPerService = make(map[string][]string)
+
+	// Map [Service (namespace/name)] to { node selector }, only for node-scoped Services (any ServicePort can have its
+	// own node selector)
+	nodeSelectorPerService = make(map[string]string)
+)
+
+// NodeScopedServices returns every Service (namespace/name) with a node selector, so they're applied again when labels
+// of this node change.
+func NodeScopedServices() []string {
+	scopeMutex.Lock()
+	defer scopeMutex.Unlock()
+
+	services := make([]string, 0, len(nodeSelectorPerService))
+	for service := range nodeSelectorPerService {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services
+}
+
+// serviceInScope returns the ServicePorts whose farms are programmed in this node: they don't have a node selector
+// (set for the Service or for that port), or the labels of this node match it. Every address of a farm (ClusterIP,
+// NodePort, externalIPs and LoadBalancer IPs) is programmed or none is. It returns an empty slice if no farm of the
+// Service is programmed in this node.
+func serviceInScope(service *corev1.Service, annotations *types.Annotations) []corev1.ServicePort {
+	key := podKey(service.Namespace, service.Name)
+
+	selectors := make([]string, 0)
+	ports := make([]corev1.ServicePort, 0, len(service.Spec.Ports))
+	skipped := make([]string, 0)
+	for _, servicePort := range service.Spec.Ports {
+		value := annotationsForPort(annotations, &servicePort).Settings[processor.NodeSelectorSetting]
+		if value == "" {
+			ports = append(ports, servicePort)
+			continue
+		}
+		selectors = append(selectors, value)
+
+		// The node selector was checked with the annotations
+		selector, _ := labels.Parse(value)
+		if LocalNodeMatches(selector) {
+			ports = append(ports, servicePort)
+			continue
+		}
+		log.WriteLog(types.DetailedLog, fmt.Sprintf("serviceInScope: Service name: %s, port: %s\nNode %s doesn't match the node selector %q", service.Name, servicePort.Name, config.NodeName, value))
+		skipped = append(skipped, FormatName(service.Name, servicePort.Name))
+	}
+
+	scopeMutex.Lock()
+	defer scopeMutex.Unlock()
+
+	if len(selectors) > 0 {
+		nodeSelectorPerService[key] = strings.Join(selectors, "; ")
+	} else {
+		delete(nodeSelectorPerService, key)
+	}
+
+	deleteSkippedFarmsLocked(key)
+	if len(ports) == 0 {
+		skippedServices[key] = true
+		return ports
+	}
+	delete(skippedServices, key)
+	for _, farmName := range skipped {
+		skippedFarms[farmName] = true
+	}
+	if len(skipped) > 0 {
+		skippedFarmsPerService[key] = skipped
+	}
+	return ports
+}
+
+// skipService keeps that the farms of a Service aren't programmed in this node.
+func skipService(service *corev1.Service) {
+	scopeMutex.Lock()
+	defer scopeMutex.Unlock()
+
+	key := podKey(service.Namespace, service.Name)
+	deleteSkippedFarmsLocked(key)
+	skippedServices[key] = true
+}
+
+// serviceSkipped returns true if the farms of a Service (namespace/name) aren't programmed in this node, so backends
+// aren't programmed either.
+func serviceSkipped(key string) bool {
+	scopeMutex.Lock()
+	defer scopeMutex.Unlock()
+
+	return skippedServices[key]
+}
+
+// farmSkipped returns true if a farm isn't programmed in this node by the node selector of its ServicePort, so its
+// backends aren't programmed either.
+func farmSkipped(farmName string) bool {
+	scopeMutex.Lock()
+	defer scopeMutex.Unlock()
+
+	return skippedFarms[farmName]
+}
+
+// deleteServiceScope forgets the scope of a deleted Service.
+func deleteServiceScope(service *corev1.Service) {
+	scopeMutex.Lock()
+	defer scopeMutex.Unlock()
+
+	key := podKey(service.Namespace, service.Name)
+	delete(skippedServices, key)
+	deleteSkippedFarmsLocked(key)
+	delete(nodeSelectorPerService, key)
+}
+
+// deleteSkippedFarmsLocked forgets the farms of a Service skipped by the node selectors of their ServicePorts.
+func deleteSkippedFarmsLocked(key string) {
+	for _, farmName := range skippedFarmsPerService[key] {
+		delete(skippedFarms, farmName)
+	}
+	delete(skippedFarmsPerService, key)
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/processor"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServiceInScope(t *testing.T) {
+	SetLocalNode(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: config.NodeName, Labels: map[string]string{"role": "ingress"}}})
+
+	newService := func(namespace string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "web"},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80},
+				{Name: "admin", Port: 8080},
+			}},
+		}
+	}
+	annotations := &types.Annotations{
+		Settings: map[string]string{},
+		Ports: map[string]map[string]string{
+			"admin": {processor.NodeSelectorSetting: "role=dmz"},
+		},
+	}
+
+	// Only the farm of the port with a node selector that doesn't match is skipped
+	service := newService("default")
+	defer deleteServiceScope(service)
+	ports := serviceInScope(service, annotations)
+	if len(ports) != 1 || ports[0].Name != "http" {
+		t.Fatalf("got ports %+v, want only http", ports)
+	}
+	if serviceSkipped("default/web") || farmSkipped("web--http") || !farmSkipped("web--admin") {
+		t.Fatal("got the wrong farms skipped, want only web--admin")
+	}
+	if scoped := NodeScopedServices(); len(scoped) != 1 || scoped[0] != "default/web" {
+		t.Fatalf("got node-scoped Services %v, want default/web", scoped)
+	}
+
+	// Services with the same name in other namespaces are independent
+	other := newService("staging")
+	defer deleteServiceScope(other)
+	annotations.Settings[processor.NodeSelectorSetting] = "role=dmz"
+	if ports := serviceInScope(other, annotations); len(ports) != 0 {
+		t.Fatalf("got ports %+v, want none", ports)
+	}
+	if !serviceSkipped("staging/web") || serviceSkipped("default/web") {
+		t.Fatal("got the wrong Services skipped, want only staging/web")
+	}
+
+	// Ports without their own node selector use the one of the Service
+	delete(annotations.Ports, "admin")
+	annotations.Ports["http"] = map[string]string{processor.NodeSelectorSetting: "role=ingress"}
+	if ports := serviceInScope(service, annotations); len(ports) != 1 || ports[0].Name != "http" {
+		t.Fatalf("got ports %+v, want only http", ports)
+	}
+
+	deleteServiceScope(service)
+	if farmSkipped("web--admin") {
+		t.Fatal("got web--admin skipped after its Service was deleted")
+	}
+}
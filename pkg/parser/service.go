@@ -7,8 +7,12 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/conntrack"
 	"github.com/zevenet/kube-nftlb/pkg/dsr"
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+	"github.com/zevenet/kube-nftlb/pkg/processor"
 	"github.com/zevenet/kube-nftlb/pkg/types"
 
 	corev1 "k8s.io/api/core/v1"
@@ -28,23 +32,55 @@ func ServiceAsPaths(service *corev1.Service, pathChan chan<- string) {
 
 		// Remove from memory addresses names mapped to this farm
 		delete(addressesPerFarm, farmName)
+
+		deleteFarmMetrics(service, farmName)
+		deleteFarmStateMetric(service, farmName)
+		deleteFarmSettings(farmName)
+
+		// VIPs are used to delete conntrack entries of its backends
+		delete(vipsPerFarm, farmName)
 	}
 
 	// Remove from memory farm names mapped to this Service
 	delete(farmsPerService, service.Name)
+	delete(compactFarmPerService, service.Name)
+
+	// VIPs are kept until the Service is deleted (ReleaseVIPs) or parsed again, so Services waiting for them aren't
+	// displaced by every update
+	deleteTemplateUser(service)
+	deleteServiceScope(service)
 
 	close(pathChan)
 }
 
+// ReleaseVIPs releases every VIP claimed by a deleted Service, Services that were waiting for them are displaced.
+func ReleaseVIPs(service *corev1.Service) {
+	releaseVIPs(service)
+}
+
 // ServiceAsNftlb analyzes a Service and returns a filled Nftlb struct.
 func ServiceAsNftlb(service *corev1.Service) *types.Nftlb {
-	nftlb := &types.Nftlb{
-		Farms: make([]types.Farm, len(service.Spec.Ports)),
+	// Farms owned by a NftlbFarm are never overridden, the Service is applied again when they're released
+	if nftlbFarmConflict(service) != "" {
+		skipService(service)
+		releaseVIPs(service)
+		return &types.Nftlb{}
 	}
 
 	// Read the annotations collected in the "annotations" field of the service
 	annotations := getAnnotations(service)
 
+	// Node-scoped Services (or ServicePorts) are only programmed in nodes that match their node selector
+	servicePorts := serviceInScope(service, annotations)
+	if len(servicePorts) == 0 {
+		releaseVIPs(service)
+		return &types.Nftlb{}
+	}
+
+	nftlb := &types.Nftlb{
+		Farms: make([]types.Farm, len(servicePorts)),
+	}
+
 	// Read useful values from the Service to be passed to servicePortAsAddress() instead of passing the Service
 	serviceData := &types.ServiceData{
 		Name:        service.Name,
@@ -52,17 +88,41 @@ func ServiceAsNftlb(service *corev1.Service) *types.Nftlb {
 		Type:        string(service.Spec.Type),
 		Family:      findFamily(service),
 		ExternalIPs: service.Spec.ExternalIPs,
+
+		LoadBalancerIPs: loadBalancerIPs(service),
+		SharedKey:       sharedKey(service),
+		VIPConflicts:    claimVIPs(service, servicePorts),
+	}
+
+	// Program every ServicePort as a single farm if it's possible, instead of 1 farm per ServicePort
+	if config.CompactFarms && canCompact(service, servicePorts, annotations) {
+		farm := servicePortsAsFarm(servicePorts, serviceData, annotations)
+		compactAnnotations := annotationsForPort(annotations, &servicePorts[0])
+		applyFarmTemplate(farm, service, compactAnnotations)
+		nftlb.Farms = []types.Farm{*farm}
+		farmsPerService[service.Name] = []string{farm.Name}
+		// Endpoints have every port of the Service, even the ones that aren't programmed in this node
+		compactFarmPerService[service.Name] = compactFarm{
+			name:  farm.Name,
+			ports: len(service.Spec.Ports),
+		}
+		setFarmSettings(farm, service, compactAnnotations)
+		setNoEndpoints(farm, service.Namespace, "", compactAnnotations)
+		nonCriticalPathService(farm, service, 0)
+
+		return nftlb
 	}
+	delete(compactFarmPerService, service.Name)
 
 	// Make wait group to syncronize every ServicePort
 	wg := new(sync.WaitGroup)
-	wg.Add(len(service.Spec.Ports))
+	wg.Add(len(servicePorts))
 
 	// Initialize a farm name slice based on the Service name (this is needed when a Service is deleted)
-	farmsPerService[service.Name] = make([]string, len(service.Spec.Ports))
+	farmsPerService[service.Name] = make([]string, len(servicePorts))
 
 	// 1 ServicePort (k8s) = 1 Farm + 1 Address/Farm (nftlb)
-	for index := range service.Spec.Ports {
+	for index := range servicePorts {
 		// Process all ServicePorts in parallel, using goroutines
 		go func(servicePort *corev1.ServicePort, index int) {
 			// Release lock after this func has finished
@@ -70,45 +130,60 @@ func ServiceAsNftlb(service *corev1.Service) *types.Nftlb {
 
 			// Parse ServicePort as Farm
 			farm := servicePortAsFarm(servicePort, serviceData, annotations)
+			portAnnotations := annotationsForPort(annotations, servicePort)
+			applyFarmTemplate(farm, service, portAnnotations)
 
 			// Set it in the Farms slice
 			nftlb.Farms[index] = *farm
-
-			// Branch out the non critical path (map assignments, DSR mode)
-			go nonCriticalPathService(farm, service, index)
-		}(&service.Spec.Ports[index], index)
+			setFarmSettings(farm, service, portAnnotations)
+			setNoEndpoints(farm, service.Namespace, servicePort.Name, portAnnotations)
+		}(&servicePorts[index], index)
 	}
 
 	// Wait until all locks are released
 	wg.Wait()
 
+	// Map assignments and DSR mode, they're made once every farm is ready so the maps aren't written by several
+	// goroutines at once
+	for index := range nftlb.Farms {
+		nonCriticalPathService(&nftlb.Farms[index], service, index)
+	}
+
 	// Return a filled Nftlb struct
 	return nftlb
 }
 
+// annotationsAsFarm returns a Farm struct (without addresses) filled with settings from annotations.
+func annotationsAsFarm(name string, serviceName string, annotations *types.Annotations) *types.Farm {
+	farm := &types.Farm{
+		Name:      name,
+		Addresses: make([]types.Address, 0),
+	}
+	processor.ApplyFarm(farm, annotations.Settings)
+
+	if farm.Log != "" && farm.Log != types.LogNone {
+		farm.LogPrefix = serviceName
+	}
+	farm.Iface = findIface(farm.Mode)
+
+	return farm
+}
+
 // servicePortAsFarm returns a Farm struct filled with data from a ServicePort and some ServiceData values.
 func servicePortAsFarm(servicePort *corev1.ServicePort, serviceData *types.ServiceData, annotations *types.Annotations) *types.Farm {
-	farm := &types.Farm{
-		Name:         FormatName(serviceData.Name, servicePort.Name),
-		Mode:         annotations.Mode,
-		Persistence:  annotations.Persistence,
-		PersistTTL:   annotations.PersistTTL,
-		Scheduler:    annotations.Scheduler,
-		SchedParam:   annotations.SchedParam,
-		Helper:       annotations.Helper,
-		Log:          annotations.Log,
-		LogPrefix:    annotations.LogPrefix,
-		EstConnlimit: annotations.EstConnlimit,
-		Iface:        annotations.Iface,
-		IntraConnect: "on",
-		State:        "up",
-		Addresses:    make([]types.Address, len(serviceData.ExternalIPs)+1),
+	// Merge settings made for this ServicePort
+	annotations = annotationsForPort(annotations, servicePort)
+	farm := annotationsAsFarm(FormatName(serviceData.Name, servicePort.Name), serviceData.Name, annotations)
+
+	// The helper annotation overrides the automatic helper detection
+	if farm.Helper == "" {
+		farm.Helper = types.Helper(findHelper(servicePort))
 	}
 
 	// ClusterIP address
 	address := types.Address{
 		Family:   serviceData.Family,
-		Protocol: strings.ToLower(string(servicePort.Protocol)),
+		Protocol: types.Protocol(strings.ToLower(string(servicePort.Protocol))),
 	}
 
 	if serviceData.Type == "ClusterIP" {
@@ -123,21 +198,47 @@ func servicePortAsFarm(servicePort *corev1.ServicePort, serviceData *types.Servi
 	}
 
 	// Add address at index 0
-	farm.Addresses[0] = address
+	farm.Addresses = append(farm.Addresses, address)
 
 	// Add externalIPs as addresses
 	for index, externalIP := range serviceData.ExternalIPs {
+		// Skip VIPs owned by an older Service
+		if _, conflict := serviceData.VIPConflicts[formatVIPConflict(externalIP, formatVIPPort(servicePort))]; conflict {
+			continue
+		}
+
 		// Don't override the address at index 0
 		offsetIndex := index + 1
-		farm.Addresses[offsetIndex] = types.Address{
+		address := types.Address{
 			Family:   serviceData.Family,
-			Protocol: strings.ToLower(string(servicePort.Protocol)),
-			Name:     fmt.Sprintf("%s--address", FormatExternalIPName(serviceData.Name, servicePort.Name, offsetIndex)),
+			Protocol: types.Protocol(strings.ToLower(string(servicePort.Protocol))),
 			IPAddr:   externalIP,
 			Ports:    strconv.FormatInt(int64(servicePort.Port), 10),
 		}
+		address.Name = fmt.Sprintf("%s--address", vipAddressName(serviceData, FormatExternalIPName(serviceData.Name, servicePort.Name, offsetIndex), &address))
+		farm.Addresses = append(farm.Addresses, address)
 	}
 
+	// Add LoadBalancer IPs as addresses
+	for index, loadBalancerIP := range serviceData.LoadBalancerIPs {
+		// Skip VIPs owned by an older Service
+		if _, conflict := serviceData.VIPConflicts[formatVIPConflict(loadBalancerIP, formatVIPPort(servicePort))]; conflict {
+			continue
+		}
+
+		address := types.Address{
+			Family:   serviceData.Family,
+			Protocol: types.Protocol(strings.ToLower(string(servicePort.Protocol))),
+			IPAddr:   loadBalancerIP,
+			Ports:    strconv.FormatInt(int64(servicePort.Port), 10),
+		}
+		address.Name = fmt.Sprintf("%s--address", vipAddressName(serviceData, FormatLoadBalancerIPName(serviceData.Name, servicePort.Name, index+1), &address))
+		farm.Addresses = append(farm.Addresses, address)
+	}
+
+	// Address settings are applied once every address has been added
+	processor.ApplyAddresses(farm, annotations.Settings)
+
 	return farm
 }
 
@@ -145,14 +246,19 @@ func nonCriticalPathService(farm *types.Farm, service *corev1.Service, index int
 	// Set farm name in map
 	farmsPerService[service.Name][index] = farm.Name
 
-	// Set addresses names in map
+	// Set addresses names and VIPs in maps
 	addressesPerFarm[farm.Name] = make([]string, len(farm.Addresses))
+	vipsPerFarm[farm.Name] = make([]conntrack.VIP, len(farm.Addresses))
 	for idxAddress, address := range farm.Addresses {
 		addressesPerFarm[farm.Name][idxAddress] = address.Name
+		vipsPerFarm[farm.Name][idxAddress] = conntrack.NewVIP(address.IPAddr, address.Ports, addressProtocolNumber(address.Protocol))
 	}
 
+	setFarmMetrics(farm, service)
+	setFarmState(farm, service)
+
 	// DSR mode
-	if farm.Mode == "dsr" {
+	if farm.Mode == types.ModeDSR {
 		// Enable DSR for future backends (for each backend, an interface is made)
 		dsr.Enable(farm)
 	} else if dsr.IsEnabled(farm) {
@@ -162,15 +268,59 @@ func nonCriticalPathService(farm *types.Farm, service *corev1.Service, index int
 	}
 }
 
-func findFamily(service *corev1.Service) string {
+// setFarmMetrics exports rate limits, TCP strictness and queue of a farm.
+func setFarmMetrics(farm *types.Farm, service *corev1.Service) {
+	labels := []string{service.Namespace, service.Name, farm.Name}
+	tcpStrict := 0.0
+	if farm.TCPStrict == types.SwitchOn {
+		tcpStrict = 1
+	}
+
+	queue := -1.0
+	if farm.Queue != nil {
+		queue = float64(*farm.Queue)
+	}
+
+	metrics.ServicesNewRtlimit.WithLabelValues(labels...).Set(numberMetric(farm.NewRtlimit))
+	metrics.ServicesNewRtlimitBurst.WithLabelValues(labels...).Set(numberMetric(farm.NewRtlimitBurst))
+	metrics.ServicesRstRtlimit.WithLabelValues(labels...).Set(numberMetric(farm.RstRtlimit))
+	metrics.ServicesRstRtlimitBurst.WithLabelValues(labels...).Set(numberMetric(farm.RstRtlimitBurst))
+	metrics.ServicesTCPStrict.WithLabelValues(labels...).Set(tcpStrict)
+	metrics.ServicesQueue.WithLabelValues(labels...).Set(queue)
+}
+
+// deleteFarmMetrics stops exporting metrics of a deleted farm.
+func deleteFarmMetrics(service *corev1.Service, farmName string) {
+	labels := []string{service.Namespace, service.Name, farmName}
+	for _, gaugeVec := range []*prometheus.GaugeVec{
+		metrics.ServicesNewRtlimit,
+		metrics.ServicesNewRtlimitBurst,
+		metrics.ServicesRstRtlimit,
+		metrics.ServicesRstRtlimitBurst,
+		metrics.ServicesTCPStrict,
+		metrics.ServicesQueue,
+	} {
+		gaugeVec.DeleteLabelValues(labels...)
+	}
+}
+
+// numberMetric returns a farm setting as a metric value (0 if it isn't set).
+func numberMetric(number *types.Number) float64 {
+	if number == nil {
+		return 0
+	}
+	return float64(*number)
+}
+
+func findFamily(service *corev1.Service) types.Family {
 	if localhostIP := net.ParseIP(service.Spec.ClusterIP); localhostIP.To4() != nil {
-		return "ipv4"
+		return types.FamilyIPv4
 	}
-	return "ipv6"
+	return types.FamilyIPv6
 }
 
-func findIface(mode string) string {
-	if mode == "dsr" {
+func findIface(mode types.Mode) string {
+	if mode == types.ModeDSR {
 		return config.DockerInterfaceBridge
 	}
 	return ""
@@ -0,0 +1,187 @@
+package parser
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// serviceWithAnnotations returns a ClusterIP Service with kube-nftlb annotations (without prefix).
+func serviceWithAnnotations(settings map[string]string) *corev1.Service {
+	annotations := make(map[string]string, len(settings))
+	for name, value := range settings {
+		annotations[validation.ServiceAnnotationPrefix+name] = value
+	}
+
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Annotations: annotations},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP},
+	}
+}
+
+// gaugeValue returns the value of a gauge with some labels, and false if it isn't exported.
+func gaugeValue(t *testing.T, gaugeVec *prometheus.GaugeVec, labels map[string]string) (float64, bool) {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(gaugeVec)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] == label.GetValue() {
+					matched++
+				}
+			}
+			if matched == len(labels) {
+				return metric.GetGauge().GetValue(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestRateLimitAnnotationsAsFarm(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        types.Farm
+	}{
+		{
+			// Settings that aren't set aren't sent, nftlb uses its own defaults
+			name: "defaults",
+			want: types.Farm{},
+		},
+		{
+			name: "every annotation",
+			annotations: map[string]string{
+				"new-rtlimit": "100", "new-rtlimit-burst": "20", "rst-rtlimit": "10", "rst-rtlimit-burst": "5",
+				"tcp-strict": "on", "queue": "3",
+			},
+			want: types.Farm{NewRtlimit: types.NewNumber(100), NewRtlimitBurst: types.NewNumber(20), RstRtlimit: types.NewNumber(10), RstRtlimitBurst: types.NewNumber(5), TCPStrict: types.SwitchOn, Queue: types.NewSignedNumber(3)},
+		},
+		{
+			name: "invalid annotations keep the defaults",
+			annotations: map[string]string{
+				"new-rtlimit": "-1", "rst-rtlimit-burst": "many", "tcp-strict": "yes", "queue": "65536",
+			},
+			want: types.Farm{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			farm := annotationsAsFarm("web--http", "web", getAnnotations(serviceWithAnnotations(test.annotations)))
+			got := types.Farm{
+				NewRtlimit:      farm.NewRtlimit,
+				NewRtlimitBurst: farm.NewRtlimitBurst,
+				RstRtlimit:      farm.RstRtlimit,
+				RstRtlimitBurst: farm.RstRtlimitBurst,
+				TCPStrict:       farm.TCPStrict,
+				Queue:           farm.Queue,
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMarkAnnotationsAsFarm(t *testing.T) {
+	validation.MasqueradeMark = 0x40000000
+	defer func() { validation.MasqueradeMark = 0 }()
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        types.Farm
+	}{
+		{
+			name: "defaults",
+			want: types.Farm{},
+		},
+		{
+			name: "every annotation",
+			annotations: map[string]string{
+				"mark": "0x100", "priority": "2", "source-addr": "192.168.0.1", "intra-connect": "off",
+			},
+			want: types.Farm{Mark: types.NewMark(0x100), Priority: types.NewNumber(2), SourceAddr: "192.168.0.1", IntraConnect: types.SwitchOff},
+		},
+		{
+			name: "invalid annotations keep the defaults",
+			annotations: map[string]string{
+				"mark": "0x40000001", "priority": "0", "source-addr": "192.168.0", "intra-connect": "yes",
+			},
+			want: types.Farm{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			farm := annotationsAsFarm("web--http", "web", getAnnotations(serviceWithAnnotations(test.annotations)))
+			got := types.Farm{
+				Mark:         farm.Mark,
+				Priority:     farm.Priority,
+				SourceAddr:   farm.SourceAddr,
+				IntraConnect: farm.IntraConnect,
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUnsetSettingsArentSent(t *testing.T) {
+	farm := annotationsAsFarm("web--http", "web", getAnnotations(serviceWithAnnotations(nil)))
+	data, err := json.Marshal(farm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only settings with a built-in default are sent, nftlb keeps its own defaults for the rest
+	want := `{"name":"web--http","mode":"snat","scheduler":"rr","sched-param":"none","log":"none","persistence":"none","persist-ttl":"60"}`
+	if string(data) != want {
+		t.Fatalf("got %s, want %s", data, want)
+	}
+}
+
+func TestFarmMetrics(t *testing.T) {
+	service := serviceWithAnnotations(map[string]string{"new-rtlimit": "100", "tcp-strict": "on", "queue": "-1"})
+	farm := annotationsAsFarm("web--http", "web", getAnnotations(service))
+	labels := map[string]string{"namespace": "default", "service": "web", "farm": "web--http"}
+
+	setFarmMetrics(farm, service)
+	for _, test := range []struct {
+		gaugeVec *prometheus.GaugeVec
+		want     float64
+	}{
+		{metrics.ServicesNewRtlimit, 100},
+		{metrics.ServicesNewRtlimitBurst, 0},
+		{metrics.ServicesTCPStrict, 1},
+		{metrics.ServicesQueue, -1},
+	} {
+		if got, ok := gaugeValue(t, test.gaugeVec, labels); !ok || got != test.want {
+			t.Fatalf("got %v (exported: %v), want %v", got, ok, test.want)
+		}
+	}
+
+	// Metrics of deleted farms aren't exported
+	deleteFarmMetrics(service, farm.Name)
+	if _, ok := gaugeValue(t, metrics.ServicesNewRtlimit, labels); ok {
+		t.Fatal("got metrics of a deleted farm")
+	}
+}
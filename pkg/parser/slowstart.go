@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/events"
+	"github.com/zevenet/kube-nftlb/pkg/processor"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// Clock is used by slow start to find how long a backend has been ramping up, it can be replaced by a fake clock.
+var Clock clock.Clock = clock.RealClock{}
+
+var (
+	// Map [farm (name)] to { slow start duration }, only for farms with slow start
+	slowStartPerFarm = make(map[string]time.Duration)
+
+	// Map [farm (name)] to [backend (name)] to { time when its slow start began }
+	slowStarts = make(map[string]map[string]time.Time)
+
+	// Map [farm (name)] to [backend (name)] to { last weight given to a backend in slow start }
+	slowStartWeights = make(map[string]map[string]types.Number)
+)
+
+// SlowStartAsNftlb returns a Nftlb struct with every backend in slow start whose weight has changed since it was last
+// given. Backends that have reached their weight are returned for the last time.
+func SlowStartAsNftlb() *types.Nftlb {
+	nftlb := &types.Nftlb{
+		Farms: make([]types.Farm, 0),
+	}
+
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	for farmName, backendStarts := range slowStarts {
+		weights := autoWeightsLocked(farmName)
+		priorities := topologyPrioritiesLocked(farmName)
+		farm := types.Farm{
+			Name:     farmName,
+			Backends: make([]types.Backend, 0, len(backendStarts)),
+		}
+
+		for _, podBackend := range podBackendsPerFarm[farmName] {
+			if _, ok := backendStarts[podBackend.backend.Name]; !ok {
+				continue
+			}
+
+			lastWeight, given := slowStartWeights[farmName][podBackend.backend.Name]
+			backend := podBackend.backend
+			applyPodSettingsLocked(farmName, &backend, podBackend.pod, weights, priorities)
+			if given && backend.Weight != nil && *backend.Weight == lastWeight {
+				continue
+			}
+			farm.Backends = append(farm.Backends, backend)
+		}
+
+		if len(farm.Backends) > 0 {
+			nftlb.Farms = append(nftlb.Farms, farm)
+		}
+	}
+
+	return nftlb
+}
+
+// farmSlowStart returns the slow start of a farm made for a Service. Only the weight scheduler reads the weights that
+// are ramped up, so the slow start of a farm with any other scheduler is ignored and a Warning Event is recorded in the
+// Service.
+func farmSlowStart(farm *types.Farm, service *corev1.Service, annotations *types.Annotations) string {
+	slowStart := annotations.Settings[processor.SlowStartSetting]
+	if duration, _ := time.ParseDuration(slowStart); duration > 0 && farm.Scheduler != types.SchedulerWeight {
+		events.Warning(service, "SlowStartIgnored", fmt.Sprintf("farm %s: slow start needs the %s scheduler (it's %s), it will be ignored", farm.Name, types.SchedulerWeight, farm.Scheduler))
+		return "0s"
+	}
+	return slowStart
+}
+
+// setSlowStart keeps the slow start duration of a farm.
+func setSlowStart(farmName string, slowStart string) {
+	duration, _ := time.ParseDuration(slowStart)
+
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	if duration <= 0 {
+		delete(slowStartPerFarm, farmName)
+		delete(slowStarts, farmName)
+		delete(slowStartWeights, farmName)
+		return
+	}
+	slowStartPerFarm[farmName] = duration
+}
+
+// startSlowStartLocked begins the slow start of a new backend if its farm has slow start.
+func startSlowStartLocked(farmName string, backendName string) {
+	if _, ok := slowStartPerFarm[farmName]; !ok {
+		return
+	}
+
+	if _, ok := slowStarts[farmName]; !ok {
+		slowStarts[farmName] = make(map[string]time.Time)
+	}
+	slowStarts[farmName][backendName] = Clock.Now()
+}
+
+// stopSlowStartLocked cancels the slow start of a backend (for example, when its Pod leaves).
+func stopSlowStartLocked(farmName string, backendName string) {
+	delete(slowStarts[farmName], backendName)
+	if len(slowStarts[farmName]) == 0 {
+		delete(slowStarts, farmName)
+	}
+	delete(slowStartWeights[farmName], backendName)
+	if len(slowStartWeights[farmName]) == 0 {
+		delete(slowStartWeights, farmName)
+	}
+}
+
+// applySlowStartLocked lowers the weight of a backend in slow start (made for the Pod with the given key), in proportion
+// to how long it has been ramping up. The slow start ends when the backend reaches its weight. A backend with weight 1
+// can't be ramped up, so its slow start is cancelled and a Warning Event is recorded in its Pod.
+func applySlowStartLocked(farmName string, backend *types.Backend, key string) {
+	start, ok := slowStarts[farmName][backend.Name]
+	if !ok {
+		return
+	}
+
+	elapsed := Clock.Since(start)
+	duration := slowStartPerFarm[farmName]
+	if elapsed >= duration {
+		stopSlowStartLocked(farmName, backend.Name)
+		return
+	}
+
+	weight := int64(1)
+	if backend.Weight != nil {
+		weight = int64(*backend.Weight)
+	}
+	if weight <= 1 {
+		stopSlowStartLocked(farmName, backend.Name)
+		events.Warning(podReference(key), "SlowStartIgnored", fmt.Sprintf("backend %s of farm %s: slow start needs a weight bigger than 1 (set by a Pod annotation or automatic weights), it will be ignored", backend.Name, farmName))
+		return
+	}
+
+	// The lowest weight accepted by nftlb is 1
+	rampWeight := int64(math.Ceil(float64(weight) * float64(elapsed) / float64(duration)))
+	if rampWeight < 1 {
+		rampWeight = 1
+	}
+	backend.Weight = types.NewNumber(uint32(rampWeight))
+
+	if _, ok := slowStartWeights[farmName]; !ok {
+		slowStartWeights[farmName] = make(map[string]types.Number)
+	}
+	slowStartWeights[farmName][backend.Name] = *backend.Weight
+}
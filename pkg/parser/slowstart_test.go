@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestSlowStartRamp(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	oldClock := Clock
+	Clock = fakeClock
+	defer func() { Clock = oldClock }()
+
+	farmName := "web--http"
+	setSlowStart(farmName, "10s")
+	defer setSlowStart(farmName, "0s")
+
+	podsMutex.Lock()
+	podsData["default/web-0"] = podData{settings: map[string]string{"weight": "10"}}
+	podBackendsPerFarm[farmName] = []podBackend{
+		{pod: "default/web-0", backend: types.Backend{Name: "web-0", State: types.StateUp}},
+	}
+	startSlowStartLocked(farmName, "web-0")
+	podsMutex.Unlock()
+	defer func() {
+		podsMutex.Lock()
+		delete(podsData, "default/web-0")
+		deletePodBackendsLocked(farmName)
+		podsMutex.Unlock()
+	}()
+
+	// Weights are only given when they change, and the weight of the backend is given when its slow start ends
+	steps := []struct {
+		elapsed time.Duration
+		weight  uint32 // 0 if nothing is given
+	}{
+		{500 * time.Millisecond, 1},
+		{time.Second, 0},
+		{1500 * time.Millisecond, 2},
+		{2 * time.Second, 0},
+		{5 * time.Second, 5},
+		{9500 * time.Millisecond, 10},
+		{10 * time.Second, 0},
+		{11 * time.Second, 0},
+	}
+
+	start := fakeClock.Now()
+	for _, step := range steps {
+		fakeClock.SetTime(start.Add(step.elapsed))
+		nftlb := SlowStartAsNftlb()
+
+		if step.weight == 0 {
+			if len(nftlb.Farms) != 0 {
+				t.Fatalf("after %s: got farms %+v, want none", step.elapsed, nftlb.Farms)
+			}
+			continue
+		}
+
+		if len(nftlb.Farms) != 1 || len(nftlb.Farms[0].Backends) != 1 {
+			t.Fatalf("after %s: got farms %+v, want 1 farm with 1 backend", step.elapsed, nftlb.Farms)
+		}
+		if weight := nftlb.Farms[0].Backends[0].Weight; weight == nil || uint32(*weight) != step.weight {
+			t.Fatalf("after %s: got weight %v, want %d", step.elapsed, weight, step.weight)
+		}
+	}
+}
+
+func TestSlowStartNewBackends(t *testing.T) {
+	farmName := "web--http"
+	setSlowStart(farmName, "10s")
+	defer setSlowStart(farmName, "0s")
+	defer deletePodBackends(farmName)
+
+	backends := func(names ...string) []podBackend {
+		podBackends := make([]podBackend, 0, len(names))
+		for _, name := range names {
+			podBackends = append(podBackends, podBackend{pod: "default/" + name, backend: types.Backend{Name: name}})
+		}
+		return podBackends
+	}
+
+	// The first backends of a farm don't begin a slow start, there's nothing to protect
+	setPodBackends(farmName, "default/web", backends("web-0"))
+	if len(slowStarts[farmName]) != 0 {
+		t.Fatalf("got slow starts %v, want none", slowStarts[farmName])
+	}
+
+	// Backends that join later begin their slow start, and it's cancelled if they leave
+	setPodBackends(farmName, "default/web", backends("web-0", "web-1"))
+	if _, ok := slowStarts[farmName]["web-1"]; !ok || len(slowStarts[farmName]) != 1 {
+		t.Fatalf("got slow starts %v, want web-1", slowStarts[farmName])
+	}
+	setPodBackends(farmName, "default/web", backends("web-0"))
+	if len(slowStarts[farmName]) != 0 {
+		t.Fatalf("got slow starts %v, want none", slowStarts[farmName])
+	}
+}
+
+func TestFarmSlowStart(t *testing.T) {
+	tests := []struct {
+		scheduler types.Scheduler
+		slowStart string
+		want      string
+	}{
+		{types.SchedulerWeight, "10s", "10s"},
+		{types.SchedulerWeight, "0s", "0s"},
+		// Other schedulers don't read weights
+		{types.Scheduler("rr"), "10s", "0s"},
+		{types.Scheduler("symhash"), "10s", "0s"},
+		{types.Scheduler("rr"), "0s", "0s"},
+	}
+
+	service := serviceWithAnnotations(nil)
+	for _, test := range tests {
+		farm := &types.Farm{Name: "web--http", Scheduler: test.scheduler}
+		annotations := &types.Annotations{Settings: map[string]string{"slow-start": test.slowStart}}
+		if got := farmSlowStart(farm, service, annotations); got != test.want {
+			t.Errorf("scheduler %s, slow start %s: got %s, want %s", test.scheduler, test.slowStart, got, test.want)
+		}
+	}
+}
+
+func TestSlowStartWeightOne(t *testing.T) {
+	farmName := "web--http"
+	setSlowStart(farmName, "10s")
+	defer setSlowStart(farmName, "0s")
+
+	podsMutex.Lock()
+	podsData["default/web-0"] = podData{settings: map[string]string{}}
+	podBackendsPerFarm[farmName] = []podBackend{
+		{pod: "default/web-0", backend: types.Backend{Name: "web-0", State: types.StateUp}},
+	}
+	startSlowStartLocked(farmName, "web-0")
+	podsMutex.Unlock()
+	defer func() {
+		podsMutex.Lock()
+		delete(podsData, "default/web-0")
+		deletePodBackendsLocked(farmName)
+		podsMutex.Unlock()
+	}()
+
+	// A backend with weight 1 can't be ramped up, its slow start is cancelled
+	SlowStartAsNftlb()
+	if len(slowStarts[farmName]) != 0 {
+		t.Fatalf("got slow starts %v, want none", slowStarts[farmName])
+	}
+	if nftlb := SlowStartAsNftlb(); len(nftlb.Farms) != 0 {
+		t.Fatalf("got farms %+v, want none", nftlb.Farms)
+	}
+}
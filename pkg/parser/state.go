@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/zevenet/kube-nftlb/pkg/events"
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	statesMutex sync.Mutex
+
+	// Map [Service (namespace/name)] to [farm (name)] to { state }, it's kept while the Service is updated
+	statePerFarm = make(map[string]map[string]types.State)
+)
+
+// setFarmState exports the state of a farm, and records a Normal Event in its Service when the state changes (a farm
+// that isn't up is also recorded when it's made).
+func setFarmState(farm *types.Farm, service *corev1.Service) {
+	key := service.Namespace + "/" + service.Name
+
+	// A farm without state is up, it's the default state of nftlb
+	state := farm.State
+	if state == "" {
+		state = types.StateUp
+	}
+
+	statesMutex.Lock()
+	oldState, exists := statePerFarm[key][farm.Name]
+	if !exists {
+		oldState = types.StateUp
+	}
+	if statePerFarm[key] == nil {
+		statePerFarm[key] = make(map[string]types.State)
+	}
+	statePerFarm[key][farm.Name] = state
+	statesMutex.Unlock()
+
+	if oldState != state {
+		events.Normal(service, "FarmStateChanged", fmt.Sprintf("farm %s is %s (it was %s)", farm.Name, state, oldState))
+	}
+
+	for _, other := range validation.States {
+		if other != string(state) {
+			metrics.ServicesFarmState.DeleteLabelValues(service.Namespace, service.Name, farm.Name, other)
+		}
+	}
+	metrics.ServicesFarmState.WithLabelValues(service.Namespace, service.Name, farm.Name, string(state)).Set(1)
+}
+
+// deleteFarmStateMetric stops exporting the state of a deleted farm.
+func deleteFarmStateMetric(service *corev1.Service, farmName string) {
+	for _, state := range validation.States {
+		metrics.ServicesFarmState.DeleteLabelValues(service.Namespace, service.Name, farmName, state)
+	}
+}
+
+// DeleteFarmStates forgets the state of every farm of a deleted Service.
+func DeleteFarmStates(service *corev1.Service) {
+	statesMutex.Lock()
+	defer statesMutex.Unlock()
+
+	delete(statePerFarm, service.Namespace+"/"+service.Name)
+}
+
+// setBackendStateMetric exports the state of a backend made for a Pod.
+func setBackendStateMetric(farmName string, backend *types.Backend) {
+	for _, state := range validation.States {
+		if state != string(backend.State) {
+			metrics.BackendsState.DeleteLabelValues(farmName, backend.Name, state)
+		}
+	}
+	metrics.BackendsState.WithLabelValues(farmName, backend.Name, string(backend.State)).Set(1)
+}
+
+// deleteBackendStateMetric stops exporting the state of a backend that has left.
+func deleteBackendStateMetric(farmName string, backendName string) {
+	for _, state := range validation.States {
+		metrics.BackendsState.DeleteLabelValues(farmName, backendName, state)
+	}
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+)
+
+func TestFarmState(t *testing.T) {
+	tests := []struct {
+		state string
+		want  types.State
+	}{
+		// The state isn't sent unless it's set, so nftlb keeps the farm up
+		{"", ""},
+		{"down", types.StateDown},
+		{"off", types.StateOff},
+		// The config state is only set by nftlb
+		{"config", ""},
+	}
+
+	for _, test := range tests {
+		annotations := map[string]string{}
+		if test.state != "" {
+			annotations["state"] = test.state
+		}
+		if farm := annotationsAsFarm("web--http", "web", getAnnotations(serviceWithAnnotations(annotations))); farm.State != test.want {
+			t.Errorf("state %q: got %q, want %q", test.state, farm.State, test.want)
+		}
+	}
+}
+
+func TestSetFarmState(t *testing.T) {
+	service := serviceWithAnnotations(nil)
+	defer DeleteFarmStates(service)
+	defer deleteFarmStateMetric(service, "web--http")
+
+	// Only the current state is exported
+	for _, state := range []types.State{types.StateUp, types.StateOff, types.StateUp} {
+		setFarmState(&types.Farm{Name: "web--http", State: state}, service)
+		if got := statePerFarm["default/web"]["web--http"]; got != state {
+			t.Fatalf("got state %q, want %q", got, state)
+		}
+
+		for _, other := range []types.State{types.StateUp, types.StateDown, types.StateOff} {
+			labels := map[string]string{"namespace": "default", "service": "web", "farm": "web--http", "state": string(other)}
+			if _, exported := gaugeValue(t, metrics.ServicesFarmState, labels); exported != (other == state) {
+				t.Fatalf("state %q: got %q exported %t", state, other, exported)
+			}
+		}
+	}
+
+	// States of a deleted Service are forgotten
+	DeleteFarmStates(service)
+	if _, ok := statePerFarm["default/web"]; ok {
+		t.Fatal("got states of a deleted Service")
+	}
+}
+
+func TestPodStateAsBackends(t *testing.T) {
+	defer DeletePod(newPod("pod-a", nil))
+	defer deletePodBackends("web--http")
+	defer delete(backendsPerFarm, "web--http")
+
+	// Backends of a Pod in maintenance are off, and they're up again when the annotation is removed
+	SetPod(newPod("pod-a", map[string]string{"state": "off"}))
+	nftlb := EndpointsAsNftlb(newPodEndpoints("web", "pod-a", "pod-b"))
+	if len(nftlb.Farms) != 1 || len(nftlb.Farms[0].Backends) != 2 {
+		t.Fatalf("got farms %+v, want 1 farm with 2 backends", nftlb.Farms)
+	}
+	if backend := nftlb.Farms[0].Backends[0]; backend.State != types.StateOff {
+		t.Fatalf("pod-a: got state %q, want off", backend.State)
+	}
+	if backend := nftlb.Farms[0].Backends[1]; backend.State != types.StateUp {
+		t.Fatalf("pod-b: got state %q, want up", backend.State)
+	}
+
+	SetPod(newPod("pod-a", nil))
+	nftlb = PodAsNftlb(newPod("pod-a", nil))
+	if len(nftlb.Farms) != 1 || len(nftlb.Farms[0].Backends) != 1 || nftlb.Farms[0].Backends[0].State != types.StateUp {
+		t.Fatalf("got farms %+v, want the backend of pod-a up", nftlb.Farms)
+	}
+
+	// Backends can't be taken down, only off
+	if SetPod(newPod("pod-a", map[string]string{"state": "down"})) {
+		t.Fatal("invalid state: got changed")
+	}
+}
@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// StatusAnnotation holds the settings in effect for every farm made from a Service. Every node merges its own farms
+// into it, so there's one annotation per Service whatever the size of the cluster.
+const StatusAnnotation = "kube-nftlb.zevenet.com/status"
+
+// FarmStatus is an entry of the status annotation: the settings in effect for a farm and the nodes where they are.
+type FarmStatus struct {
+	Farm  types.Farm `json:"farm"`
+	Nodes []string   `json:"nodes"`
+}
+
+// ServiceStatus merges the farms programmed by a node into the status annotation of a Service. The node is removed
+// from every other entry (it doesn't program those farms anymore, for example when its node selector doesn't match),
+// and so are nodes that don't exist anymore if nodes isn't nil. Entries of farms that the Service doesn't make anymore
+// are left out. It returns the new value (empty if there are no entries left), and false if it's the same as before.
+func ServiceStatus(service *corev1.Service, nodeName string, farms []types.Farm, nodes map[string]bool) (string, bool) {
+	farmNames := map[string]bool{FormatCompactName(service.Name): true}
+	for _, servicePort := range service.Spec.Ports {
+		farmNames[FormatName(service.Name, servicePort.Name)] = true
+	}
+
+	// An unreadable value (for example, one edited by hand) is written again from scratch
+	var entries []FarmStatus
+	if err := json.Unmarshal([]byte(service.Annotations[StatusAnnotation]), &entries); err != nil {
+		entries = nil
+	}
+
+	// Forget what this node wrote before, and nodes that have been deleted
+	status := make([]FarmStatus, 0, len(entries)+len(farms))
+	for _, entry := range entries {
+		if !farmNames[entry.Farm.Name] {
+			continue
+		}
+		entry.Nodes = existingNodes(entry.Nodes, nodeName, nodes)
+		if len(entry.Nodes) > 0 {
+			status = append(status, entry)
+		}
+	}
+
+	for _, farm := range farms {
+		if !farmNames[farm.Name] {
+			continue
+		}
+
+		// Addresses and backends aren't settings
+		farm.Addresses = nil
+		farm.Backends = nil
+
+		merged := false
+		for index := range status {
+			if reflect.DeepEqual(status[index].Farm, farm) {
+				status[index].Nodes = append(status[index].Nodes, nodeName)
+				sort.Strings(status[index].Nodes)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			status = append(status, FarmStatus{Farm: farm, Nodes: []string{nodeName}})
+		}
+	}
+
+	sort.SliceStable(status, func(i, j int) bool {
+		if status[i].Farm.Name != status[j].Farm.Name {
+			return status[i].Farm.Name < status[j].Farm.Name
+		}
+		return status[i].Nodes[0] < status[j].Nodes[0]
+	})
+
+	value := ""
+	if len(status) > 0 {
+		data, err := json.Marshal(status)
+		if err != nil {
+			return service.Annotations[StatusAnnotation], false
+		}
+		value = string(data)
+	}
+	return value, value != service.Annotations[StatusAnnotation]
+}
+
+// StatusHasNode returns true if a node is listed in the status annotation of a Service.
+func StatusHasNode(service *corev1.Service, nodeName string) bool {
+	var entries []FarmStatus
+	if err := json.Unmarshal([]byte(service.Annotations[StatusAnnotation]), &entries); err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		for _, name := range entry.Nodes {
+			if name == nodeName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// existingNodes returns the node names without the given one, and without names that aren't in nodes (if it isn't
+// nil).
+func existingNodes(nodeNames []string, nodeName string, nodes map[string]bool) []string {
+	result := make([]string, 0, len(nodeNames))
+	for _, name := range nodeNames {
+		if name != nodeName && (nodes == nil || nodes[name]) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
@@ -0,0 +1,168 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServiceStatus(t *testing.T) {
+	http := types.Farm{Name: "web--http", Scheduler: types.Scheduler("rr")}
+	httpWeight := types.Farm{Name: "web--http", Scheduler: types.Scheduler("weight")}
+	https := types.Farm{Name: "web--https", Scheduler: types.Scheduler("rr")}
+
+	tests := []struct {
+		name     string
+		status   string
+		nodeName string
+		farms    []types.Farm
+		nodes    []string // Known nodes, every node is kept if it's nil
+		want     string
+		changed  bool
+	}{
+		{
+			name:     "first node",
+			nodeName: "node1",
+			farms:    []types.Farm{http, https},
+			want:     `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1"]},{"farm":{"name":"web--https","scheduler":"rr"},"nodes":["node1"]}]`,
+			changed:  true,
+		},
+		{
+			name:     "same settings in another node",
+			status:   `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1"]}]`,
+			nodeName: "node2",
+			farms:    []types.Farm{http},
+			want:     `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1","node2"]}]`,
+			changed:  true,
+		},
+		{
+			name:     "other settings in another node",
+			status:   `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1","node2"]}]`,
+			nodeName: "node2",
+			farms:    []types.Farm{httpWeight},
+			want:     `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1"]},{"farm":{"name":"web--http","scheduler":"weight"},"nodes":["node2"]}]`,
+			changed:  true,
+		},
+		{
+			name:     "unchanged",
+			status:   `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1","node2"]}]`,
+			nodeName: "node1",
+			farms:    []types.Farm{http},
+			want:     `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1","node2"]}]`,
+			changed:  false,
+		},
+		{
+			name:     "farm of a removed port",
+			status:   `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1"]},{"farm":{"name":"web--dns","scheduler":"rr"},"nodes":["node2"]}]`,
+			nodeName: "node1",
+			farms:    []types.Farm{http},
+			want:     `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1"]}]`,
+			changed:  true,
+		},
+		{
+			name:     "farm that isn't programmed anymore",
+			status:   `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1","node2"]},{"farm":{"name":"web--https","scheduler":"rr"},"nodes":["node1"]}]`,
+			nodeName: "node1",
+			farms:    []types.Farm{http},
+			want:     `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1","node2"]}]`,
+			changed:  true,
+		},
+		{
+			name:     "no farm programmed",
+			status:   `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1","node2"]}]`,
+			nodeName: "node1",
+			want:     `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node2"]}]`,
+			changed:  true,
+		},
+		{
+			name:     "last node",
+			status:   `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1"]}]`,
+			nodeName: "node1",
+			want:     "",
+			changed:  true,
+		},
+		{
+			name:     "no farm programmed without status",
+			nodeName: "node1",
+			want:     "",
+			changed:  false,
+		},
+		{
+			name:     "deleted node",
+			status:   `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1","node2","node3"]}]`,
+			nodeName: "node1",
+			farms:    []types.Farm{http},
+			nodes:    []string{"node1", "node2"},
+			want:     `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1","node2"]}]`,
+			changed:  true,
+		},
+		{
+			name:     "unreadable value",
+			status:   `not json`,
+			nodeName: "node1",
+			farms:    []types.Farm{http},
+			want:     `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1"]}]`,
+			changed:  true,
+		},
+		{
+			name:     "addresses and backends",
+			nodeName: "node1",
+			farms: []types.Farm{{
+				Name:      "web--http",
+				Scheduler: types.Scheduler("rr"),
+				Addresses: []types.Address{{Name: "web--http--address"}},
+				Backends:  []types.Backend{{Name: "web-1--http"}},
+			}},
+			want:    `[{"farm":{"name":"web--http","scheduler":"rr"},"nodes":["node1"]}]`,
+			changed: true,
+		},
+	}
+
+	for _, test := range tests {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        "web",
+				Annotations: map[string]string{},
+			},
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{{Name: "http", Port: 80}, {Name: "https", Port: 443}},
+			},
+		}
+		if test.status != "" {
+			service.Annotations[StatusAnnotation] = test.status
+		}
+
+		var nodes map[string]bool
+		if test.nodes != nil {
+			nodes = make(map[string]bool)
+			for _, name := range test.nodes {
+				nodes[name] = true
+			}
+		}
+
+		got, changed := ServiceStatus(service, test.nodeName, test.farms, nodes)
+		if got != test.want || changed != test.changed {
+			t.Errorf("%s: got %s (changed %t), want %s (changed %t)", test.name, got, changed, test.want, test.changed)
+		}
+	}
+}
+
+func TestStatusHasNode(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				StatusAnnotation: `[{"farm":{"name":"web--http"},"nodes":["node1","node2"]}]`,
+			},
+		},
+	}
+
+	for nodeName, want := range map[string]bool{"node1": true, "node2": true, "node": false, "node3": false} {
+		if got := StatusHasNode(service, nodeName); got != want {
+			t.Errorf("%s: got %t, want %t", nodeName, got, want)
+		}
+	}
+}
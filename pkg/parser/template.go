@@ -0,0 +1,208 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/zevenet/kube-nftlb/pkg/events"
+	"github.com/zevenet/kube-nftlb/pkg/log"
+	"github.com/zevenet/kube-nftlb/pkg/processor"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	// It locks every map of this file
+	templatesMutex sync.Mutex
+
+	// Map [ConfigMap (namespace/name)] to { partial farm }, only for valid farm templates
+	farmTemplates = make(map[string]map[string]interface{})
+
+	// Map [ConfigMap (namespace/name)] to [Service (namespace/name)] to { it uses that farm template }
+	templateUsers = make(map[string]map[string]bool)
+)
+
+// SetFarmTemplate reads the farm template of a ConfigMap. Invalid templates are ignored and reported as Warning
+// Events of the ConfigMap. It returns true if the template has changed.
+func SetFarmTemplate(configMap *corev1.ConfigMap) bool {
+	key := podKey(configMap.Namespace, configMap.Name)
+
+	template, errs := farmTemplate(configMap.Data[types.FarmTemplateKey], field.NewPath("data").Key(types.FarmTemplateKey))
+	if len(errs) > 0 {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("SetFarmTemplate: ConfigMap name: %s\n%s", configMap.Name, errs.ToAggregate().Error()))
+		events.Warning(configMap, "InvalidFarmTemplate", fmt.Sprintf("%s, the template will be ignored", errs.ToAggregate().Error()))
+		template = nil
+	}
+
+	templatesMutex.Lock()
+	defer templatesMutex.Unlock()
+
+	oldTemplate, exists := farmTemplates[key]
+	if template == nil {
+		delete(farmTemplates, key)
+		return exists
+	}
+	farmTemplates[key] = template
+	return !exists || !reflect.DeepEqual(oldTemplate, template)
+}
+
+// DeleteFarmTemplate forgets the farm template of a deleted ConfigMap. It returns true if there was a template.
+func DeleteFarmTemplate(configMap *corev1.ConfigMap) bool {
+	key := podKey(configMap.Namespace, configMap.Name)
+
+	templatesMutex.Lock()
+	defer templatesMutex.Unlock()
+
+	_, exists := farmTemplates[key]
+	delete(farmTemplates, key)
+	return exists
+}
+
+// FarmTemplateUsers returns every Service (namespace/name) whose farms use the farm template of a ConfigMap, so
+// they're applied again when it changes.
+func FarmTemplateUsers(configMap *corev1.ConfigMap) []string {
+	templatesMutex.Lock()
+	defer templatesMutex.Unlock()
+
+	services := make([]string, 0)
+	for service := range templateUsers[podKey(configMap.Namespace, configMap.Name)] {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services
+}
+
+// applyFarmTemplate merges the farm template set for a farm (if any) into it. The template is ignored if the merged
+// farm is invalid.
+func applyFarmTemplate(farm *types.Farm, service *corev1.Service, annotations *types.Annotations) {
+	name := annotations.Settings[processor.FarmTemplateSetting]
+	if name == "" {
+		return
+	}
+	key := podKey(service.Namespace, name)
+
+	templatesMutex.Lock()
+	if templateUsers[key] == nil {
+		templateUsers[key] = make(map[string]bool)
+	}
+	templateUsers[key][podKey(service.Namespace, service.Name)] = true
+	template, ok := farmTemplates[key]
+	templatesMutex.Unlock()
+
+	if !ok {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("applyFarmTemplate: farm name: %s\nFarm template %s not found", farm.Name, key))
+		events.Warning(service, "FarmTemplateNotFound", fmt.Sprintf("farm %s: ConfigMap %s with the label %s and a %s key not found, the template will be ignored", farm.Name, name, types.FarmTemplateLabel, types.FarmTemplateKey))
+		return
+	}
+
+	merged, err := mergeFarmTemplate(farm, template, service.Spec.Type)
+	if err != nil {
+		log.WriteLog(types.ErrorLog, fmt.Sprintf("applyFarmTemplate: farm name: %s\n%s", farm.Name, err.Error()))
+		events.Warning(service, "InvalidFarmTemplate", fmt.Sprintf("farm %s: %s, the template will be ignored", farm.Name, err.Error()))
+		return
+	}
+	*farm = *merged
+}
+
+// deleteTemplateUser forgets that a deleted Service uses farm templates.
+func deleteTemplateUser(service *corev1.Service) {
+	templatesMutex.Lock()
+	defer templatesMutex.Unlock()
+
+	serviceKey := podKey(service.Namespace, service.Name)
+	for key, services := range templateUsers {
+		delete(services, serviceKey)
+		if len(services) == 0 {
+			delete(templateUsers, key)
+		}
+	}
+}
+
+// farmTemplate reads a partial farm (JSON). Only fields from types.FarmTemplateFields can be set.
+func farmTemplate(data string, fldPath *field.Path) (map[string]interface{}, field.ErrorList) {
+	if data == "" {
+		return nil, field.ErrorList{field.Required(fldPath, "a partial nftlb farm (JSON)")}
+	}
+
+	template := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(data), &template); err != nil {
+		return nil, field.ErrorList{field.Invalid(fldPath, data, err.Error())}
+	}
+
+	allErrs := field.ErrorList{}
+	for name := range template {
+		if !contains(types.FarmTemplateFields, name) {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child(name), name, types.FarmTemplateFields))
+		}
+	}
+
+	// Values must have the types of the nftlb model
+	if err := json.Unmarshal([]byte(data), &types.Farm{}); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, data, err.Error()))
+	}
+	return template, allErrs
+}
+
+// mergeFarmTemplate returns a copy of a farm with a template deep merged into it, it's checked again after merging
+// with the same rules as annotations of a Service of that type.
+func mergeFarmTemplate(farm *types.Farm, template map[string]interface{}, serviceType corev1.ServiceType) (*types.Farm, error) {
+	farmJSON, err := json.Marshal(farm)
+	if err != nil {
+		return nil, err
+	}
+
+	farmMap := make(map[string]interface{})
+	if err := json.Unmarshal(farmJSON, &farmMap); err != nil {
+		return nil, err
+	}
+	mergeJSON(farmMap, template)
+
+	mergedJSON, err := json.Marshal(farmMap)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &types.Farm{}
+	if err := json.Unmarshal(mergedJSON, merged); err != nil {
+		return nil, err
+	}
+	fldPath := field.NewPath("farm")
+	if errs := validation.Farm(merged, fldPath); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+
+	// DSR can't be used without a virtual IP
+	if errs := validation.ModeForType(string(merged.Mode), serviceType, fldPath.Child("mode")); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+	return merged, nil
+}
+
+// mergeJSON merges src into dst: objects are merged key by key, any other value is replaced.
+func mergeJSON(dst map[string]interface{}, src map[string]interface{}) {
+	for key, srcValue := range src {
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeJSON(dstMap, srcMap)
+		} else {
+			dst[key] = srcValue
+		}
+	}
+}
+
+// contains returns true if a value is in a slice.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFarmTemplate(t *testing.T) {
+	tests := []struct {
+		data  string
+		valid bool
+	}{
+		{`{"mode": "dsr", "iface": "eth0"}`, true},
+		{`{"persist-ttl": "120", "policies": [{"name": "blacklist"}]}`, true},
+		{``, false},
+		{`{"mode": }`, false},
+		// Names, addresses and backends are made by kube-nftlb
+		{`{"name": "other"}`, false},
+		{`{"backends": []}`, false},
+		// Values must have the types of the nftlb model
+		{`{"priority": "high"}`, false},
+	}
+
+	for _, test := range tests {
+		if _, errs := farmTemplate(test.data, nil); (len(errs) == 0) != test.valid {
+			t.Errorf("%q: got errors %v, want valid %t", test.data, errs, test.valid)
+		}
+	}
+}
+
+func TestMergeFarmTemplate(t *testing.T) {
+	template, errs := farmTemplate(`{"mode": "dsr", "iface": "eth0", "persistence": "srcip"}`, nil)
+	if len(errs) > 0 {
+		t.Fatal(errs.ToAggregate())
+	}
+
+	farm := &types.Farm{Name: "web--http", Mode: types.ModeSNAT, Scheduler: types.SchedulerRR}
+	merged, err := mergeFarmTemplate(farm, template, corev1.ServiceTypeClusterIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Mode != types.ModeDSR || merged.Iface != "eth0" || merged.Persistence != "srcip" || merged.Scheduler != types.SchedulerRR {
+		t.Fatalf("got farm %+v, want the template merged into the farm", merged)
+	}
+	if farm.Mode != types.ModeSNAT {
+		t.Fatalf("got farm %+v, want it unchanged", farm)
+	}
+
+	// Templates can't set what annotations can't set for a Service of that type
+	for _, serviceType := range []corev1.ServiceType{corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer} {
+		if _, err := mergeFarmTemplate(farm, template, serviceType); err == nil {
+			t.Fatalf("%s: got no error, want dsr to be rejected", serviceType)
+		}
+	}
+
+	// The merged farm is checked
+	template, _ = farmTemplate(`{"mode": "dsr"}`, nil)
+	if _, err := mergeFarmTemplate(farm, template, corev1.ServiceTypeClusterIP); err == nil {
+		t.Fatal("got no error, want dsr without interface to be rejected")
+	}
+}
+
+func TestSetFarmTemplate(t *testing.T) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "tuned-farm"},
+		Data:       map[string]string{types.FarmTemplateKey: `{"scheduler": "hash"}`},
+	}
+	defer DeleteFarmTemplate(configMap)
+
+	if !SetFarmTemplate(configMap) {
+		t.Fatal("new template: got unchanged")
+	}
+	if SetFarmTemplate(configMap) {
+		t.Fatal("same template: got changed")
+	}
+
+	// Invalid templates are ignored
+	configMap.Data[types.FarmTemplateKey] = `{"scheduler": 1}`
+	if !SetFarmTemplate(configMap) {
+		t.Fatal("invalid template: got unchanged")
+	}
+	if _, ok := farmTemplates["default/tuned-farm"]; ok {
+		t.Fatal("got an invalid template, want it ignored")
+	}
+	if DeleteFarmTemplate(configMap) {
+		t.Fatal("got an ignored template deleted")
+	}
+}
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"strconv"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	// Map [Node (name)] to { zone (topology.kubernetes.io/zone label) }
+	nodeZones = make(map[string]string)
+
+	// Map [farm (name)] to { minimum backends in the zone of this node }, only for farms that prefer that zone
+	topologyPerFarm = make(map[string]int)
+)
+
+// setNodeZoneLocked reads the zone of a Node. It returns true if it has changed.
+func setNodeZoneLocked(node *corev1.Node) bool {
+	zone := node.Labels[corev1.LabelZoneFailureDomainStable]
+	oldZone, exists := nodeZones[node.Name]
+	nodeZones[node.Name] = zone
+	return !exists || oldZone != zone
+}
+
+// setTopology keeps the topology setting of a farm and the minimum backends in the zone of this node.
+func setTopology(farmName string, topology string, minLocal string) {
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	if topology != "zone" {
+		if _, ok := topologyPerFarm[farmName]; ok {
+			for _, podBackend := range podBackendsPerFarm[farmName] {
+				deleteTopologyMetric(farmName, podBackend.backend.Name)
+			}
+		}
+		delete(topologyPerFarm, farmName)
+		return
+	}
+
+	// It was checked with the annotations
+	min, err := strconv.Atoi(minLocal)
+	if err != nil || min < 1 {
+		min = 1
+	}
+	topologyPerFarm[farmName] = min
+}
+
+// backendZoneLocked returns the zone of the Node where the Pod of a backend runs, read from its EndpointAddress or
+// from the Pod. It's empty if it isn't known.
+func backendZoneLocked(podBackend podBackend) string {
+	nodeName := podBackend.nodeName
+	if nodeName == "" {
+		nodeName = podsData[podBackend.pod].nodeName
+	}
+	return nodeZones[nodeName]
+}
+
+// topologyDependsOnLocked returns true if the topology priorities of a farm depend on a Node: the node where
+// kube-nftlb is running, or the Node of one of its backends.
+func topologyDependsOnLocked(farmName string, podBackend podBackend, nodeName string) bool {
+	if _, ok := topologyPerFarm[farmName]; !ok {
+		return false
+	}
+	if nodeName == config.NodeName || podBackend.nodeName == nodeName {
+		return true
+	}
+	return podBackend.nodeName == "" && podsData[podBackend.pod].nodeName == nodeName
+}
+
+// topologyPrioritiesLocked returns the priority of every Pod with backends in a farm that prefers the zone of this
+// node. Backends in that zone get priority 1, and the rest get a priority bigger than the number of backends up in
+// that zone, so nftlb (which raises the priority in use for every backend that is down) only sends them traffic when
+// no backend in that zone is up. Every backend gets priority 1 if the zone has fewer backends up than the minimum or
+// the zone of this node isn't known. It returns nil if the farm doesn't prefer the zone of this node.
+func topologyPrioritiesLocked(farmName string) map[string]types.Number {
+	minLocal, ok := topologyPerFarm[farmName]
+	if !ok {
+		return nil
+	}
+	localZone := nodeZones[config.NodeName]
+
+	// Map [Pod (namespace/name)] to { it runs in the zone of this node }
+	local := make(map[string]bool)
+	localBackends := 0
+	for _, podBackend := range podBackendsPerFarm[farmName] {
+		if localZone != "" && backendZoneLocked(podBackend) == localZone {
+			local[podBackend.pod] = true
+			if backendUpLocked(farmName, podBackend) {
+				localBackends++
+			}
+		}
+	}
+
+	remotePriority := types.Number(1)
+	if localBackends >= minLocal {
+		remotePriority = types.Number(localBackends + 1)
+	}
+
+	priorities := make(map[string]types.Number, len(podBackendsPerFarm[farmName]))
+	for _, podBackend := range podBackendsPerFarm[farmName] {
+		priority := remotePriority
+		if local[podBackend.pod] {
+			priority = 1
+		}
+		priorities[podBackend.pod] = priority
+		metrics.BackendsTopologyPriority.WithLabelValues(farmName, podBackend.backend.Name).Set(float64(priority))
+	}
+
+	return priorities
+}
+
+// backendUpLocked returns true if a backend made for a Pod gets traffic: its Pod doesn't set another state and its
+// health check doesn't fail.
+func backendUpLocked(farmName string, podBackend podBackend) bool {
+	if state, ok := podsData[podBackend.pod].settings["state"]; ok && state != string(types.StateUp) {
+		return false
+	}
+	return HealthChecker.Healthy(farmName, podBackend.backend.Name)
+}
+
+// deleteTopologyMetric stops exporting the topology priority of a backend.
+func deleteTopologyMetric(farmName string, backendName string) {
+	metrics.BackendsTopologyPriority.DeleteLabelValues(farmName, backendName)
+}
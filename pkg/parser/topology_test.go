@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/config"
+	"github.com/zevenet/kube-nftlb/pkg/health"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setUnhealthy probes a backend at a TCP port where nothing listens, and waits until it's unhealthy.
+func setUnhealthy(t *testing.T, farmName string, backendName string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().(*net.TCPAddr)
+	listener.Close()
+
+	HealthChecker.SetTargets(farmName, []health.Target{{Name: backendName, IP: address.IP.String()}})
+	HealthChecker.SetCheck(farmName, &health.Check{
+		Type:               health.TypeTCP,
+		Interval:           10 * time.Millisecond,
+		Timeout:            5 * time.Millisecond,
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 1,
+		Port:               uint16(address.Port),
+	})
+
+	for {
+		select {
+		case change := <-HealthChecker.Changes():
+			if change.Group == farmName && change.Target == backendName && !change.Healthy {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s wasn't set unhealthy", backendName)
+		}
+	}
+}
+
+func TestTopologyPriorities(t *testing.T) {
+	farmName := "web--http"
+	setTopology(farmName, "zone", "2")
+	defer setTopology(farmName, "none", "")
+
+	nodes := map[string]string{config.NodeName: "zone-a", "node-b": "zone-a", "node-c": "zone-a", "node-d": "zone-b"}
+	for nodeName, zone := range nodes {
+		setNodeZoneLocked(&corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:   nodeName,
+			Labels: map[string]string{corev1.LabelZoneFailureDomainStable: zone},
+		}})
+	}
+
+	podsMutex.Lock()
+	podBackendsPerFarm[farmName] = []podBackend{
+		{pod: "default/web-0", nodeName: config.NodeName, backend: types.Backend{Name: "web-0"}},
+		{pod: "default/web-1", nodeName: "node-b", backend: types.Backend{Name: "web-1"}},
+		{pod: "default/web-2", nodeName: "node-c", backend: types.Backend{Name: "web-2"}},
+		{pod: "default/web-3", nodeName: "node-d", backend: types.Backend{Name: "web-3"}},
+	}
+	podsMutex.Unlock()
+	defer func() {
+		HealthChecker.SetCheck(farmName, nil)
+		podsMutex.Lock()
+		for nodeName := range nodes {
+			delete(nodeZones, nodeName)
+		}
+		delete(podsData, "default/web-2")
+		deletePodBackendsLocked(farmName)
+		podsMutex.Unlock()
+	}()
+
+	check := func(step string, want map[string]types.Number) {
+		t.Helper()
+
+		podsMutex.Lock()
+		priorities := topologyPrioritiesLocked(farmName)
+		podsMutex.Unlock()
+
+		for pod, priority := range want {
+			if priorities[pod] != priority {
+				t.Fatalf("%s: got priorities %v, want %v", step, priorities, want)
+			}
+		}
+	}
+
+	// Remote backends are used once every local backend up is down
+	check("every backend up", map[string]types.Number{"default/web-0": 1, "default/web-1": 1, "default/web-2": 1, "default/web-3": 4})
+
+	// Every backend has the same priority with fewer local backends than the minimum
+	setTopology(farmName, "zone", "4")
+	check("fewer local backends than the minimum", map[string]types.Number{"default/web-0": 1, "default/web-1": 1, "default/web-2": 1, "default/web-3": 1})
+
+	// Every backend has the same priority if the zone of this node isn't known
+	podsMutex.Lock()
+	nodeZones[config.NodeName] = ""
+	podsMutex.Unlock()
+	setTopology(farmName, "zone", "1")
+	check("zone of this node unknown", map[string]types.Number{"default/web-0": 1, "default/web-1": 1, "default/web-2": 1, "default/web-3": 1})
+
+	podsMutex.Lock()
+	nodeZones[config.NodeName] = "zone-a"
+	podsMutex.Unlock()
+	setTopology(farmName, "zone", "2")
+
+	// Local backends set off by their Pod aren't counted
+	podsMutex.Lock()
+	podsData["default/web-2"] = podData{settings: map[string]string{"state": "off"}, nodeName: "node-c"}
+	podsMutex.Unlock()
+	check("a local backend off", map[string]types.Number{"default/web-0": 1, "default/web-1": 1, "default/web-2": 1, "default/web-3": 3})
+
+	// Local backends whose health check fails aren't counted, and every backend has the same priority with fewer local
+	// backends up than the minimum
+	setUnhealthy(t, farmName, "web-1")
+	check("a local backend unhealthy", map[string]types.Number{"default/web-0": 1, "default/web-1": 1, "default/web-2": 1, "default/web-3": 1})
+
+	// Farms that don't prefer the zone of this node don't have priorities
+	setTopology(farmName, "none", "")
+	podsMutex.Lock()
+	priorities := topologyPrioritiesLocked(farmName)
+	podsMutex.Unlock()
+	if priorities != nil {
+		t.Fatalf("topology none: got priorities %v, want nil", priorities)
+	}
+}
@@ -0,0 +1,224 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Weights of a TrafficSplit are scaled, so the weight of every backend is near to its share even if it's divided
+// between many endpoints
+const splitWeightScale = 1000
+
+// trafficSplit stores a TrafficSplit with keys (namespace/name) instead of Service names.
+type trafficSplit struct {
+	name     string
+	backends []types.TrafficSplitBackend
+}
+
+var (
+	// It locks every map of this file
+	splitsMutex sync.Mutex
+
+	// Map [root Service (namespace/name)] to { TrafficSplit }
+	splitPerService = make(map[string]trafficSplit)
+
+	// Map [TrafficSplit (namespace/name)] to { root Service (namespace/name) }
+	rootPerSplit = make(map[string]string)
+)
+
+// SetTrafficSplit reads a TrafficSplit. It returns every root Service (namespace/name) whose backends must be updated,
+// and the errors found if the TrafficSplit is invalid (it's ignored then).
+func SetTrafficSplit(obj *unstructured.Unstructured) ([]string, field.ErrorList) {
+	key := podKey(obj.GetNamespace(), obj.GetName())
+	spec, errs := trafficSplitSpec(obj)
+
+	splitsMutex.Lock()
+	defer splitsMutex.Unlock()
+
+	roots := make([]string, 0, 2)
+	if oldRoot, ok := rootPerSplit[key]; ok {
+		roots = append(roots, oldRoot)
+		delete(splitPerService, oldRoot)
+		delete(rootPerSplit, key)
+	}
+
+	root := podKey(obj.GetNamespace(), spec.Service)
+	if other, ok := splitPerService[root]; ok && len(errs) == 0 {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "service"), spec.Service, fmt.Sprintf("Service is already split by %s", other.name)))
+	}
+	if len(errs) > 0 {
+		return roots, errs
+	}
+
+	split := trafficSplit{
+		name:     key,
+		backends: make([]types.TrafficSplitBackend, len(spec.Backends)),
+	}
+	for index, backend := range spec.Backends {
+		split.backends[index] = types.TrafficSplitBackend{
+			Service: podKey(obj.GetNamespace(), backend.Service),
+			Weight:  backend.Weight,
+		}
+	}
+
+	splitPerService[root] = split
+	rootPerSplit[key] = root
+	if len(roots) == 0 || roots[0] != root {
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+// DeleteTrafficSplit forgets a deleted TrafficSplit. It returns the root Service (namespace/name) whose backends must be
+// updated, if any.
+func DeleteTrafficSplit(obj *unstructured.Unstructured) []string {
+	key := podKey(obj.GetNamespace(), obj.GetName())
+
+	splitsMutex.Lock()
+	defer splitsMutex.Unlock()
+
+	root, ok := rootPerSplit[key]
+	if !ok {
+		return nil
+	}
+	delete(splitPerService, root)
+	delete(rootPerSplit, key)
+	return []string{root}
+}
+
+// TrafficSplitUsers returns every root Service (namespace/name) that has a backend Service (namespace/name), so they're
+// updated when the backend Service changes.
+func TrafficSplitUsers(service string) []string {
+	splitsMutex.Lock()
+	defer splitsMutex.Unlock()
+
+	roots := make([]string, 0)
+	for root, split := range splitPerService {
+		for _, backend := range split.backends {
+			if backend.Service == service {
+				roots = append(roots, root)
+				break
+			}
+		}
+	}
+	return roots
+}
+
+// trafficSplitAsNftlb sets the backends of every farm made for an Endpoints object if its Service is the root of a
+// TrafficSplit: they're the endpoints of every backend Service, and their weights are split by the share of their
+// Service.
+func trafficSplitAsNftlb(endpoints *corev1.Endpoints, nftlb *types.Nftlb) {
+	splitsMutex.Lock()
+	split, ok := splitPerService[podKey(endpoints.Namespace, endpoints.Name)]
+	splitsMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	var totalWeight int64
+	for _, backend := range split.backends {
+		totalWeight += backend.Weight
+	}
+
+	for _, farmName := range farmsPerService[endpoints.Name] {
+		portName := farmPortName(farmName)
+		backends := make([]types.Backend, 0)
+
+		for _, splitBackend := range split.backends {
+			if splitBackend.Weight == 0 {
+				continue
+			}
+
+			serviceBackends := serviceBackends(farmName, splitBackend.Service, portName, "split")
+			if len(serviceBackends) == 0 {
+				continue
+			}
+
+			weight := splitWeight(splitBackend.Weight, totalWeight, len(serviceBackends))
+			for index := range serviceBackends {
+				serviceBackends[index].Weight = types.NewNumber(weight)
+			}
+			backends = append(backends, serviceBackends...)
+		}
+
+		// Backends made for Pods of the root Service aren't used
+		deletePodBackends(farmName)
+
+		backendsPerFarm[farmName] = make([]string, len(backends))
+		for index, backend := range backends {
+			backendsPerFarm[farmName][index] = backend.Name
+		}
+
+		found := false
+		for index := range nftlb.Farms {
+			if nftlb.Farms[index].Name == farmName {
+				nftlb.Farms[index].Backends = backends
+				found = true
+			}
+		}
+		if !found {
+			nftlb.Farms = append(nftlb.Farms, types.Farm{
+				Name:     farmName,
+				Backends: backends,
+			})
+		}
+	}
+}
+
+// splitWeight returns the weight of every endpoint of a backend Service: the share of the Service is divided between its
+// endpoints (the lowest weight accepted by nftlb is 1).
+func splitWeight(weight int64, totalWeight int64, endpoints int) uint32 {
+	split := math.Round(float64(weight) * splitWeightScale / float64(totalWeight) / float64(endpoints))
+	return uint32(math.Max(split, 1))
+}
+
+// trafficSplitSpec reads and checks the spec of a TrafficSplit.
+func trafficSplitSpec(obj *unstructured.Unstructured) (*types.TrafficSplitSpec, field.ErrorList) {
+	fldPath := field.NewPath("spec")
+	spec := &types.TrafficSplitSpec{}
+
+	specMap, _, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return spec, field.ErrorList{field.Invalid(fldPath, nil, err.Error())}
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(specMap, spec); err != nil {
+		return spec, field.ErrorList{field.Invalid(fldPath, nil, err.Error())}
+	}
+
+	allErrs := field.ErrorList{}
+	if spec.Service == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("service"), ""))
+	}
+	if len(spec.Backends) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("backends"), "at least 1 backend Service"))
+	}
+
+	var totalWeight int64
+	seen := make(map[string]bool)
+	for index, backend := range spec.Backends {
+		backendPath := fldPath.Child("backends").Index(index)
+		if backend.Service == "" {
+			allErrs = append(allErrs, field.Required(backendPath.Child("service"), ""))
+		} else if seen[backend.Service] {
+			allErrs = append(allErrs, field.Duplicate(backendPath.Child("service"), backend.Service))
+		}
+		seen[backend.Service] = true
+
+		allErrs = append(allErrs, validation.Integer(fmt.Sprint(backend.Weight), 0, math.MaxUint32, backendPath.Child("weight"))...)
+		totalWeight += backend.Weight
+	}
+	if len(spec.Backends) > 0 && totalWeight <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("backends"), totalWeight, "at least 1 backend Service must have weight"))
+	}
+
+	return spec, allErrs
+}
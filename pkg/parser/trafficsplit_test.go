@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newTrafficSplit returns a TrafficSplit in the default namespace.
+func newTrafficSplit(name string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	return obj
+}
+
+// splitBackends returns the backends of a TrafficSplit spec, given as Service and weight pairs.
+func splitBackends(pairs ...interface{}) []interface{} {
+	backends := make([]interface{}, 0, len(pairs)/2)
+	for index := 0; index < len(pairs); index += 2 {
+		backends = append(backends, map[string]interface{}{"service": pairs[index], "weight": pairs[index+1]})
+	}
+	return backends
+}
+
+func TestTrafficSplitSpec(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   map[string]interface{}
+		fields []string // Fields with errors
+	}{
+		{
+			name: "valid",
+			spec: map[string]interface{}{"service": "web", "backends": splitBackends("web-v1", int64(90), "web-v2", int64(10))},
+		},
+		{
+			name: "backend without weight",
+			spec: map[string]interface{}{"service": "web", "backends": splitBackends("web-v1", int64(1), "web-v2", int64(0))},
+		},
+		{
+			name:   "without root Service and backends",
+			spec:   map[string]interface{}{},
+			fields: []string{"spec.service", "spec.backends"},
+		},
+		{
+			name:   "duplicated backend",
+			spec:   map[string]interface{}{"service": "web", "backends": splitBackends("web-v1", int64(1), "web-v1", int64(2))},
+			fields: []string{"spec.backends[1].service"},
+		},
+		{
+			name:   "backend without Service",
+			spec:   map[string]interface{}{"service": "web", "backends": splitBackends("", int64(1), "web-v2", int64(1))},
+			fields: []string{"spec.backends[0].service"},
+		},
+		{
+			name:   "negative weight",
+			spec:   map[string]interface{}{"service": "web", "backends": splitBackends("web-v1", int64(-1), "web-v2", int64(2))},
+			fields: []string{"spec.backends[0].weight"},
+		},
+		{
+			name:   "weight out of range",
+			spec:   map[string]interface{}{"service": "web", "backends": splitBackends("web-v1", int64(4294967296))},
+			fields: []string{"spec.backends[0].weight"},
+		},
+		{
+			name:   "every weight is 0",
+			spec:   map[string]interface{}{"service": "web", "backends": splitBackends("web-v1", int64(0), "web-v2", int64(0))},
+			fields: []string{"spec.backends"},
+		},
+		{
+			name:   "wrong type",
+			spec:   map[string]interface{}{"service": "web", "backends": "web-v1"},
+			fields: []string{"spec"},
+		},
+	}
+
+	for _, test := range tests {
+		_, errs := trafficSplitSpec(newTrafficSplit("split", test.spec))
+		fields := make([]string, 0, len(errs))
+		for _, err := range errs {
+			fields = append(fields, err.Field)
+		}
+		if len(fields) != len(test.fields) || (len(fields) > 0 && !reflect.DeepEqual(fields, test.fields)) {
+			t.Errorf("%s: got errors %v, want errors in %v", test.name, errs, test.fields)
+		}
+	}
+}
+
+func TestSplitWeight(t *testing.T) {
+	tests := []struct {
+		weight      int64
+		totalWeight int64
+		endpoints   int
+		want        uint32
+	}{
+		// The share of every Service is scaled
+		{90, 100, 1, 900},
+		{10, 100, 1, 100},
+		{1, 1, 1, 1000},
+
+		// And divided between its endpoints
+		{90, 100, 3, 300},
+		{10, 100, 4, 25},
+		{1, 3, 1, 333},
+		{2, 3, 3, 222},
+
+		// The lowest weight is 1
+		{1, 10000, 1, 1},
+		{1, 100, 1000, 1},
+	}
+
+	for _, test := range tests {
+		if got := splitWeight(test.weight, test.totalWeight, test.endpoints); got != test.want {
+			t.Errorf("weight %d of %d for %d endpoints: got %d, want %d", test.weight, test.totalWeight, test.endpoints, got, test.want)
+		}
+	}
+}
+
+func TestSetTrafficSplit(t *testing.T) {
+	split := newTrafficSplit("web-split", map[string]interface{}{"service": "web", "backends": splitBackends("web-v1", int64(90), "web-v2", int64(10))})
+	defer DeleteTrafficSplit(split)
+
+	roots, errs := SetTrafficSplit(split)
+	if len(errs) > 0 || !reflect.DeepEqual(roots, []string{"default/web"}) {
+		t.Fatalf("got roots %v and errors %v, want default/web", roots, errs)
+	}
+	if users := TrafficSplitUsers("default/web-v2"); !reflect.DeepEqual(users, []string{"default/web"}) {
+		t.Fatalf("got users %v, want default/web", users)
+	}
+	if backends := splitPerService["default/web"].backends; len(backends) != 2 || backends[0].Service != "default/web-v1" || backends[0].Weight != 90 {
+		t.Fatalf("got backends %+v, want web-v1 and web-v2 in the default namespace", backends)
+	}
+
+	// A root Service can't be split by 2 TrafficSplits, the older one is kept
+	other := newTrafficSplit("other-split", map[string]interface{}{"service": "web", "backends": splitBackends("web-v3", int64(1))})
+	if _, errs := SetTrafficSplit(other); len(errs) != 1 {
+		t.Fatalf("got errors %v, want the root Service already split", errs)
+	}
+	if splitPerService["default/web"].name != "default/web-split" {
+		t.Fatalf("got TrafficSplit %s, want default/web-split", splitPerService["default/web"].name)
+	}
+
+	// The old and the new root Services are updated when the root Service changes
+	split.Object["spec"] = map[string]interface{}{"service": "front", "backends": splitBackends("web-v1", int64(1))}
+	if roots, errs := SetTrafficSplit(split); len(errs) > 0 || !reflect.DeepEqual(roots, []string{"default/web", "default/front"}) {
+		t.Fatalf("got roots %v and errors %v, want default/web and default/front", roots, errs)
+	}
+	if users := TrafficSplitUsers("default/web-v2"); len(users) != 0 {
+		t.Fatalf("got users %v, want none", users)
+	}
+
+	// An invalid TrafficSplit is ignored, and its old root Service is updated
+	split.Object["spec"] = map[string]interface{}{"service": "front"}
+	if roots, errs := SetTrafficSplit(split); len(errs) == 0 || !reflect.DeepEqual(roots, []string{"default/front"}) {
+		t.Fatalf("got roots %v and errors %v, want default/front and errors", roots, errs)
+	}
+	if _, ok := splitPerService["default/front"]; ok {
+		t.Fatal("got an invalid TrafficSplit, want it ignored")
+	}
+	if roots := DeleteTrafficSplit(split); len(roots) != 0 {
+		t.Fatalf("got roots %v of an ignored TrafficSplit, want none", roots)
+	}
+}
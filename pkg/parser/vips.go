@@ -0,0 +1,266 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zevenet/kube-nftlb/pkg/events"
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+	"k8s.io/client-go/tools/cache"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Services with the same shared key can use the same externalIP or LoadBalancer IP, as long as their ports don't overlap.
+const sharedKeyAnnotation = validation.ServiceAnnotationPrefix + validation.SharedKeyAnnotation
+
+// vipClaim stores which ports of a VIP are used by a Service.
+type vipClaim struct {
+	sharedKey string
+	created   metav1.Time
+	ports     map[string]bool
+}
+
+var (
+	vipsMutex sync.Mutex
+
+	// Map [VIP] to [Service key] to { claim }
+	vipClaims = make(map[string]map[string]*vipClaim)
+
+	// Map [VIP port (ip:port/protocol)] to [Service key] that lost that VIP port to an older Service. Services that lost a
+	// VIP to an older Service with another shared key wait for the whole VIP (ip:)
+	vipWaiters = make(map[string]map[string]bool)
+
+	// Services that must be parsed again, because they lost a VIP port or a VIP port they were waiting for was released
+	displacedServices = make(map[string]bool)
+)
+
+// DisplacedServices returns the Service keys that must be parsed again after claiming or releasing VIPs.
+func DisplacedServices() []string {
+	vipsMutex.Lock()
+	defer vipsMutex.Unlock()
+
+	keys := make([]string, 0, len(displacedServices))
+	for key := range displacedServices {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	displacedServices = make(map[string]bool)
+
+	return keys
+}
+
+// HasDisplacedServices returns true if some Service must be parsed again.
+func HasDisplacedServices() bool {
+	vipsMutex.Lock()
+	defer vipsMutex.Unlock()
+
+	return len(displacedServices) > 0
+}
+
+// claimVIPs claims every externalIP and LoadBalancer IP port of the ServicePorts of a Service programmed in this node.
+// Services can only use the same VIP if they have the same shared key, and never the same port. The older Service wins
+// every conflict: it returns a map [VIP port] to { older Service key } that mustn't be programmed for this Service.
+// Only the ports that the Service stops using are released, so Services waiting for other ports aren't displaced.
+func claimVIPs(service *corev1.Service, servicePorts []corev1.ServicePort) map[string]string {
+	vipsMutex.Lock()
+	defer vipsMutex.Unlock()
+
+	key := serviceKey(service)
+	deleteWaiterLocked(key)
+
+	claims := make(map[string]*vipClaim)
+	conflicts := make(map[string]string)
+
+	for _, vip := range serviceVIPs(service) {
+		ownClaim := &vipClaim{
+			sharedKey: sharedKey(service),
+			created:   service.CreationTimestamp,
+			ports:     make(map[string]bool),
+		}
+
+		for _, servicePort := range servicePorts {
+			port := formatVIPPort(&servicePort)
+			vipPort := formatVIPConflict(vip, port)
+			winner, waitFor := "", vipPort
+
+			for otherKey, other := range vipClaims[vip] {
+				if otherKey == key || (sameSharedKey(other, ownClaim) && !other.ports[port]) {
+					continue
+				}
+
+				if isOlder(other, otherKey, ownClaim, key) {
+					winner = otherKey
+					if !sameSharedKey(other, ownClaim) {
+						waitFor = formatVIPConflict(vip, "")
+					}
+				} else {
+					displacedServices[otherKey] = true
+				}
+			}
+
+			if winner != "" {
+				conflicts[vipPort] = winner
+				if vipWaiters[waitFor] == nil {
+					vipWaiters[waitFor] = make(map[string]bool)
+				}
+				vipWaiters[waitFor][key] = true
+				continue
+			}
+
+			ownClaim.ports[port] = true
+		}
+
+		if len(ownClaim.ports) > 0 {
+			claims[vip] = ownClaim
+		}
+	}
+
+	setClaimsLocked(key, claims)
+
+	// Record conflicts (if any)
+	for vipPort, winner := range conflicts {
+		events.Warning(service, "VIPConflict", fmt.Sprintf("%s is already used by Service %s, it won't be programmed for this Service", vipPort, winner))
+	}
+	metrics.ServicesVIPConflicts.WithLabelValues(service.Namespace, service.Name).Set(float64(len(conflicts)))
+
+	return conflicts
+}
+
+// releaseVIPs releases every VIP claimed by a Service (for example, when it's deleted or it isn't programmed in this
+// node anymore).
+func releaseVIPs(service *corev1.Service) {
+	vipsMutex.Lock()
+	defer vipsMutex.Unlock()
+
+	key := serviceKey(service)
+	deleteWaiterLocked(key)
+	setClaimsLocked(key, nil)
+	metrics.ServicesVIPConflicts.DeleteLabelValues(service.Namespace, service.Name)
+}
+
+// setClaimsLocked replaces the claims of a Service (map [VIP] to { claim }). Services waiting for a port that the
+// Service doesn't use anymore are displaced.
+func setClaimsLocked(key string, claims map[string]*vipClaim) {
+	for vip, vipServices := range vipClaims {
+		oldClaim, ok := vipServices[key]
+		if !ok {
+			continue
+		}
+
+		// Services with another shared key wait for the whole VIP, until it's released or the shared key changes
+		if claims[vip] == nil || claims[vip].sharedKey != oldClaim.sharedKey {
+			displaceWaitersLocked(formatVIPConflict(vip, ""), key)
+		}
+
+		for port := range oldClaim.ports {
+			if claims[vip] == nil || !claims[vip].ports[port] {
+				displaceWaitersLocked(formatVIPConflict(vip, port), key)
+			}
+		}
+
+		delete(vipServices, key)
+		if len(vipServices) == 0 {
+			delete(vipClaims, vip)
+		}
+	}
+
+	for vip, claim := range claims {
+		if vipClaims[vip] == nil {
+			vipClaims[vip] = make(map[string]*vipClaim)
+		}
+		vipClaims[vip][key] = claim
+	}
+}
+
+// displaceWaitersLocked displaces every Service waiting for a VIP port that has been released. The Service that has
+// released it can be waiting for that port now, it's kept as a waiter.
+func displaceWaitersLocked(vipPort string, key string) {
+	waiting := vipWaiters[vipPort][key]
+	for waiter := range vipWaiters[vipPort] {
+		if waiter != key {
+			displacedServices[waiter] = true
+		}
+	}
+	delete(vipWaiters, vipPort)
+	if waiting {
+		vipWaiters[vipPort] = map[string]bool{key: true}
+	}
+}
+
+// deleteWaiterLocked forgets every VIP port that a Service was waiting for, they're found again when it's claimed.
+func deleteWaiterLocked(key string) {
+	for vipPort, waiters := range vipWaiters {
+		delete(waiters, key)
+		if len(waiters) == 0 {
+			delete(vipWaiters, vipPort)
+		}
+	}
+}
+
+// serviceVIPs returns every externalIP and LoadBalancer IP of a Service.
+func serviceVIPs(service *corev1.Service) []string {
+	return append(append([]string{}, service.Spec.ExternalIPs...), loadBalancerIPs(service)...)
+}
+
+// loadBalancerIPs returns the IPs assigned to a LoadBalancer Service.
+func loadBalancerIPs(service *corev1.Service) []string {
+	ips := make([]string, 0)
+	if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return ips
+	}
+
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			ips = append(ips, ingress.IP)
+		}
+	}
+
+	return ips
+}
+
+// vipAddressName returns the name (without the --address suffix) of the address of an externalIP or LoadBalancer IP.
+// Addresses of Services with a shared key are named after it, so a shared VIP port is a single address whatever
+// Service programs it. Other addresses keep the name made for the Service.
+func vipAddressName(serviceData *types.ServiceData, name string, address *types.Address) string {
+	if serviceData.SharedKey == "" {
+		return name
+	}
+	return FormatSharedName(serviceData.SharedKey, address.IPAddr, address.Ports, address.Protocol)
+}
+
+// sharedKey returns the shared key of a Service, empty if it doesn't share its VIPs.
+func sharedKey(service *corev1.Service) string {
+	return service.Annotations[sharedKeyAnnotation]
+}
+
+// sameSharedKey returns true if both claims were made by Services that share their VIPs with the same shared key.
+func sameSharedKey(claim *vipClaim, otherClaim *vipClaim) bool {
+	return claim.sharedKey != "" && claim.sharedKey == otherClaim.sharedKey
+}
+
+// isOlder returns true if the first claim was made by a Service older than the second one.
+func isOlder(claim *vipClaim, key string, otherClaim *vipClaim, otherKey string) bool {
+	if !claim.created.Equal(&otherClaim.created) {
+		return claim.created.Before(&otherClaim.created)
+	}
+	return key < otherKey
+}
+
+func serviceKey(service *corev1.Service) string {
+	key, _ := cache.MetaNamespaceKeyFunc(service)
+	return key
+}
+
+func formatVIPPort(servicePort *corev1.ServicePort) string {
+	return fmt.Sprintf("%d/%s", servicePort.Port, strings.ToLower(string(servicePort.Protocol)))
+}
+
+func formatVIPConflict(vip string, port string) string {
+	return fmt.Sprintf("%s:%s", vip, port)
+}
@@ -0,0 +1,204 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newVIPService returns a Service created at the given minute that uses ports of an externalIP.
+func newVIPService(name string, minute int, sharedKey string, ports ...int32) *corev1.Service {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(time.Date(2020, 1, 1, 0, minute, 0, 0, time.UTC)),
+			Annotations:       make(map[string]string),
+		},
+		Spec: corev1.ServiceSpec{
+			ExternalIPs: []string{"192.168.0.10"},
+		},
+	}
+	if sharedKey != "" {
+		service.Annotations["service.kubernetes.io/kube-nftlb-load-balancer-shared-key"] = sharedKey
+	}
+	for _, port := range ports {
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{Port: port, Protocol: corev1.ProtocolTCP})
+	}
+	return service
+}
+
+// claimAllVIPs claims VIPs for every ServicePort of a Service, as if every port is programmed in this node.
+func claimAllVIPs(service *corev1.Service) map[string]string {
+	return claimVIPs(service, service.Spec.Ports)
+}
+
+func resetVIPs() {
+	vipClaims = make(map[string]map[string]*vipClaim)
+	vipWaiters = make(map[string]map[string]bool)
+	displacedServices = make(map[string]bool)
+}
+
+func TestClaimVIPsSharedKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		sharedKey string
+		ports     []int32
+		conflicts []string // VIP ports used by default/a (shared key "dns", port 53)
+	}{
+		{"same shared key, other port", "dns", []int32{54}, nil},
+		{"same shared key, same port", "dns", []int32{53, 54}, []string{"192.168.0.10:53/tcp"}},
+		{"other shared key", "other", []int32{54}, []string{"192.168.0.10:54/tcp"}},
+		{"no shared key", "", []int32{54, 55}, []string{"192.168.0.10:54/tcp", "192.168.0.10:55/tcp"}},
+	}
+
+	for _, test := range tests {
+		resetVIPs()
+		if conflicts := claimAllVIPs(newVIPService("a", 0, "dns", 53)); len(conflicts) != 0 {
+			t.Fatalf("%s: a: unexpected conflicts %v", test.name, conflicts)
+		}
+
+		// The older Service wins every conflict
+		conflicts := claimAllVIPs(newVIPService("b", 1, test.sharedKey, test.ports...))
+		if len(conflicts) != len(test.conflicts) {
+			t.Fatalf("%s: got conflicts %v, want %v used by default/a", test.name, conflicts, test.conflicts)
+		}
+		for _, vipPort := range test.conflicts {
+			if conflicts[vipPort] != "default/a" {
+				t.Fatalf("%s: got conflicts %v, want %v used by default/a", test.name, conflicts, test.conflicts)
+			}
+		}
+		if keys := DisplacedServices(); len(keys) != 0 {
+			t.Fatalf("%s: unexpected displaced Services %v", test.name, keys)
+		}
+	}
+	resetVIPs()
+}
+
+func TestClaimVIPsOtherSharedKeyWaitsForTheVIP(t *testing.T) {
+	resetVIPs()
+	defer resetVIPs()
+
+	older := newVIPService("older", 0, "dns", 53)
+	newer := newVIPService("newer", 1, "web", 80)
+	claimAllVIPs(older)
+	if conflicts := claimAllVIPs(newer); conflicts["192.168.0.10:80/tcp"] != "default/older" {
+		t.Fatalf("newer: got conflicts %v, want 192.168.0.10:80/tcp used by default/older", conflicts)
+	}
+
+	// The newer Service gets the VIP once the older one stops using it, even if it never used port 80
+	releaseVIPs(older)
+	if keys := DisplacedServices(); len(keys) != 1 || keys[0] != "default/newer" {
+		t.Fatalf("got displaced Services %v, want default/newer", keys)
+	}
+	if conflicts := claimAllVIPs(newer); len(conflicts) != 0 {
+		t.Fatalf("newer: unexpected conflicts %v", conflicts)
+	}
+}
+
+func TestVIPAddressName(t *testing.T) {
+	address := &types.Address{IPAddr: "192.168.0.10", Ports: "53,5353", Protocol: types.ProtocolUDP}
+
+	// Addresses of Services with a shared key don't depend on the Service
+	for _, name := range []string{"dns--dns--externalIP-1", "resolver--ports--udp--externalIP-2"} {
+		serviceData := &types.ServiceData{Name: "dns", SharedKey: "dns"}
+		if got := vipAddressName(serviceData, name, address); got != "shared--dns--192.168.0.10--53_5353-udp" {
+			t.Errorf("%s: got %q, want the shared address", name, got)
+		}
+	}
+
+	if got := vipAddressName(&types.ServiceData{Name: "dns"}, "dns--dns--externalIP-1", address); got != "dns--dns--externalIP-1" {
+		t.Errorf("got %q, want the name made for the Service", got)
+	}
+}
+
+func TestClaimVIPsWaitersAreNotDisplacedByOtherPorts(t *testing.T) {
+	resetVIPs()
+	defer resetVIPs()
+
+	older := newVIPService("older", 0, "web", 80)
+	first := newVIPService("first", 1, "web", 80, 81)
+	second := newVIPService("second", 2, "web", 80, 82)
+	claimAllVIPs(older)
+	claimAllVIPs(first)
+	claimAllVIPs(second)
+	DisplacedServices()
+
+	// Both newer Services wait for the port of the older one, parsing them again doesn't displace the other one
+	for i := 0; i < 3; i++ {
+		releaseVIPs(first)
+		claimAllVIPs(first)
+		claimAllVIPs(second)
+		if keys := DisplacedServices(); len(keys) != 0 {
+			t.Fatalf("pass %d: unexpected displaced Services %v", i, keys)
+		}
+	}
+
+	// Parsing the older Service again doesn't release its port
+	claimAllVIPs(older)
+	if keys := DisplacedServices(); len(keys) != 0 {
+		t.Fatalf("unexpected displaced Services %v", keys)
+	}
+
+	// Once the older Service is deleted, both newer Services are displaced and the oldest of them gets the port
+	releaseVIPs(older)
+	if keys := DisplacedServices(); len(keys) != 2 || keys[0] != "default/first" || keys[1] != "default/second" {
+		t.Fatalf("got displaced Services %v, want default/first and default/second", keys)
+	}
+	if conflicts := claimAllVIPs(first); len(conflicts) != 0 {
+		t.Fatalf("first: unexpected conflicts %v", conflicts)
+	}
+	if conflicts := claimAllVIPs(second); conflicts["192.168.0.10:80/tcp"] != "default/first" {
+		t.Fatalf("second: got conflicts %v, want 192.168.0.10:80/tcp used by default/first", conflicts)
+	}
+	if keys := DisplacedServices(); len(keys) != 0 {
+		t.Fatalf("unexpected displaced Services %v", keys)
+	}
+}
+
+func TestClaimVIPsOlderServiceDisplacesNewer(t *testing.T) {
+	resetVIPs()
+	defer resetVIPs()
+
+	newer := newVIPService("newer", 1, "", 80)
+	claimAllVIPs(newer)
+
+	// An older Service (for example, one that was out of scope) takes the port back
+	if conflicts := claimAllVIPs(newVIPService("older", 0, "", 80)); len(conflicts) != 0 {
+		t.Fatalf("older: unexpected conflicts %v", conflicts)
+	}
+	if keys := DisplacedServices(); len(keys) != 1 || keys[0] != "default/newer" {
+		t.Fatalf("got displaced Services %v, want default/newer", keys)
+	}
+	if conflicts := claimAllVIPs(newer); conflicts["192.168.0.10:80/tcp"] != "default/older" {
+		t.Fatalf("newer: got conflicts %v, want 192.168.0.10:80/tcp used by default/older", conflicts)
+	}
+	if keys := DisplacedServices(); len(keys) != 0 {
+		t.Fatalf("unexpected displaced Services %v", keys)
+	}
+}
+
+func TestClaimVIPsOnlyPortsInScope(t *testing.T) {
+	resetVIPs()
+	defer resetVIPs()
+
+	// The older Service only programs port 53 in this node, so port 54 is free for the newer one
+	older := newVIPService("older", 0, "dns", 53, 54)
+	if conflicts := claimVIPs(older, older.Spec.Ports[:1]); len(conflicts) != 0 {
+		t.Fatalf("older: unexpected conflicts %v", conflicts)
+	}
+	newer := newVIPService("newer", 1, "dns", 53, 54)
+	if conflicts := claimVIPs(newer, newer.Spec.Ports[1:]); len(conflicts) != 0 {
+		t.Fatalf("newer: unexpected conflicts %v", conflicts)
+	}
+
+	// Once every port is programmed, the older Service wins the port
+	claimAllVIPs(older)
+	if conflicts := claimAllVIPs(newer); conflicts["192.168.0.10:54/tcp"] != "default/older" {
+		t.Fatalf("newer: got conflicts %v, want 192.168.0.10:54/tcp used by default/older", conflicts)
+	}
+}
@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/zevenet/kube-nftlb/pkg/metrics"
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Automatic weights are between 1 and maxAutoWeight, the backend with more resources gets maxAutoWeight
+const maxAutoWeight = 100
+
+// resources stores CPU (millicores) and memory (bytes) of a Pod or a Node.
+type resources struct {
+	cpu    int64
+	memory int64
+}
+
+var (
+	// Map [Node (name)] to { allocatable resources }
+	nodeResources = make(map[string]resources)
+
+	// Map [farm (name)] to { auto-weight setting }, only for farms with automatic weights
+	autoWeightPerFarm = make(map[string]string)
+)
+
+// SetNode reads the allocatable resources and the zone of a Node. It returns true if they have changed.
+func SetNode(node *corev1.Node) bool {
+	allocatable := resources{
+		cpu:    node.Status.Allocatable.Cpu().MilliValue(),
+		memory: node.Status.Allocatable.Memory().Value(),
+	}
+
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	zoneChanged := setNodeZoneLocked(node)
+	oldAllocatable, exists := nodeResources[node.Name]
+	nodeResources[node.Name] = allocatable
+	return !exists || !reflect.DeepEqual(oldAllocatable, allocatable) || zoneChanged
+}
+
+// DeleteNode forgets the allocatable resources and the zone of a deleted Node.
+func DeleteNode(node *corev1.Node) {
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	delete(nodeResources, node.Name)
+	delete(nodeZones, node.Name)
+}
+
+// NodeNames returns the name of every known Node.
+func NodeNames() map[string]bool {
+	podsMutex.RLock()
+	defer podsMutex.RUnlock()
+
+	names := make(map[string]bool, len(nodeResources))
+	for name := range nodeResources {
+		names[name] = true
+	}
+	return names
+}
+
+// NodeAsNftlb returns a Nftlb struct with every backend of farms whose automatic weights or topology priorities
+// depend on a Node.
+func NodeAsNftlb(node *corev1.Node) *types.Nftlb {
+	return podBackendsAsNftlb(func(farmName string, podBackend podBackend) bool {
+		autoWeight := autoWeightPerFarm[farmName]
+		if (autoWeight == "node-cpu" || autoWeight == "node-memory") && podsData[podBackend.pod].nodeName == node.Name {
+			return true
+		}
+		return topologyDependsOnLocked(farmName, podBackend, node.Name)
+	})
+}
+
+// setAutoWeight keeps the auto-weight setting of a farm.
+func setAutoWeight(farmName string, autoWeight string) {
+	podsMutex.Lock()
+	defer podsMutex.Unlock()
+
+	if autoWeight == "" || autoWeight == "none" {
+		delete(autoWeightPerFarm, farmName)
+		return
+	}
+	autoWeightPerFarm[farmName] = autoWeight
+}
+
+// autoWeightsLocked returns the automatic weight of every Pod with backends in a farm, normalised between 1 and
+// maxAutoWeight. It returns nil if the farm doesn't have automatic weights.
+func autoWeightsLocked(farmName string) map[string]types.Number {
+	autoWeight, ok := autoWeightPerFarm[farmName]
+	if !ok {
+		return nil
+	}
+
+	// Map [Pod (namespace/name)] to { resource used to find its weight }
+	values := make(map[string]int64)
+	var maxValue int64
+	for _, podBackend := range podBackendsPerFarm[farmName] {
+		data := podsData[podBackend.pod]
+
+		var value int64
+		switch autoWeight {
+		case "cpu":
+			value = data.resources.cpu
+		case "memory":
+			value = data.resources.memory
+		case "node-cpu":
+			value = nodeResources[data.nodeName].cpu
+		case "node-memory":
+			value = nodeResources[data.nodeName].memory
+		}
+
+		values[podBackend.pod] = value
+		if value > maxValue {
+			maxValue = value
+		}
+	}
+
+	weights := make(map[string]types.Number, len(values))
+	for key, value := range values {
+		// Every backend has the same weight if no one has resources
+		weight := int64(1)
+		if maxValue > 0 {
+			weight = int64(math.Round(float64(value) * maxAutoWeight / float64(maxValue)))
+		}
+		if weight < 1 {
+			weight = 1
+		}
+		weights[key] = types.Number(weight)
+	}
+
+	// Export automatic weights
+	for _, podBackend := range podBackendsPerFarm[farmName] {
+		metrics.BackendsAutoWeight.WithLabelValues(farmName, podBackend.backend.Name).Set(float64(weights[podBackend.pod]))
+	}
+
+	return weights
+}
+
+// deleteAutoWeightMetric stops exporting the automatic weight of a backend.
+func deleteAutoWeightMetric(farmName string, backendName string) {
+	metrics.BackendsAutoWeight.DeleteLabelValues(farmName, backendName)
+}
+
+// podResources returns the resources requested by every container of a Pod.
+func podResources(pod *corev1.Pod) resources {
+	requests := resources{}
+	for _, container := range pod.Spec.Containers {
+		requests.cpu += container.Resources.Requests.Cpu().MilliValue()
+		requests.memory += container.Resources.Requests.Memory().Value()
+	}
+	return requests
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newResourcesPod returns a Pod in a Node, with a container that requests some CPU and memory.
+func newResourcesPod(name string, nodeName string, cpu string, memory string) *corev1.Pod {
+	pod := newPod(name, nil)
+	pod.Spec.NodeName = nodeName
+	pod.Spec.Containers = []corev1.Container{{
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(memory),
+			},
+		},
+	}}
+	return pod
+}
+
+// newNode returns a Node with some allocatable CPU and memory.
+func newNode(name string, cpu string, memory string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(memory),
+			},
+		},
+	}
+}
+
+func TestAutoWeights(t *testing.T) {
+	pods := []*corev1.Pod{
+		newResourcesPod("pod-a", "node-1", "2", "1Gi"),
+		newResourcesPod("pod-b", "node-2", "500m", "4Gi"),
+		newResourcesPod("pod-c", "node-2", "1m", "1Gi"),
+	}
+	nodes := []*corev1.Node{
+		newNode("node-1", "4", "8Gi"),
+		newNode("node-2", "16", "8Gi"),
+	}
+	for _, pod := range pods {
+		SetPod(pod)
+		defer DeletePod(pod)
+	}
+	for _, node := range nodes {
+		SetNode(node)
+		defer DeleteNode(node)
+	}
+	defer deletePodBackends("web--http")
+	defer delete(backendsPerFarm, "web--http")
+	defer setAutoWeight("web--http", "none")
+
+	tests := []struct {
+		autoWeight string
+		weights    map[string]string
+	}{
+		// The backend with more resources gets the maximum weight, and every backend gets 1 at least
+		{"cpu", map[string]string{"pod-a--http": "100", "pod-b--http": "25", "pod-c--http": "1"}},
+		{"memory", map[string]string{"pod-a--http": "25", "pod-b--http": "100", "pod-c--http": "25"}},
+		{"node-cpu", map[string]string{"pod-a--http": "25", "pod-b--http": "100", "pod-c--http": "100"}},
+		{"node-memory", map[string]string{"pod-a--http": "100", "pod-b--http": "100", "pod-c--http": "100"}},
+		// Without automatic weights, nftlb keeps its default weight
+		{"none", map[string]string{"pod-a--http": "", "pod-b--http": "", "pod-c--http": ""}},
+	}
+
+	for _, test := range tests {
+		setAutoWeight("web--http", test.autoWeight)
+
+		nftlb := EndpointsAsNftlb(newPodEndpoints("web", "pod-a", "pod-b", "pod-c"))
+		if len(nftlb.Farms) != 1 {
+			t.Fatalf("%s: got farms %+v, want 1 farm", test.autoWeight, nftlb.Farms)
+		}
+		for _, backend := range nftlb.Farms[0].Backends {
+			if formatNumber(backend.Weight) != test.weights[backend.Name] {
+				t.Errorf("%s: %s: got weight %q, want %q", test.autoWeight, backend.Name, formatNumber(backend.Weight), test.weights[backend.Name])
+			}
+		}
+	}
+
+	// Weights set by a Pod annotation override automatic weights
+	setAutoWeight("web--http", "cpu")
+	SetPod(newPod("pod-c", map[string]string{"weight": "50"}))
+	nftlb := EndpointsAsNftlb(newPodEndpoints("web", "pod-a", "pod-b", "pod-c"))
+	if backend := nftlb.Farms[0].Backends[2]; formatNumber(backend.Weight) != "50" {
+		t.Fatalf("pod-c: got weight %q, want 50", formatNumber(backend.Weight))
+	}
+}
+
+func TestNodeAsNftlb(t *testing.T) {
+	pod := newResourcesPod("pod-a", "node-1", "1", "1Gi")
+	node := newNode("node-1", "4", "8Gi")
+	SetPod(pod)
+	defer DeletePod(pod)
+	defer DeleteNode(node)
+	defer deletePodBackends("web--http")
+	defer delete(backendsPerFarm, "web--http")
+	defer setAutoWeight("web--http", "none")
+
+	if !SetNode(node) {
+		t.Fatal("new Node: got unchanged")
+	}
+	if SetNode(node) {
+		t.Fatal("same Node: got changed")
+	}
+
+	// Only farms whose weights depend on Nodes are updated
+	setAutoWeight("web--http", "cpu")
+	EndpointsAsNftlb(newPodEndpoints("web", "pod-a"))
+	if nftlb := NodeAsNftlb(node); len(nftlb.Farms) != 0 {
+		t.Fatalf("cpu: got farms %+v, want none", nftlb.Farms)
+	}
+
+	setAutoWeight("web--http", "node-cpu")
+	if nftlb := NodeAsNftlb(node); len(nftlb.Farms) != 1 || len(nftlb.Farms[0].Backends) != 1 {
+		t.Fatalf("node-cpu: got farms %+v, want 1 farm with the backend of pod-a", nftlb.Farms)
+	}
+}
@@ -0,0 +1,178 @@
+package processor
+
+import (
+	"math"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Service annotations read by kube-nftlb itself instead of nftlb (without prefix)
+const (
+	AutoWeightSetting      = "auto-weight"
+	SlowStartSetting       = "slow-start"
+	DrainTimeoutSetting    = "drain-timeout"
+	NoEndpointsSetting     = "no-endpoints"
+	FallbackServiceSetting = "fallback-service"
+	FarmTemplateSetting    = "farm-template"
+	NodeSelectorSetting    = "node-selector"
+
+	// Backends in the zone of the node are preferred
+	TopologySetting         = "topology"
+	TopologyMinLocalSetting = "topology-min-local-endpoints"
+
+	// Health checks of backends
+	HealthCheckSetting                   = "health-check"
+	HealthCheckIntervalSetting           = "health-check-interval"
+	HealthCheckTimeoutSetting            = "health-check-timeout"
+	HealthCheckHealthyThresholdSetting   = "health-check-healthy-threshold"
+	HealthCheckUnhealthyThresholdSetting = "health-check-unhealthy-threshold"
+	HealthCheckPortSetting               = "health-check-port"
+	HealthCheckHTTPPathSetting           = "health-check-http-path"
+	HealthCheckHTTPStatusSetting         = "health-check-http-status"
+)
+
+func init() {
+	// Farm settings (helper doesn't have a default value, it's found for every ServicePort unless it's set). Settings
+	// without a default value aren't sent unless they're set, so nftlb uses its own default value
+	for _, processor := range []Processor{
+		&FarmSetting{Setting{"mode", "snat", validation.Mode}, func(farm *types.Farm, value string) {
+			farm.Mode = types.Mode(value)
+		}},
+		&FarmSetting{Setting{"scheduler", "rr", validation.Scheduler}, func(farm *types.Farm, value string) {
+			farm.Scheduler = types.Scheduler(value)
+		}},
+		&FarmSetting{Setting{"sched-param", "none", validation.SchedParam}, func(farm *types.Farm, value string) {
+			farm.SchedParam = types.SchedParam(value)
+		}},
+		&FarmSetting{Setting{"persistence", "none", validation.Persistence}, func(farm *types.Farm, value string) {
+			farm.Persistence = types.Persistence(value)
+		}},
+		&FarmSetting{Setting{"persistence-ttl", "60", integer(1, math.MaxUint32)}, func(farm *types.Farm, value string) {
+			farm.PersistTTL = Number(value)
+		}},
+		&FarmSetting{Setting{"helper", "", validation.Helper}, func(farm *types.Farm, value string) {
+			farm.Helper = types.Helper(value)
+		}},
+		&FarmSetting{Setting{"log", "none", validation.Log}, func(farm *types.Farm, value string) {
+			farm.Log = types.Log(value)
+		}},
+		&FarmSetting{Setting{"est-connlimit", "", integer(0, math.MaxUint32)}, func(farm *types.Farm, value string) {
+			farm.EstConnlimit = Number(value)
+		}},
+
+		// Rate limits (packets per second, 0 is unlimited) and their bursts
+		&FarmSetting{Setting{"new-rtlimit", "", integer(0, math.MaxUint32)}, func(farm *types.Farm, value string) {
+			farm.NewRtlimit = Number(value)
+		}},
+		&FarmSetting{Setting{"new-rtlimit-burst", "", integer(0, math.MaxUint32)}, func(farm *types.Farm, value string) {
+			farm.NewRtlimitBurst = Number(value)
+		}},
+		&FarmSetting{Setting{"rst-rtlimit", "", integer(0, math.MaxUint32)}, func(farm *types.Farm, value string) {
+			farm.RstRtlimit = Number(value)
+		}},
+		&FarmSetting{Setting{"rst-rtlimit-burst", "", integer(0, math.MaxUint32)}, func(farm *types.Farm, value string) {
+			farm.RstRtlimitBurst = Number(value)
+		}},
+		&FarmSetting{Setting{"tcp-strict", "", validation.Switch}, func(farm *types.Farm, value string) {
+			farm.TCPStrict = types.Switch(value)
+		}},
+
+		// -1 disables the queue, otherwise it's a NFQUEUE number
+		&FarmSetting{Setting{"queue", "", integer(-1, math.MaxUint16)}, func(farm *types.Farm, value string) {
+			queue, _ := types.ParseSignedNumber(value)
+			farm.Queue = &queue
+		}},
+
+		&FarmSetting{Setting{"mark", "", validation.Mark}, func(farm *types.Farm, value string) {
+			farm.Mark = Mark(value)
+		}},
+		&FarmSetting{Setting{"priority", "", integer(1, math.MaxUint32)}, func(farm *types.Farm, value string) {
+			farm.Priority = Number(value)
+		}},
+		&FarmSetting{Setting{"source-addr", "", validation.IP}, func(farm *types.Farm, value string) {
+			farm.SourceAddr = value
+		}},
+		&FarmSetting{Setting{"intra-connect", "", validation.Switch}, func(farm *types.Farm, value string) {
+			farm.IntraConnect = types.Switch(value)
+		}},
+
+		// Farms can be taken down or off for maintenance
+		&FarmSetting{Setting{"state", "", validation.FarmState}, func(farm *types.Farm, value string) {
+			farm.State = types.State(value)
+		}},
+
+		// Backend weights and slow start are managed by kube-nftlb
+		&Setting{AutoWeightSetting, "none", validation.AutoWeight},
+		&Setting{SlowStartSetting, "0s", validation.Duration},
+
+		// Backends that leave are kept off until their connections end or their drain timeout expires
+		&Setting{DrainTimeoutSetting, "0s", validation.Duration},
+
+		// Backends in the zone of the node get priority 1 unless the zone has fewer backends than the minimum
+		&Setting{TopologySetting, "none", validation.Topology},
+		&Setting{TopologyMinLocalSetting, "1", integer(1, math.MaxUint16)},
+
+		// Farms without backends drop traffic unless it's rejected or sent to a fallback Service
+		&Setting{NoEndpointsSetting, "drop", validation.NoEndpoints},
+		&Setting{FallbackServiceSetting, "", validation.ObjectKey},
+
+		// Farms can be completed with a partial nftlb farm read from a ConfigMap
+		&Setting{FarmTemplateSetting, "", validation.ConfigMapName},
+
+		// Farms of node-scoped Services are only programmed in nodes that match a label selector
+		&Setting{NodeSelectorSetting, "", validation.NodeSelector},
+
+		// Backends are probed by kube-nftlb in every node, they're down while they fail (the port of every backend is
+		// probed unless a port is set)
+		&Setting{HealthCheckSetting, "none", validation.HealthCheck},
+		&Setting{HealthCheckIntervalSetting, "10s", validation.PositiveDuration},
+		&Setting{HealthCheckTimeoutSetting, "2s", validation.PositiveDuration},
+		&Setting{HealthCheckHealthyThresholdSetting, "2", integer(1, 100)},
+		&Setting{HealthCheckUnhealthyThresholdSetting, "3", integer(1, 100)},
+		&Setting{HealthCheckPortSetting, "", integer(1, math.MaxUint16)},
+		&Setting{HealthCheckHTTPPathSetting, "/", validation.HTTPPath},
+		&Setting{HealthCheckHTTPStatusSetting, "200-399", validation.HTTPStatus},
+	} {
+		// Built-in annotations are registered once, an error is a bug
+		if err := RegisterService(processor); err != nil {
+			panic(err)
+		}
+	}
+
+	// Backend settings, their default values are the ones used by nftlb. They're only sent when a Pod annotation is
+	// removed, so nftlb doesn't keep the old value
+	for _, processor := range []BackendProcessor{
+		&BackendSetting{Setting{"weight", "1", integer(1, math.MaxUint32)}, func(backend *types.Backend, value string) {
+			backend.Weight = Number(value)
+		}},
+		&BackendSetting{Setting{"priority", "1", integer(1, math.MaxUint32)}, func(backend *types.Backend, value string) {
+			backend.Priority = Number(value)
+		}},
+		&BackendSetting{Setting{"mark", "0x0", validation.Mark}, func(backend *types.Backend, value string) {
+			backend.Mark = Mark(value)
+		}},
+		&BackendSetting{Setting{"est-connlimit", "0", integer(0, math.MaxUint32)}, func(backend *types.Backend, value string) {
+			backend.EstConnlimit = Number(value)
+		}},
+
+		// Backends of a Pod can be drained for maintenance, they don't get new connections while they're off
+		&BackendSetting{Setting{"state", "up", validation.BackendState}, func(backend *types.Backend, value string) {
+			backend.State = types.State(value)
+		}},
+	} {
+		// Built-in annotations are registered once, an error is a bug
+		if err := RegisterPod(processor); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// integer returns a validation func for base 10 integers between min and max (both included).
+func integer(min int64, max int64) func(string, *field.Path) field.ErrorList {
+	return func(value string, fldPath *field.Path) field.ErrorList {
+		return validation.Integer(value, min, max, fldPath)
+	}
+}
@@ -0,0 +1,161 @@
+package processor
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+)
+
+func TestBuiltinDefaults(t *testing.T) {
+	for _, processor := range Services() {
+		if value := processor.Default(); value != "" {
+			if errs := processor.Validate(value, nil); len(errs) > 0 {
+				t.Fatalf("%s: default value %q isn't valid: %v", processor.Name(), value, errs)
+			}
+		}
+	}
+	for _, processor := range Pods() {
+		if value := processor.Default(); value != "" {
+			if errs := processor.Validate(value, nil); len(errs) > 0 {
+				t.Fatalf("%s: default value %q isn't valid: %v", processor.Name(), value, errs)
+			}
+		}
+	}
+}
+
+func TestBuiltinFarmSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		json    string // What the farm has after the value is applied
+		invalid string
+	}{
+		{"mode", "dnat", `"mode":"dnat"`, "nat"},
+		{"scheduler", "symhash", `"scheduler":"symhash"`, "random"},
+		{"sched-param", "srcip dstport", `"sched-param":"srcip dstport"`, "srcip none"},
+		{"persistence", "srcip", `"persistence":"srcip"`, "cookie"},
+		{"persistence-ttl", "120", `"persist-ttl":"120"`, "0"},
+		{"helper", "sip", `"helper":"sip"`, "http"},
+		{"log", "input forward", `"log":"input forward"`, "prerouting"},
+		{"est-connlimit", "100", `"est-connlimit":"100"`, "-1"},
+		{"new-rtlimit", "10", `"new-rtlimit":"10"`, "ten"},
+		{"new-rtlimit-burst", "20", `"new-rtlimit-burst":"20"`, "4294967296"},
+		{"rst-rtlimit", "5", `"rst-rtlimit":"5"`, "-5"},
+		{"rst-rtlimit-burst", "15", `"rst-rtlimit-burst":"15"`, "1.5"},
+		{"tcp-strict", "on", `"tcp-strict":"on"`, "yes"},
+		{"queue", "-1", `"queue":"-1"`, "-2"},
+		{"mark", "0x10", `"mark":"0x10"`, "mark"},
+		{"priority", "2", `"priority":"2"`, "0"},
+		{"source-addr", "192.168.0.1", `"source-addr":"192.168.0.1"`, "192.168.0"},
+		{"intra-connect", "off", `"intra-connect":"off"`, "no"},
+		{"state", "off", `"state":"off"`, "config"},
+	}
+
+	for _, test := range tests {
+		processor, ok := Service(test.name)
+		if !ok {
+			t.Fatalf("%s: there isn't a processor", test.name)
+		}
+		if _, ok := processor.(FarmProcessor); !ok {
+			t.Fatalf("%s: got %T, want a FarmProcessor", test.name, processor)
+		}
+
+		if errs := processor.Validate(test.value, nil); len(errs) > 0 {
+			t.Fatalf("%s: value %q: %v", test.name, test.value, errs)
+		}
+		if errs := processor.Validate(test.invalid, nil); len(errs) == 0 {
+			t.Fatalf("%s: value %q: got no errors, want it to be invalid", test.name, test.invalid)
+		}
+
+		farm := &types.Farm{Name: "farm"}
+		ApplyFarm(farm, map[string]string{test.name: test.value})
+		farmJSON, _ := json.Marshal(farm)
+		if !strings.Contains(string(farmJSON), test.json) {
+			t.Fatalf("%s: got farm %s, want it to contain %s", test.name, farmJSON, test.json)
+		}
+	}
+}
+
+func TestBuiltinSettingsReadByKubeNftlb(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		invalid string
+	}{
+		{AutoWeightSetting, "cpu", "disk"},
+		{SlowStartSetting, "30s", "30"},
+		{DrainTimeoutSetting, "2m", "-1s"},
+		{NoEndpointsSetting, "reject", "accept"},
+		{FallbackServiceSetting, "default/fallback", "default/Fallback"},
+		{FarmTemplateSetting, "tuned-farm", "tuned_farm"},
+		{NodeSelectorSetting, "zone=a", "zone in (a"},
+		{TopologySetting, "zone", "region"},
+		{TopologyMinLocalSetting, "2", "0"},
+		{HealthCheckSetting, "http", "icmp"},
+		{HealthCheckIntervalSetting, "5s", "0s"},
+		{HealthCheckTimeoutSetting, "1s", "-1s"},
+		{HealthCheckHealthyThresholdSetting, "1", "101"},
+		{HealthCheckUnhealthyThresholdSetting, "100", "0"},
+		{HealthCheckPortSetting, "8080", "65536"},
+		{HealthCheckHTTPPathSetting, "/healthz", "healthz"},
+		{HealthCheckHTTPStatusSetting, "200", "600"},
+	}
+
+	for _, test := range tests {
+		processor, ok := Service(test.name)
+		if !ok {
+			t.Fatalf("%s: there isn't a processor", test.name)
+		}
+
+		// They don't change nftlb objects
+		switch processor.(type) {
+		case FarmProcessor, AddressProcessor:
+			t.Fatalf("%s: got %T, want a setting read by kube-nftlb", test.name, processor)
+		}
+
+		if errs := processor.Validate(test.value, nil); len(errs) > 0 {
+			t.Fatalf("%s: value %q: %v", test.name, test.value, errs)
+		}
+		if errs := processor.Validate(test.invalid, nil); len(errs) == 0 {
+			t.Fatalf("%s: value %q: got no errors, want it to be invalid", test.name, test.invalid)
+		}
+	}
+}
+
+func TestBuiltinBackendSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		json    string // What the backend has after the value is applied
+		invalid string
+	}{
+		{"weight", "5", `"weight":"5"`, "0"},
+		{"priority", "2", `"priority":"2"`, "0"},
+		{"mark", "0x20", `"mark":"0x20"`, "0xg"},
+		{"est-connlimit", "10", `"est-connlimit":"10"`, "-10"},
+		{"state", "off", `"state":"off"`, "down"},
+	}
+
+	for _, test := range tests {
+		processor, ok := podProcessors[test.name]
+		if !ok {
+			t.Fatalf("%s: there isn't a processor", test.name)
+		}
+
+		if errs := processor.Validate(test.value, nil); len(errs) > 0 {
+			t.Fatalf("%s: value %q: %v", test.name, test.value, errs)
+		}
+		if errs := processor.Validate(test.invalid, nil); len(errs) == 0 {
+			t.Fatalf("%s: value %q: got no errors, want it to be invalid", test.name, test.invalid)
+		}
+
+		backend := &types.Backend{Name: "backend", IPAddr: "172.17.0.2"}
+		ApplyBackend(backend, map[string]string{test.name: test.value})
+		backendJSON, _ := json.Marshal(backend)
+		if !strings.Contains(string(backendJSON), test.json) {
+			t.Fatalf("%s: got backend %s, want it to contain %s", test.name, backendJSON, test.json)
+		}
+	}
+}
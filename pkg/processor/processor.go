@@ -0,0 +1,223 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Processor owns a kube-nftlb annotation (without prefix): its default value and its validation. How it changes nftlb
+// objects is given by FarmProcessor, AddressProcessor or BackendProcessor. A Processor that doesn't implement any of
+// them is a setting read by kube-nftlb itself (for example, slow-start).
+type Processor interface {
+	// Name returns the annotation key without prefix.
+	Name() string
+
+	// Default returns the value used when the annotation isn't set, or "" if there isn't a default value.
+	Default() string
+
+	// Validate checks a value before it's applied.
+	Validate(value string, fldPath *field.Path) field.ErrorList
+}
+
+// FarmProcessor is a Service annotation processor that changes farms.
+type FarmProcessor interface {
+	Processor
+
+	// Farm applies a valid value to a farm.
+	Farm(farm *types.Farm, value string)
+}
+
+// AddressProcessor is a Service annotation processor that changes every address of a farm.
+type AddressProcessor interface {
+	Processor
+
+	// Address applies a valid value to an address.
+	Address(address *types.Address, value string)
+}
+
+// BackendProcessor is a Pod annotation processor that changes every backend made for that Pod.
+type BackendProcessor interface {
+	Processor
+
+	// Backend applies a valid value to a backend.
+	Backend(backend *types.Backend, value string)
+}
+
+var (
+	registryMutex sync.RWMutex
+
+	// Map [Service annotation (without prefix)] to { processor }
+	serviceProcessors = make(map[string]Processor)
+
+	// Map [Pod annotation (without prefix)] to { processor }
+	podProcessors = make(map[string]BackendProcessor)
+)
+
+// RegisterService adds a processor for a Service annotation (service.kubernetes.io/kube-nftlb-load-balancer-X). Its
+// annotation can also be set in defaults and for every port. It must be called before controllers are started (for
+// example, in an init func), and it returns an error if the annotation is already read by kube-nftlb (ReplaceService
+// replaces the processor of an annotation).
+func RegisterService(processor Processor) error {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	name := processor.Name()
+	if validation.IsKnownServiceAnnotation(name) {
+		return fmt.Errorf("processor: Service annotation %q is already read by kube-nftlb", name)
+	}
+	serviceProcessors[name] = processor
+	validation.RegisterSetting(name, processor.Validate)
+	return nil
+}
+
+// ReplaceService replaces the processor of a Service annotation, for example to change a built-in setting. It must be
+// called before controllers are started, and it returns an error if the annotation doesn't have a processor.
+func ReplaceService(processor Processor) error {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	name := processor.Name()
+	if _, exists := serviceProcessors[name]; !exists {
+		return fmt.Errorf("processor: Service annotation %q doesn't have a processor", name)
+	}
+	serviceProcessors[name] = processor
+	validation.RegisterSetting(name, processor.Validate)
+	return nil
+}
+
+// RegisterPod adds a processor for a Pod annotation (pod.kubernetes.io/kube-nftlb-backend-X). It must be called before
+// controllers are started (for example, in an init func), and it returns an error if the annotation already has a
+// processor (ReplacePod replaces the processor of an annotation).
+func RegisterPod(processor BackendProcessor) error {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	name := processor.Name()
+	if _, exists := podProcessors[name]; exists {
+		return fmt.Errorf("processor: Pod annotation %q already has a processor", name)
+	}
+	podProcessors[name] = processor
+	validation.RegisterPodAnnotation(name, processor.Validate)
+	return nil
+}
+
+// ReplacePod replaces the processor of a Pod annotation. It must be called before controllers are started, and it
+// returns an error if the annotation doesn't have a processor.
+func ReplacePod(processor BackendProcessor) error {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	name := processor.Name()
+	if _, exists := podProcessors[name]; !exists {
+		return fmt.Errorf("processor: Pod annotation %q doesn't have a processor", name)
+	}
+	podProcessors[name] = processor
+	validation.RegisterPodAnnotation(name, processor.Validate)
+	return nil
+}
+
+// Service returns the processor of a Service annotation (without prefix).
+func Service(name string) (Processor, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	processor, ok := serviceProcessors[name]
+	return processor, ok
+}
+
+// Services returns every Service annotation processor, sorted by name so they're always applied in the same order.
+func Services() []Processor {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	processors := make([]Processor, 0, len(serviceProcessors))
+	for _, processor := range serviceProcessors {
+		processors = append(processors, processor)
+	}
+	sort.Slice(processors, func(i, j int) bool {
+		return processors[i].Name() < processors[j].Name()
+	})
+	return processors
+}
+
+// Pods returns every Pod annotation processor, sorted by name so they're always applied in the same order.
+func Pods() []BackendProcessor {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	processors := make([]BackendProcessor, 0, len(podProcessors))
+	for _, processor := range podProcessors {
+		processors = append(processors, processor)
+	}
+	sort.Slice(processors, func(i, j int) bool {
+		return processors[i].Name() < processors[j].Name()
+	})
+	return processors
+}
+
+// Defaults returns the default value of every Service annotation processor that has one.
+func Defaults() map[string]string {
+	defaults := make(map[string]string)
+	for _, processor := range Services() {
+		if value := processor.Default(); value != "" {
+			defaults[processor.Name()] = value
+		}
+	}
+	return defaults
+}
+
+// PodDefaults returns the default value of every Pod annotation processor that has one. They're applied when a Pod
+// annotation is removed.
+func PodDefaults() map[string]string {
+	defaults := make(map[string]string)
+	for _, processor := range Pods() {
+		if value := processor.Default(); value != "" {
+			defaults[processor.Name()] = value
+		}
+	}
+	return defaults
+}
+
+// ApplyFarm applies settings (Service annotations without prefix) to a farm. Settings must be valid.
+func ApplyFarm(farm *types.Farm, settings map[string]string) {
+	for _, processor := range Services() {
+		farmProcessor, ok := processor.(FarmProcessor)
+		if !ok {
+			continue
+		}
+		if value, ok := settings[processor.Name()]; ok {
+			farmProcessor.Farm(farm, value)
+		}
+	}
+}
+
+// ApplyAddresses applies settings (Service annotations without prefix) to every address of a farm. Settings must be
+// valid.
+func ApplyAddresses(farm *types.Farm, settings map[string]string) {
+	for _, processor := range Services() {
+		addressProcessor, ok := processor.(AddressProcessor)
+		if !ok {
+			continue
+		}
+		if value, ok := settings[processor.Name()]; ok {
+			for index := range farm.Addresses {
+				addressProcessor.Address(&farm.Addresses[index], value)
+			}
+		}
+	}
+}
+
+// ApplyBackend applies settings (Pod annotations without prefix) to a backend. Settings must be valid.
+func ApplyBackend(backend *types.Backend, settings map[string]string) {
+	for _, processor := range Pods() {
+		if value, ok := settings[processor.Name()]; ok {
+			processor.Backend(backend, value)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+)
+
+func TestRegisterService(t *testing.T) {
+	tenantMark := &FarmSetting{Setting{"test-tenant-mark", "", validation.Mark}, func(farm *types.Farm, value string) {
+		farm.Mark = Mark(value)
+	}}
+	if err := RegisterService(tenantMark); err != nil {
+		t.Fatal(err)
+	}
+	if processor, ok := Service("test-tenant-mark"); !ok || processor != tenantMark {
+		t.Fatalf("got processor %v, want the registered one", processor)
+	}
+	if errs := validation.Setting("test-tenant-mark", "0x10", nil); len(errs) > 0 {
+		t.Fatalf("got errors %v, want the setting to be known", errs)
+	}
+
+	// Settings of the registered processor are applied to farms
+	farm := &types.Farm{Name: "farm"}
+	ApplyFarm(farm, map[string]string{"test-tenant-mark": "0x10"})
+	if farm.Mark == nil || *farm.Mark != 0x10 {
+		t.Fatalf("got farm %+v, want mark 0x10", farm)
+	}
+
+	// Annotations already read by kube-nftlb can't be registered again
+	for _, name := range []string{"test-tenant-mark", "mode", "ports"} {
+		if err := RegisterService(&Setting{Key: name}); err == nil {
+			t.Fatalf("%s: got no error, want an error", name)
+		}
+	}
+}
+
+func TestReplaceService(t *testing.T) {
+	builtin, _ := Service("scheduler")
+	defer ReplaceService(builtin)
+
+	// Sites can change the default value of a built-in setting
+	scheduler := &FarmSetting{Setting{"scheduler", "weight", validation.Scheduler}, func(farm *types.Farm, value string) {
+		farm.Scheduler = types.Scheduler(value)
+	}}
+	if err := ReplaceService(scheduler); err != nil {
+		t.Fatal(err)
+	}
+	if Defaults()["scheduler"] != "weight" {
+		t.Fatalf("got default %q, want the default of the new processor", Defaults()["scheduler"])
+	}
+
+	// Only annotations that have a processor can be replaced
+	for _, name := range []string{"test-unknown", "ports"} {
+		if err := ReplaceService(&Setting{Key: name}); err == nil {
+			t.Fatalf("%s: got no error, want an error", name)
+		}
+	}
+}
+
+func TestRegisterPod(t *testing.T) {
+	builtin := podProcessors["weight"]
+	defer ReplacePod(builtin)
+
+	if err := RegisterPod(&BackendSetting{Setting{"weight", "1", nil}, nil}); err == nil {
+		t.Fatal("got no error, want an error")
+	}
+
+	weight := &BackendSetting{Setting{"weight", "10", nil}, func(backend *types.Backend, value string) {
+		backend.Weight = Number(value)
+	}}
+	if err := ReplacePod(weight); err != nil {
+		t.Fatal(err)
+	}
+	if PodDefaults()["weight"] != "10" {
+		t.Fatalf("got default %q, want the default of the new processor", PodDefaults()["weight"])
+	}
+	if err := ReplacePod(&BackendSetting{Setting{"test-unknown", "", nil}, nil}); err == nil {
+		t.Fatal("got no error, want an error")
+	}
+}
@@ -0,0 +1,83 @@
+package processor
+
+import (
+	"github.com/zevenet/kube-nftlb/pkg/types"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Setting is a Processor made from its fields. It's embedded by FarmSetting, AddressSetting and BackendSetting, so
+// simple processors don't need their own type.
+type Setting struct {
+	// Annotation key without prefix
+	Key string
+
+	// Value used when the annotation isn't set ("" if there isn't a default value)
+	DefaultValue string
+
+	// Validation func, every value is valid if it's nil
+	Check func(string, *field.Path) field.ErrorList
+}
+
+// Name returns the annotation key without prefix.
+func (s *Setting) Name() string {
+	return s.Key
+}
+
+// Default returns the value used when the annotation isn't set.
+func (s *Setting) Default() string {
+	return s.DefaultValue
+}
+
+// Validate checks a value with the Check func.
+func (s *Setting) Validate(value string, fldPath *field.Path) field.ErrorList {
+	if s.Check == nil {
+		return nil
+	}
+	return s.Check(value, fldPath)
+}
+
+// FarmSetting is a FarmProcessor made from its fields.
+type FarmSetting struct {
+	Setting
+	Apply func(*types.Farm, string)
+}
+
+// Farm applies a valid value to a farm.
+func (s *FarmSetting) Farm(farm *types.Farm, value string) {
+	s.Apply(farm, value)
+}
+
+// AddressSetting is an AddressProcessor made from its fields.
+type AddressSetting struct {
+	Setting
+	Apply func(*types.Address, string)
+}
+
+// Address applies a valid value to an address.
+func (s *AddressSetting) Address(address *types.Address, value string) {
+	s.Apply(address, value)
+}
+
+// BackendSetting is a BackendProcessor made from its fields.
+type BackendSetting struct {
+	Setting
+	Apply func(*types.Backend, string)
+}
+
+// Backend applies a valid value to a backend.
+func (s *BackendSetting) Backend(backend *types.Backend, value string) {
+	s.Apply(backend, value)
+}
+
+// Number returns a pointer to a valid Number.
+func Number(value string) *types.Number {
+	number, _ := types.ParseNumber(value)
+	return &number
+}
+
+// Mark returns a pointer to a valid Mark.
+func Mark(value string) *types.Mark {
+	mark, _ := types.ParseMark(value)
+	return &mark
+}
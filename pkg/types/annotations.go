@@ -2,14 +2,9 @@ package types
 
 // Annotations stores values that can be passed to nftlb through k8s annotations.
 type Annotations struct {
-	Persistence  string
-	PersistTTL   string
-	Mode         string
-	Scheduler    string
-	SchedParam   string
-	Helper       string
-	Log          string
-	LogPrefix    string
-	EstConnlimit string
-	Iface        string
+	// Map [setting (annotation without prefix)] to { value }, they're applied by annotation processors
+	Settings map[string]string
+
+	// Map [port name or number] to [annotation (without prefix)] to { value }
+	Ports map[string]map[string]string
 }
@@ -2,33 +2,41 @@ package types
 
 // Backend defines a nftlb backend object with its properties. Equivalent to a k8s Pod.
 type Backend struct {
-	Name         string `json:"name"`
-	IPAddr       string `json:"ip-addr"`
-	Weight       string `json:"weight,omitempty"`
-	Priority     string `json:"priority,omitempty"`
-	Mark         string `json:"mark,omitempty"`
-	State        string `json:"state,omitempty"`
-	Port         string `json:"port,omitempty"`
-	EstConnlimit string `json:"est-connlimit,omitempty"`
+	Name         string  `json:"name"`
+	IPAddr       string  `json:"ip-addr"`
+	Weight       *Number `json:"weight,omitempty"`
+	Priority     *Number `json:"priority,omitempty"`
+	Mark         *Mark   `json:"mark,omitempty"`
+	State        State   `json:"state,omitempty"`
+	Port         *Port   `json:"port,omitempty"`
+	EstConnlimit *Number `json:"est-connlimit,omitempty"`
 }
 
 // Farm defines a nftlb farm object with its properties. Equivalent to a k8s Service.
 type Farm struct {
-	Name         string    `json:"name"`
-	Mode         string    `json:"mode,omitempty"`
-	Scheduler    string    `json:"scheduler,omitempty"`
-	SchedParam   string    `json:"sched-param,omitempty"`
-	Helper       string    `json:"helper,omitempty"`
-	Log          string    `json:"log,omitempty"`
-	LogPrefix    string    `json:"log-prefix,omitempty"`
-	Mark         string    `json:"mark,omitempty"`
-	Priority     string    `json:"priority,omitempty"`
-	State        string    `json:"state,omitempty"`
-	IntraConnect string    `json:"intra-connect,omitempty"`
-	Persistence  string    `json:"persistence,omitempty"`
-	PersistTTL   string    `json:"persist-ttl,omitempty"`
-	Iface        string    `json:"iface,omitempty"`
-	EstConnlimit string    `json:"est-connlimit,omitempty"`
-	Backends     []Backend `json:"backends,omitempty"`
-	Addresses    []Address `json:"addresses,omitempty"`
+	Name            string        `json:"name"`
+	Mode            Mode          `json:"mode,omitempty"`
+	Scheduler       Scheduler     `json:"scheduler,omitempty"`
+	SchedParam      SchedParam    `json:"sched-param,omitempty"`
+	Helper          Helper        `json:"helper,omitempty"`
+	Log             Log           `json:"log,omitempty"`
+	LogPrefix       string        `json:"log-prefix,omitempty"`
+	Mark            *Mark         `json:"mark,omitempty"`
+	Priority        *Number       `json:"priority,omitempty"`
+	SourceAddr      string        `json:"source-addr,omitempty"`
+	State           State         `json:"state,omitempty"`
+	IntraConnect    Switch        `json:"intra-connect,omitempty"`
+	Persistence     Persistence   `json:"persistence,omitempty"`
+	PersistTTL      *Number       `json:"persist-ttl,omitempty"`
+	Iface           string        `json:"iface,omitempty"`
+	EstConnlimit    *Number       `json:"est-connlimit,omitempty"`
+	NewRtlimit      *Number       `json:"new-rtlimit,omitempty"`
+	NewRtlimitBurst *Number       `json:"new-rtlimit-burst,omitempty"`
+	RstRtlimit      *Number       `json:"rst-rtlimit,omitempty"`
+	RstRtlimitBurst *Number       `json:"rst-rtlimit-burst,omitempty"`
+	TCPStrict       Switch        `json:"tcp-strict,omitempty"`
+	Queue           *SignedNumber `json:"queue,omitempty"`
+	Backends        []Backend     `json:"backends,omitempty"`
+	Addresses       []Address     `json:"addresses,omitempty"`
+	Policies        []FarmPolicy  `json:"policies,omitempty"`
 }
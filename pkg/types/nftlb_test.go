@@ -0,0 +1,115 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// Golden files are written again with: go test ./pkg/types -update
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+func TestNftlbMarshalGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		nftlb Nftlb
+	}{
+		{
+			name: "farm",
+			nftlb: Nftlb{
+				Farms: []Farm{{
+					Name:            "default--web--http",
+					Mode:            ModeSNAT,
+					Scheduler:       SchedulerHash,
+					SchedParam:      "srcip srcport",
+					Helper:          HelperFTP,
+					Log:             "input forward",
+					LogPrefix:       "web",
+					Mark:            NewMark(0x200),
+					Priority:        NewNumber(2),
+					SourceAddr:      "10.0.0.1",
+					State:           StateUp,
+					IntraConnect:    SwitchOn,
+					Persistence:     "srcip dstport",
+					PersistTTL:      NewNumber(60),
+					EstConnlimit:    NewNumber(100),
+					NewRtlimit:      NewNumber(10),
+					NewRtlimitBurst: NewNumber(20),
+					RstRtlimit:      NewNumber(5),
+					RstRtlimitBurst: NewNumber(15),
+					TCPStrict:       SwitchOff,
+					Queue:           NewSignedNumber(-1),
+					Addresses: []Address{
+						{Name: "default--web--http--ipv4", Family: FamilyIPv4, IPAddr: "192.168.0.10", Ports: "80", Protocol: ProtocolTCP},
+						{Name: "default--web--http--ipv6", Family: FamilyIPv6, IPAddr: "fd00::10", Ports: "8080-8090", Protocol: ProtocolTCP},
+					},
+					Backends: []Backend{
+						{Name: "web-0", IPAddr: "172.17.0.2", Weight: NewNumber(3), Priority: NewNumber(1), Mark: NewMark(0), State: StateUp, Port: NewPort(8080), EstConnlimit: NewNumber(0)},
+						{Name: "web-1", IPAddr: "172.17.0.3", State: StateOff},
+					},
+					Policies: []FarmPolicy{{Name: "default--web--blacklist"}},
+				}},
+			},
+		},
+		{
+			name: "dsr",
+			nftlb: Nftlb{
+				Farms: []Farm{{
+					Name:      "default--dns--dns",
+					Mode:      ModeDSR,
+					Scheduler: SchedulerRR,
+					Helper:    HelperNone,
+					Iface:     "eth0",
+					Addresses: []Address{
+						{Name: "default--dns--dns--ipv4", Family: FamilyIPv4, IPAddr: "192.168.0.53", Ports: "53", Protocol: ProtocolUDP},
+					},
+				}},
+			},
+		},
+		{
+			name: "policies",
+			nftlb: Nftlb{
+				Policies: []Policy{{
+					Name:      "default--web--blacklist",
+					Type:      "blacklist",
+					Family:    "ipv4",
+					LogPrefix: "blacklisted",
+					Elements:  []Element{{Data: "10.0.0.0/8"}, {Data: "192.168.1.1"}},
+				}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := json.MarshalIndent(test.nftlb, "", "\t")
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err.Error())
+		}
+
+		golden := filepath.Join("testdata", test.name+".golden.json")
+		if *update {
+			if err := ioutil.WriteFile(golden, append(got, '\n'), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(append(got, '\n'), want) {
+			t.Fatalf("%s: got\n%s\nwant\n%s", test.name, got, want)
+		}
+
+		// What nftlb sends back must be read as the same objects
+		read := Nftlb{}
+		if err := json.Unmarshal(want, &read); err != nil {
+			t.Fatalf("%s: %s", test.name, err.Error())
+		}
+		if again, _ := json.MarshalIndent(read, "", "\t"); !bytes.Equal(again, got) {
+			t.Fatalf("%s: got\n%s\nafter reading it again, want\n%s", test.name, again, got)
+		}
+	}
+}
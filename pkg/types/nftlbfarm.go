@@ -0,0 +1,41 @@
+package types
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NftlbFarmResource is the NftlbFarm custom resource, it's read through the dynamic client.
+var NftlbFarmResource = schema.GroupVersionResource{
+	Group:    CustomResourceGroup,
+	Version:  "v1alpha1",
+	Resource: "nftlbfarms",
+}
+
+// States of a NftlbFarm reported by every node
+const (
+	NftlbFarmProgrammed = "Programmed"
+	NftlbFarmInvalid    = "Invalid"
+	NftlbFarmConflict   = "Conflict"
+	NftlbFarmError      = "Error"
+)
+
+// NftlbFarmSpec stores the spec of a NftlbFarm: a farm (its name is set by kube-nftlb) with its addresses, static
+// backends and policies, backends made for Pods that match a selector, and the nodes where it's programmed.
+type NftlbFarmSpec struct {
+	Farm `json:",inline"`
+
+	Policies     []Policy              `json:"policies,omitempty"`
+	PodSelector  *metav1.LabelSelector `json:"podSelector,omitempty"`
+	BackendPort  *Port                 `json:"backendPort,omitempty"`
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+}
+
+// NftlbFarmNodeStatus is the status of a NftlbFarm in a node.
+type NftlbFarmNodeStatus struct {
+	State          string `json:"state"`
+	Farm           string `json:"farm,omitempty"`
+	Message        string `json:"message,omitempty"`
+	LastUpdateTime string `json:"lastUpdateTime,omitempty"`
+}
@@ -0,0 +1,155 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Numbers are sent to nftlb as strings. Optional numbers are pointers, so 0 can be sent and nil is omitted.
+
+// Number is an unsigned integer, sent in base 10.
+type Number uint32
+
+// SignedNumber is a signed integer, sent in base 10.
+type SignedNumber int32
+
+// Mark is a packet mark, sent in hexadecimal format with "0x" prefix.
+type Mark uint32
+
+// Port is a layer 4 port, sent in base 10.
+type Port uint16
+
+// NewNumber returns a pointer to a Number.
+func NewNumber(value uint32) *Number {
+	number := Number(value)
+	return &number
+}
+
+// NewSignedNumber returns a pointer to a SignedNumber.
+func NewSignedNumber(value int32) *SignedNumber {
+	number := SignedNumber(value)
+	return &number
+}
+
+// NewMark returns a pointer to a Mark.
+func NewMark(value uint32) *Mark {
+	mark := Mark(value)
+	return &mark
+}
+
+// NewPort returns a pointer to a Port.
+func NewPort(value uint16) *Port {
+	port := Port(value)
+	return &port
+}
+
+// ParseNumber reads a Number in base 10.
+func ParseNumber(value string) (Number, error) {
+	number, err := strconv.ParseUint(value, 10, 32)
+	return Number(number), err
+}
+
+// ParseSignedNumber reads a SignedNumber in base 10.
+func ParseSignedNumber(value string) (SignedNumber, error) {
+	number, err := strconv.ParseInt(value, 10, 32)
+	return SignedNumber(number), err
+}
+
+// ParseMark reads a Mark in hexadecimal format ("0x" prefix) or in base 10.
+func ParseMark(value string) (Mark, error) {
+	mark, err := strconv.ParseUint(value, 0, 32)
+	return Mark(mark), err
+}
+
+// ParsePort reads a Port in base 10.
+func ParsePort(value string) (Port, error) {
+	port, err := strconv.ParseUint(value, 10, 16)
+	return Port(port), err
+}
+
+func (n Number) String() string {
+	return strconv.FormatUint(uint64(n), 10)
+}
+
+func (n SignedNumber) String() string {
+	return strconv.FormatInt(int64(n), 10)
+}
+
+func (m Mark) String() string {
+	return fmt.Sprintf("0x%x", uint32(m))
+}
+
+func (p Port) String() string {
+	return strconv.FormatUint(uint64(p), 10)
+}
+
+// MarshalJSON sends a Number as a string.
+func (n Number) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.String())
+}
+
+// MarshalJSON sends a SignedNumber as a string.
+func (n SignedNumber) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.String())
+}
+
+// MarshalJSON sends a Mark as a hexadecimal string.
+func (m Mark) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// MarshalJSON sends a Port as a string.
+func (p Port) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON reads a Number from a string (as sent by nftlb) or from a number.
+func (n *Number) UnmarshalJSON(data []byte) error {
+	value, err := unquote(data)
+	if err != nil {
+		return err
+	}
+	*n, err = ParseNumber(value)
+	return err
+}
+
+// UnmarshalJSON reads a SignedNumber from a string (as sent by nftlb) or from a number.
+func (n *SignedNumber) UnmarshalJSON(data []byte) error {
+	value, err := unquote(data)
+	if err != nil {
+		return err
+	}
+	*n, err = ParseSignedNumber(value)
+	return err
+}
+
+// UnmarshalJSON reads a Mark from a string (as sent by nftlb) or from a number.
+func (m *Mark) UnmarshalJSON(data []byte) error {
+	value, err := unquote(data)
+	if err != nil {
+		return err
+	}
+	*m, err = ParseMark(value)
+	return err
+}
+
+// UnmarshalJSON reads a Port from a string (as sent by nftlb) or from a number.
+func (p *Port) UnmarshalJSON(data []byte) error {
+	value, err := unquote(data)
+	if err != nil {
+		return err
+	}
+	*p, err = ParsePort(value)
+	return err
+}
+
+// unquote returns the value of a JSON string, or a JSON number as it is.
+func unquote(data []byte) (string, error) {
+	if len(data) > 0 && data[0] == '"' {
+		var value string
+		err := json.Unmarshal(data, &value)
+		return value, err
+	}
+	return string(data), nil
+}
@@ -13,3 +13,8 @@ type Policy struct {
 	LogPrefix string    `json:"log-prefix,omitempty"`
 	Elements  []Element `json:"elements"`
 }
+
+// FarmPolicy defines a policy applied to a farm, it's referenced by name.
+type FarmPolicy struct {
+	Name string `json:"name"`
+}
@@ -0,0 +1,13 @@
+package types
+
+// ProgrammedCondition is the readiness gate of Pods whose backends must be programmed in every node before they're
+// Ready.
+const ProgrammedCondition = "kube-nftlb.zevenet.com/programmed"
+
+// Every node reports the Pods that it has programmed in a ConfigMap with this label, its keys are Pods
+// (namespace.name) and its values are Pod UIDs
+const ProgrammedPodsLabel = "kube-nftlb.zevenet.com/programmed-pods"
+
+// ProgrammedPodsHeartbeat is the annotation with the last time (RFC 3339) that a node updated its report. Reports
+// that aren't updated are ignored, so a node that is down doesn't block every readiness gate.
+const ProgrammedPodsHeartbeat = "kube-nftlb.zevenet.com/heartbeat"
@@ -2,9 +2,16 @@ package types
 
 // ServiceData stores some useful values from a Service. The "Family" property must be found analyzing that Service.
 type ServiceData struct {
-	Name        string
-	Family      string
-	Type        string
-	ClusterIP   string
-	ExternalIPs []string
+	Name            string
+	Family          Family
+	Type            string
+	ClusterIP       string
+	ExternalIPs     []string
+	LoadBalancerIPs []string
+
+	// Addresses of externalIPs and LoadBalancer IPs are named after the shared key (if any)
+	SharedKey string
+
+	// Map [VIP port] to { Service key }, these addresses are owned by an older Service
+	VIPConflicts map[string]string
 }
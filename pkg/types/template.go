@@ -0,0 +1,15 @@
+package types
+
+// Only ConfigMaps with this label are read as farm templates
+const FarmTemplateLabel = "kube-nftlb.zevenet.com/farm-template"
+
+// FarmTemplateKey is the ConfigMap key with the partial nftlb farm (JSON) of a farm template.
+const FarmTemplateKey = "farm.json"
+
+// FarmTemplateFields are the farm fields that can be set by a farm template. Names, addresses and backends are
+// always made by kube-nftlb.
+var FarmTemplateFields = []string{
+	"mode", "scheduler", "sched-param", "helper", "log", "log-prefix", "mark", "priority", "source-addr", "state",
+	"intra-connect", "persistence", "persist-ttl", "iface", "est-connlimit", "new-rtlimit", "new-rtlimit-burst",
+	"rst-rtlimit", "rst-rtlimit-burst", "tcp-strict", "queue", "policies",
+}
@@ -0,0 +1,28 @@
+package types
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Group of every custom resource read by kube-nftlb
+const CustomResourceGroup = "kube-nftlb.zevenet.com"
+
+// TrafficSplitResource is the TrafficSplit custom resource, it's read through the dynamic client.
+var TrafficSplitResource = schema.GroupVersionResource{
+	Group:    CustomResourceGroup,
+	Version:  "v1alpha1",
+	Resource: "trafficsplits",
+}
+
+// TrafficSplitSpec stores the spec of a TrafficSplit: the farms of a root Service get the endpoints of every backend
+// Service, with weights split by their share.
+type TrafficSplitSpec struct {
+	Service  string                `json:"service"`
+	Backends []TrafficSplitBackend `json:"backends"`
+}
+
+// TrafficSplitBackend is a backend Service (in the namespace of its TrafficSplit) and its weight.
+type TrafficSplitBackend struct {
+	Service string `json:"service"`
+	Weight  int64  `json:"weight"`
+}
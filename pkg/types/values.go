@@ -0,0 +1,105 @@
+package types
+
+// Mode is how a farm forwards packets to its backends.
+type Mode string
+
+const (
+	ModeSNAT     Mode = "snat"
+	ModeDNAT     Mode = "dnat"
+	ModeSTLSDNAT Mode = "stlsdnat"
+	ModeDSR      Mode = "dsr"
+)
+
+// Scheduler is how a farm chooses a backend.
+type Scheduler string
+
+const (
+	SchedulerRR      Scheduler = "rr"
+	SchedulerWeight  Scheduler = "weight"
+	SchedulerHash    Scheduler = "hash"
+	SchedulerSymHash Scheduler = "symhash"
+)
+
+// SchedParam is "none" or a space separated list of packet fields used by the hash schedulers.
+type SchedParam string
+
+const (
+	SchedParamNone SchedParam = "none"
+)
+
+// Persistence is "none" or a space separated list of packet fields used to stick connections to a backend.
+type Persistence string
+
+const (
+	PersistenceNone    Persistence = "none"
+	PersistenceSrcIP   Persistence = "srcip"
+	PersistenceDstIP   Persistence = "dstip"
+	PersistenceSrcPort Persistence = "srcport"
+	PersistenceDstPort Persistence = "dstport"
+	PersistenceSrcMAC  Persistence = "srcmac"
+	PersistenceDstMAC  Persistence = "dstmac"
+)
+
+// Helper is the conntrack helper of a farm.
+type Helper string
+
+const (
+	HelperNone      Helper = "none"
+	HelperAmanda    Helper = "amanda"
+	HelperFTP       Helper = "ftp"
+	HelperH323      Helper = "h323"
+	HelperIRC       Helper = "irc"
+	HelperNetbiosNS Helper = "netbios-ns"
+	HelperPPTP      Helper = "pptp"
+	HelperSane      Helper = "sane"
+	HelperSIP       Helper = "sip"
+	HelperSNMP      Helper = "snmp"
+	HelperTFTP      Helper = "tftp"
+)
+
+// Log is "none" or a space separated list of netfilter hooks where a farm logs packets.
+type Log string
+
+const (
+	LogNone    Log = "none"
+	LogInput   Log = "input"
+	LogForward Log = "forward"
+	LogOutput  Log = "output"
+)
+
+// State is the state of a farm or a backend.
+type State string
+
+const (
+	StateUp     State = "up"
+	StateDown   State = "down"
+	StateOff    State = "off"
+	StateConfig State = "config"
+)
+
+// Family is the IP family of a farm or an address.
+type Family string
+
+const (
+	FamilyIPv4 Family = "ipv4"
+	FamilyIPv6 Family = "ipv6"
+	FamilyDual Family = "dual"
+)
+
+// Protocol is the layer 4 protocol of an address.
+type Protocol string
+
+const (
+	ProtocolTCP  Protocol = "tcp"
+	ProtocolUDP  Protocol = "udp"
+	ProtocolSCTP Protocol = "sctp"
+	ProtocolAll  Protocol = "all"
+)
+
+// Switch is an "on" or "off" setting.
+type Switch string
+
+const (
+	SwitchOn  Switch = "on"
+	SwitchOff Switch = "off"
+)
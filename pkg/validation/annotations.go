@@ -0,0 +1,114 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ServiceAnnotationPrefix is the prefix of every Service annotation read by kube-nftlb.
+const ServiceAnnotationPrefix = "service.kubernetes.io/kube-nftlb-load-balancer-"
+
+// Service annotations (without prefix) that aren't farm settings
+const (
+	SharedKeyAnnotation = "shared-key"
+	PortsAnnotation     = "ports"
+)
+
+var (
+	// Map [farm setting (Service annotation without prefix)] to { validation func }, they can be set for every port.
+	// Settings are registered by their annotation processors.
+	settingAnnotations = make(map[string]func(string, *field.Path) field.ErrorList)
+
+	// Map [Service annotation (without prefix)] to { validation func }
+	serviceAnnotations = map[string]func(string, *field.Path) field.ErrorList{
+		SharedKeyAnnotation: SharedKey,
+		PortsAnnotation: func(value string, fldPath *field.Path) field.ErrorList {
+			_, errs := PortSettings(value, fldPath)
+			return errs
+		},
+	}
+)
+
+// RegisterSetting adds a farm setting (Service annotation without prefix) and its validation func. It must be called
+// before any annotation is checked.
+func RegisterSetting(name string, validate func(string, *field.Path) field.ErrorList) {
+	settingAnnotations[name] = validate
+	serviceAnnotations[name] = validate
+}
+
+// IsServiceAnnotation returns true if the annotation key has the kube-nftlb prefix.
+func IsServiceAnnotation(key string) bool {
+	return strings.HasPrefix(key, ServiceAnnotationPrefix)
+}
+
+// IsKnownServiceAnnotation returns true if a Service annotation (without prefix) is read by kube-nftlb.
+func IsKnownServiceAnnotation(name string) bool {
+	_, ok := serviceAnnotations[name]
+	return ok
+}
+
+// ServiceAnnotation checks a kube-nftlb Service annotation given its key (with prefix) and its value.
+func ServiceAnnotation(key string, value string) field.ErrorList {
+	fldPath := field.NewPath("metadata", "annotations")
+
+	validate, ok := serviceAnnotations[strings.TrimPrefix(key, ServiceAnnotationPrefix)]
+	if !ok {
+		return field.ErrorList{field.NotSupported(fldPath, key, ServiceAnnotationKeys())}
+	}
+	return validate(value, fldPath.Key(key))
+}
+
+// ServiceAnnotationKeys returns every known Service annotation key (with prefix).
+func ServiceAnnotationKeys() []string {
+	keys := make([]string, 0, len(serviceAnnotations))
+	for name := range serviceAnnotations {
+		keys = append(keys, ServiceAnnotationPrefix+name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PortSettings reads the ports annotation, a JSON object that maps port names or numbers to farm settings. Settings are
+// named as Service annotations without prefix, for example: {"http": {"scheduler": "hash"}, "53": {"mode": "dsr"}}.
+func PortSettings(value string, fldPath *field.Path) (map[string]map[string]string, field.ErrorList) {
+	portSettings := make(map[string]map[string]string)
+	if err := json.Unmarshal([]byte(value), &portSettings); err != nil {
+		return nil, field.ErrorList{field.Invalid(fldPath, value, fmt.Sprintf("must be a JSON object of port names or numbers to settings: %s", err.Error()))}
+	}
+
+	allErrs := field.ErrorList{}
+	for port, settings := range portSettings {
+		for name, setting := range settings {
+			validate, ok := settingAnnotations[name]
+			if !ok {
+				allErrs = append(allErrs, field.NotSupported(fldPath.Key(port), name, SettingNames()))
+				continue
+			}
+			allErrs = append(allErrs, validate(setting, fldPath.Key(port).Key(name))...)
+		}
+	}
+	return portSettings, allErrs
+}
+
+// Setting checks a farm setting given its name (a Service annotation without prefix) and its value.
+func Setting(name string, value string, fldPath *field.Path) field.ErrorList {
+	validate, ok := settingAnnotations[name]
+	if !ok {
+		return field.ErrorList{field.NotSupported(fldPath, name, SettingNames())}
+	}
+	return validate(value, fldPath.Key(name))
+}
+
+// SettingNames returns every farm setting that can be set for every port.
+func SettingNames() []string {
+	names := make([]string, 0, len(settingAnnotations))
+	for name := range settingAnnotations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,229 @@
+package validation
+
+import (
+	"net"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// DropInvalid removes every object that isn't valid before it's sent to nftlb, so the rest can still be sent. Objects
+// are removed one by one: an invalid address or backend is removed from its farm, and the farm is kept. It returns why
+// every object was removed. Empty values aren't checked, they aren't sent.
+func DropInvalid(n *types.Nftlb) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	farms := n.Farms[:0]
+	for index := range n.Farms {
+		fldPath := field.NewPath("farms").Index(index)
+		allErrs = append(allErrs, dropInvalidFarm(&n.Farms[index], fldPath)...)
+		if errs := Farm(&n.Farms[index], fldPath); len(errs) > 0 {
+			allErrs = append(allErrs, errs...)
+			continue
+		}
+		farms = append(farms, n.Farms[index])
+	}
+	n.Farms = farms
+
+	addresses := n.Addresses[:0]
+	for index := range n.Addresses {
+		if errs := Address(&n.Addresses[index], field.NewPath("addresses").Index(index)); len(errs) > 0 {
+			allErrs = append(allErrs, errs...)
+			continue
+		}
+		addresses = append(addresses, n.Addresses[index])
+	}
+	n.Addresses = addresses
+
+	policies := n.Policies[:0]
+	for index := range n.Policies {
+		fldPath := field.NewPath("policies").Index(index)
+		allErrs = append(allErrs, dropInvalidPolicy(&n.Policies[index], fldPath)...)
+		if errs := Policy(&n.Policies[index], fldPath); len(errs) > 0 {
+			allErrs = append(allErrs, errs...)
+			continue
+		}
+		policies = append(policies, n.Policies[index])
+	}
+	n.Policies = policies
+
+	return allErrs
+}
+
+// dropInvalidFarm removes the addresses, backends and policies of a farm that aren't valid. It returns why they were removed.
+func dropInvalidFarm(f *types.Farm, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	addresses := f.Addresses[:0]
+	for index := range f.Addresses {
+		if errs := Address(&f.Addresses[index], fldPath.Child("addresses").Index(index)); len(errs) > 0 {
+			allErrs = append(allErrs, errs...)
+			continue
+		}
+		addresses = append(addresses, f.Addresses[index])
+	}
+	f.Addresses = addresses
+
+	backends := f.Backends[:0]
+	for index := range f.Backends {
+		if errs := Backend(&f.Backends[index], fldPath.Child("backends").Index(index)); len(errs) > 0 {
+			allErrs = append(allErrs, errs...)
+			continue
+		}
+		backends = append(backends, f.Backends[index])
+	}
+	f.Backends = backends
+
+	policies := f.Policies[:0]
+	for index, policy := range f.Policies {
+		if policy.Name == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("policies").Index(index).Child("name"), ""))
+			continue
+		}
+		policies = append(policies, policy)
+	}
+	f.Policies = policies
+
+	return allErrs
+}
+
+// dropInvalidPolicy removes the elements of a policy that aren't valid. It returns why they were removed.
+func dropInvalidPolicy(p *types.Policy, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	elements := p.Elements[:0]
+	for index, element := range p.Elements {
+		if errs := PolicyElement(element.Data, fldPath.Child("elements").Index(index).Child("data")); len(errs) > 0 {
+			allErrs = append(allErrs, errs...)
+			continue
+		}
+		elements = append(elements, element)
+	}
+	p.Elements = elements
+
+	return allErrs
+}
+
+// Farm checks a farm, its addresses and its backends.
+func Farm(f *types.Farm, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if f.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), ""))
+	}
+
+	allErrs = append(allErrs, validateString(string(f.Mode), Mode, fldPath.Child("mode"))...)
+	allErrs = append(allErrs, validateString(string(f.Scheduler), Scheduler, fldPath.Child("scheduler"))...)
+	allErrs = append(allErrs, validateString(string(f.SchedParam), SchedParam, fldPath.Child("sched-param"))...)
+	allErrs = append(allErrs, validateString(string(f.Helper), Helper, fldPath.Child("helper"))...)
+	allErrs = append(allErrs, validateString(string(f.Log), Log, fldPath.Child("log"))...)
+	allErrs = append(allErrs, validateString(string(f.State), State, fldPath.Child("state"))...)
+	allErrs = append(allErrs, validateString(string(f.IntraConnect), Switch, fldPath.Child("intra-connect"))...)
+	allErrs = append(allErrs, validateString(string(f.Persistence), Persistence, fldPath.Child("persistence"))...)
+	allErrs = append(allErrs, validateString(string(f.TCPStrict), Switch, fldPath.Child("tcp-strict"))...)
+	allErrs = append(allErrs, validateString(f.SourceAddr, IP, fldPath.Child("source-addr"))...)
+	allErrs = append(allErrs, validateMark(f.Mark, fldPath.Child("mark"))...)
+	allErrs = append(allErrs, validateMin(f.Priority, 1, fldPath.Child("priority"))...)
+	allErrs = append(allErrs, validateMin(f.PersistTTL, 1, fldPath.Child("persist-ttl"))...)
+
+	if f.Queue != nil && *f.Queue < -1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("queue"), f.Queue.String(), "must be -1 (disabled) or a queue number"))
+	}
+	if f.Mode == types.ModeDSR && f.Iface == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("iface"), "dsr mode needs an interface"))
+	}
+
+	for index := range f.Addresses {
+		allErrs = append(allErrs, Address(&f.Addresses[index], fldPath.Child("addresses").Index(index))...)
+	}
+	for index := range f.Backends {
+		allErrs = append(allErrs, Backend(&f.Backends[index], fldPath.Child("backends").Index(index))...)
+	}
+	for index, policy := range f.Policies {
+		if policy.Name == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("policies").Index(index).Child("name"), ""))
+		}
+	}
+	return allErrs
+}
+
+// Address checks an address.
+func Address(a *types.Address, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if a.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), ""))
+	}
+
+	allErrs = append(allErrs, validateString(string(a.Family), Family, fldPath.Child("family"))...)
+	allErrs = append(allErrs, validateString(string(a.Protocol), Protocol, fldPath.Child("protocol"))...)
+	allErrs = append(allErrs, validateString(a.IPAddr, IP, fldPath.Child("ip-addr"))...)
+	allErrs = append(allErrs, validateString(a.Ports, Ports, fldPath.Child("ports"))...)
+
+	// The address family must match its IP
+	if ip := net.ParseIP(a.IPAddr); ip != nil && a.Family != "" {
+		if (ip.To4() != nil) != (a.Family == types.FamilyIPv4) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("ip-addr"), a.IPAddr, "must match the address family "+string(a.Family)))
+		}
+	}
+	return allErrs
+}
+
+// Backend checks a backend.
+func Backend(b *types.Backend, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if b.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), ""))
+	}
+	if b.IPAddr == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("ip-addr"), ""))
+	}
+
+	allErrs = append(allErrs, validateString(b.IPAddr, IP, fldPath.Child("ip-addr"))...)
+	allErrs = append(allErrs, validateString(string(b.State), State, fldPath.Child("state"))...)
+	allErrs = append(allErrs, validateMark(b.Mark, fldPath.Child("mark"))...)
+	allErrs = append(allErrs, validateMin(b.Weight, 1, fldPath.Child("weight"))...)
+	allErrs = append(allErrs, validateMin(b.Priority, 1, fldPath.Child("priority"))...)
+
+	if b.Port != nil && *b.Port == 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("port"), b.Port.String(), "must be between 1 and 65535"))
+	}
+	return allErrs
+}
+
+// Policy checks a policy and its elements.
+func Policy(p *types.Policy, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if p.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), ""))
+	}
+
+	allErrs = append(allErrs, validateString(p.Type, PolicyType, fldPath.Child("type"))...)
+	allErrs = append(allErrs, validateString(p.Family, Family, fldPath.Child("family"))...)
+	for index, element := range p.Elements {
+		allErrs = append(allErrs, PolicyElement(element.Data, fldPath.Child("elements").Index(index).Child("data"))...)
+	}
+	return allErrs
+}
+
+// validateString checks a value only if it isn't empty.
+func validateString(value string, validate func(string, *field.Path) field.ErrorList, fldPath *field.Path) field.ErrorList {
+	if value == "" {
+		return nil
+	}
+	return validate(value, fldPath)
+}
+
+// validateMark checks a mark only if it's set.
+func validateMark(mark *types.Mark, fldPath *field.Path) field.ErrorList {
+	if mark == nil {
+		return nil
+	}
+	return MarkValue(uint32(*mark), fldPath)
+}
+
+// validateMin checks that a number is at least min, only if it's set.
+func validateMin(number *types.Number, min types.Number, fldPath *field.Path) field.ErrorList {
+	if number != nil && *number < min {
+		return field.ErrorList{field.Invalid(fldPath, number.String(), "must be at least "+min.String())}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package validation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/zevenet/kube-nftlb/pkg/types"
+)
+
+// Golden files of the nftlb model must be valid, so they're what nftlb accepts
+func TestGoldenFiles(t *testing.T) {
+	goldens, err := filepath.Glob(filepath.Join("..", "types", "testdata", "*.golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(goldens) == 0 {
+		t.Fatal("got no golden files")
+	}
+
+	for _, golden := range goldens {
+		data, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nftlb := types.Nftlb{}
+		if err := json.Unmarshal(data, &nftlb); err != nil {
+			t.Fatalf("%s: %s", golden, err.Error())
+		}
+		if errs := DropInvalid(&nftlb); len(errs) > 0 {
+			t.Fatalf("%s: %s", golden, errs.ToAggregate().Error())
+		}
+	}
+}
+
+func TestDropInvalid(t *testing.T) {
+	nftlb := types.Nftlb{
+		Farms: []types.Farm{
+			{
+				Name: "default--web--http",
+				Mode: types.ModeSNAT,
+				Addresses: []types.Address{
+					{Name: "default--web--http--ipv4", Family: types.FamilyIPv4, IPAddr: "192.168.0.10", Ports: "80", Protocol: types.ProtocolTCP},
+					// An external IP of the other family
+					{Name: "default--web--http--ipv4-1", Family: types.FamilyIPv4, IPAddr: "fd00::10", Ports: "80", Protocol: types.ProtocolTCP},
+				},
+				Backends: []types.Backend{
+					{Name: "web-0", IPAddr: "172.17.0.2"},
+					{Name: "web-1", IPAddr: "172.17.0.3", Weight: types.NewNumber(0)},
+				},
+			},
+			{Name: "default--dns--dns", Mode: types.ModeDSR},
+		},
+		Policies: []types.Policy{{
+			Name:     "default--web--blacklist",
+			Type:     "blacklist",
+			Family:   "ipv4",
+			Elements: []types.Element{{Data: "10.0.0.0/8"}, {Data: "10.0.0.0/40"}},
+		}},
+	}
+
+	// The address, the backend, the farm without interface and the policy element are dropped
+	if errs := DropInvalid(&nftlb); len(errs) != 4 {
+		t.Fatalf("got errors %v, want 4 errors", errs)
+	}
+
+	if len(nftlb.Farms) != 1 || nftlb.Farms[0].Name != "default--web--http" {
+		t.Fatalf("got farms %+v, want only default--web--http", nftlb.Farms)
+	}
+	if addresses := nftlb.Farms[0].Addresses; len(addresses) != 1 || addresses[0].IPAddr != "192.168.0.10" {
+		t.Fatalf("got addresses %+v, want only 192.168.0.10", addresses)
+	}
+	if backends := nftlb.Farms[0].Backends; len(backends) != 1 || backends[0].Name != "web-0" {
+		t.Fatalf("got backends %+v, want only web-0", backends)
+	}
+	if elements := nftlb.Policies[0].Elements; len(elements) != 1 || elements[0].Data != "10.0.0.0/8" {
+		t.Fatalf("got elements %+v, want only 10.0.0.0/8", elements)
+	}
+}
+
+func TestHelpers(t *testing.T) {
+	helpers := []types.Helper{types.HelperNone, types.HelperAmanda, types.HelperFTP, types.HelperH323, types.HelperIRC, types.HelperNetbiosNS, types.HelperPPTP, types.HelperSane, types.HelperSIP, types.HelperSNMP, types.HelperTFTP}
+	if len(helpers) != len(Helpers) {
+		t.Fatalf("got %d helpers, want the %d helpers accepted by nftlb", len(helpers), len(Helpers))
+	}
+	for _, helper := range helpers {
+		if errs := Helper(string(helper), nil); len(errs) > 0 {
+			t.Fatalf("helper %q: %s", helper, errs.ToAggregate().Error())
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package validation
+
+import (
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// PodAnnotationPrefix is the prefix of every Pod annotation read by kube-nftlb.
+const PodAnnotationPrefix = "pod.kubernetes.io/kube-nftlb-backend-"
+
+// Map [Pod annotation (without prefix)] to { validation func }, they're backend settings registered by their
+// annotation processors
+var podAnnotations = make(map[string]func(string, *field.Path) field.ErrorList)
+
+// RegisterPodAnnotation adds a backend setting (Pod annotation without prefix) and its validation func. It must be
+// called before any annotation is checked.
+func RegisterPodAnnotation(name string, validate func(string, *field.Path) field.ErrorList) {
+	podAnnotations[name] = validate
+}
+
+// IsPodAnnotation returns true if the annotation key has the kube-nftlb Pod prefix.
+func IsPodAnnotation(key string) bool {
+	return strings.HasPrefix(key, PodAnnotationPrefix)
+}
+
+// PodAnnotation checks a kube-nftlb Pod annotation given its key (with prefix) and its value.
+func PodAnnotation(key string, value string) field.ErrorList {
+	fldPath := field.NewPath("metadata", "annotations")
+
+	validate, ok := podAnnotations[strings.TrimPrefix(key, PodAnnotationPrefix)]
+	if !ok {
+		return field.ErrorList{field.NotSupported(fldPath, key, PodAnnotationKeys())}
+	}
+	return validate(value, fldPath.Key(key))
+}
+
+// PodAnnotationKeys returns every known Pod annotation key (with prefix).
+func PodAnnotationKeys() []string {
+	keys := make([]string, 0, len(podAnnotations))
+	for name := range podAnnotations {
+		keys = append(keys, PodAnnotationPrefix+name)
+	}
+	sort.Strings(keys)
+	return keys
+}
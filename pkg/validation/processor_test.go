@@ -0,0 +1,7 @@
+package validation_test
+
+import (
+	// Farm settings and Pod annotations are registered by their annotation processors, the tests of this package
+	// check them too
+	_ "github.com/zevenet/kube-nftlb/pkg/processor"
+)
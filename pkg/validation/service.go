@@ -0,0 +1,98 @@
+package validation
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Service checks every kube-nftlb annotation of a Service, and combinations of annotations and Service fields that
+// can't be programmed. If allowedExternalIPs isn't empty, every externalIP must be inside one of those networks.
+//
+// The health check timeout isn't compared to the interval: either of them may come from the defaults of the cluster or
+// the Namespace, which are only read by the nodes. Every node compares them once defaults are applied, and an invalid
+// pair is recorded as a Warning Event.
+func Service(service *corev1.Service, allowedExternalIPs []*net.IPNet) field.ErrorList {
+	allErrs := field.ErrorList{}
+	annotationsPath := field.NewPath("metadata", "annotations")
+
+	for key, value := range service.Annotations {
+		if IsServiceAnnotation(key) {
+			allErrs = append(allErrs, ServiceAnnotation(key, value)...)
+		}
+	}
+
+	if mode, ok := service.Annotations[ServiceAnnotationPrefix+"mode"]; ok {
+		allErrs = append(allErrs, ModeForType(mode, service.Spec.Type, annotationsPath.Key(ServiceAnnotationPrefix+"mode"))...)
+	}
+
+	// Settings for every port must be made for ports of this Service
+	if value, ok := service.Annotations[ServiceAnnotationPrefix+PortsAnnotation]; ok {
+		portsPath := annotationsPath.Key(ServiceAnnotationPrefix + PortsAnnotation)
+		portSettings, _ := PortSettings(value, portsPath)
+		for port, settings := range portSettings {
+			if !HasPort(service, port) {
+				allErrs = append(allErrs, field.NotFound(portsPath.Key(port), port))
+			}
+			if mode, ok := settings["mode"]; ok {
+				allErrs = append(allErrs, ModeForType(mode, service.Spec.Type, portsPath.Key(port).Key("mode"))...)
+			}
+		}
+	}
+
+	allErrs = append(allErrs, ExternalIPs(service.Spec.ExternalIPs, allowedExternalIPs, field.NewPath("spec", "externalIPs"))...)
+
+	return allErrs
+}
+
+// ModeForType checks if a farm mode can be used for a Service type. DSR needs a virtual IP, but NodePort addresses
+// don't have one.
+func ModeForType(mode string, serviceType corev1.ServiceType, fldPath *field.Path) field.ErrorList {
+	if mode == "dsr" && (serviceType == corev1.ServiceTypeNodePort || serviceType == corev1.ServiceTypeLoadBalancer) {
+		return field.ErrorList{field.Invalid(fldPath, mode, fmt.Sprintf("can't be used in %s Services", serviceType))}
+	}
+	return nil
+}
+
+// ExternalIPs checks that every externalIP is inside one of the allowed networks. Every externalIP is allowed if
+// there are no allowed networks.
+func ExternalIPs(externalIPs []string, allowedExternalIPs []*net.IPNet, fldPath *field.Path) field.ErrorList {
+	if len(allowedExternalIPs) == 0 {
+		return nil
+	}
+
+	allErrs := field.ErrorList{}
+	for index, externalIP := range externalIPs {
+		ip := net.ParseIP(externalIP)
+		if ip == nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(index), externalIP, "must be a valid IP address"))
+			continue
+		}
+
+		allowed := false
+		for _, network := range allowedExternalIPs {
+			if network.Contains(ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Index(index), fmt.Sprintf("%s isn't inside the allowed networks", externalIP)))
+		}
+	}
+	return allErrs
+}
+
+// HasPort returns true if a Service has a port with that name or number.
+func HasPort(service *corev1.Service, port string) bool {
+	for _, servicePort := range service.Spec.Ports {
+		if servicePort.Name == port || strconv.Itoa(int(servicePort.Port)) == port {
+			return true
+		}
+	}
+	return false
+}
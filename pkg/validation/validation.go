@@ -0,0 +1,328 @@
+package validation
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	k8svalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Mode checks a farm mode.
+func Mode(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, Modes, fldPath)
+}
+
+// Scheduler checks a farm scheduler.
+func Scheduler(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, Schedulers, fldPath)
+}
+
+// SchedParam checks a farm sched-param ("none" or a list of packet fields).
+func SchedParam(value string, fldPath *field.Path) field.ErrorList {
+	return noneOrList(value, PacketFields, fldPath)
+}
+
+// Persistence checks a farm persistence ("none" or a list of packet fields).
+func Persistence(value string, fldPath *field.Path) field.ErrorList {
+	return noneOrList(value, PacketFields, fldPath)
+}
+
+// Helper checks a farm helper.
+func Helper(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, Helpers, fldPath)
+}
+
+// Log checks a farm log ("none" or a list of netfilter hooks).
+func Log(value string, fldPath *field.Path) field.ErrorList {
+	return noneOrList(value, LogHooks, fldPath)
+}
+
+// State checks a farm or backend state.
+func State(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, States, fldPath)
+}
+
+// FarmState checks a farm state set for maintenance.
+func FarmState(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, FarmStates, fldPath)
+}
+
+// BackendState checks a backend state set for maintenance.
+func BackendState(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, BackendStates, fldPath)
+}
+
+// Family checks a farm or address family.
+func Family(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, Families, fldPath)
+}
+
+// Protocol checks an address protocol.
+func Protocol(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, Protocols, fldPath)
+}
+
+// Ports checks a nftlb ports string, a comma separated list of ports and port ranges (example: "80,443,8000-8002").
+func Ports(value string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for _, portRange := range strings.Split(value, ",") {
+		limits := strings.SplitN(portRange, "-", 2)
+		first, errFirst := strconv.ParseUint(limits[0], 10, 16)
+		last, errLast := first, errFirst
+		if len(limits) == 2 {
+			last, errLast = strconv.ParseUint(limits[1], 10, 16)
+		}
+
+		if errFirst != nil || errLast != nil || first == 0 || last < first {
+			allErrs = append(allErrs, field.Invalid(fldPath, portRange, "must be a port or a port range between 1 and 65535"))
+		}
+	}
+	return allErrs
+}
+
+// Switch checks an "on" or "off" value (for example, a farm tcp-strict).
+func Switch(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, Switches, fldPath)
+}
+
+// MasqueradeMark is the mark used by nftlb to masquerade packets (NFTLB_MASQUERADE_MARK), farm marks can't use any of its bits.
+var MasqueradeMark uint32
+
+// ParseMark reads a packet mark in hexadecimal format ("0x" prefix) or decimal format.
+func ParseMark(value string) (uint32, error) {
+	mark, err := strconv.ParseUint(value, 0, 32)
+	return uint32(mark), err
+}
+
+// Mark checks a packet mark in hexadecimal format, which can't collide with the masquerade mark.
+func Mark(value string, fldPath *field.Path) field.ErrorList {
+	if !strings.HasPrefix(value, "0x") {
+		return field.ErrorList{field.Invalid(fldPath, value, `must be a hexadecimal number with "0x" prefix`)}
+	}
+
+	mark, err := ParseMark(value)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value, "must be a 32 bits hexadecimal number")}
+	}
+	return MarkValue(mark, fldPath)
+}
+
+// MarkValue checks that a packet mark doesn't collide with the masquerade mark.
+func MarkValue(mark uint32, fldPath *field.Path) field.ErrorList {
+	if mark&MasqueradeMark != 0 {
+		return field.ErrorList{field.Invalid(fldPath, fmt.Sprintf("0x%x", mark), fmt.Sprintf("can't use bits of the masquerade mark 0x%x", MasqueradeMark))}
+	}
+	return nil
+}
+
+// IP checks an IPv4 or IPv6 address.
+func IP(value string, fldPath *field.Path) field.ErrorList {
+	if net.ParseIP(value) == nil {
+		return field.ErrorList{field.Invalid(fldPath, value, "must be a valid IP address")}
+	}
+	return nil
+}
+
+// PolicyType checks a policy type.
+func PolicyType(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, PolicyTypes, fldPath)
+}
+
+// PolicyElement checks a policy element, an IP address or a network in CIDR notation.
+func PolicyElement(value string, fldPath *field.Path) field.ErrorList {
+	if _, _, err := net.ParseCIDR(value); err != nil && net.ParseIP(value) == nil {
+		return field.ErrorList{field.Invalid(fldPath, value, "must be a valid IP address or network (CIDR)")}
+	}
+	return nil
+}
+
+// Duration checks a non-negative duration (for example, "90s" or "2m").
+func Duration(value string, fldPath *field.Path) field.ErrorList {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value, `must be a duration, for example: "90s" or "2m"`)}
+	} else if duration < 0 {
+		return field.ErrorList{field.Invalid(fldPath, value, "must not be negative")}
+	}
+	return nil
+}
+
+// HealthCheck checks a health check type.
+func HealthCheck(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, HealthChecks, fldPath)
+}
+
+// PositiveDuration checks a duration greater than zero (for example, "5s").
+func PositiveDuration(value string, fldPath *field.Path) field.ErrorList {
+	if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+		return field.ErrorList{field.Invalid(fldPath, value, `must be a positive duration, for example: "5s" or "500ms"`)}
+	}
+	return nil
+}
+
+// HealthCheckTimeout checks that a health check times out before the next one is sent. Invalid durations aren't
+// checked, they're reported by PositiveDuration.
+func HealthCheckTimeout(interval string, timeout string, fldPath *field.Path) field.ErrorList {
+	intervalDuration, errInterval := time.ParseDuration(interval)
+	timeoutDuration, errTimeout := time.ParseDuration(timeout)
+	if errInterval == nil && errTimeout == nil && timeoutDuration >= intervalDuration {
+		return field.ErrorList{field.Invalid(fldPath, timeout, fmt.Sprintf("must be shorter than the health check interval (%s)", interval))}
+	}
+	return nil
+}
+
+// HTTPPath checks the path of an HTTP request.
+func HTTPPath(value string, fldPath *field.Path) field.ErrorList {
+	if !strings.HasPrefix(value, "/") || strings.ContainsAny(value, " \t\r\n") {
+		return field.ErrorList{field.Invalid(fldPath, value, `must be a path starting with "/", without spaces`)}
+	}
+	return nil
+}
+
+// ParseHTTPStatus returns the range of HTTP status codes of a value: a single code ("200") or a range ("200-399").
+func ParseHTTPStatus(value string) (int, int, error) {
+	bounds := strings.SplitN(value, "-", 2)
+	min, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	max := min
+	if len(bounds) == 2 {
+		if max, err = strconv.Atoi(bounds[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if min < 100 || max > 599 || min > max {
+		return 0, 0, fmt.Errorf("status codes must be between 100 and 599")
+	}
+	return min, max, nil
+}
+
+// HTTPStatus checks the HTTP status codes expected from a backend.
+func HTTPStatus(value string, fldPath *field.Path) field.ErrorList {
+	if _, _, err := ParseHTTPStatus(value); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value, `must be a status code or a range between 100 and 599, for example: "200" or "200-399"`)}
+	}
+	return nil
+}
+
+// AutoWeight checks how automatic backend weights are found.
+func AutoWeight(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, AutoWeights, fldPath)
+}
+
+// Topology checks how backends are preferred by the topology of their nodes.
+func Topology(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, Topologies, fldPath)
+}
+
+// NoEndpoints checks what is done with traffic of a farm without backends.
+func NoEndpoints(value string, fldPath *field.Path) field.ErrorList {
+	return oneOf(value, NoEndpointsActions, fldPath)
+}
+
+// ObjectKey checks a reference to an object in a namespace: "name" (same namespace) or "namespace/name".
+func ObjectKey(value string, fldPath *field.Path) field.ErrorList {
+	parts := strings.Split(value, "/")
+	if len(parts) > 2 {
+		return field.ErrorList{field.Invalid(fldPath, value, `must be "name" or "namespace/name"`)}
+	}
+
+	allErrs := field.ErrorList{}
+	for _, part := range parts {
+		for _, msg := range k8svalidation.IsDNS1123Label(part) {
+			allErrs = append(allErrs, field.Invalid(fldPath, value, msg))
+		}
+	}
+	return allErrs
+}
+
+// SharedKey checks the shared key of a Service, it's part of the names of its shared addresses.
+func SharedKey(value string, fldPath *field.Path) field.ErrorList {
+	if value == "" {
+		return field.ErrorList{field.Required(fldPath, "")}
+	}
+
+	allErrs := field.ErrorList{}
+	for _, msg := range k8svalidation.IsDNS1123Label(value) {
+		allErrs = append(allErrs, field.Invalid(fldPath, value, msg))
+	}
+	return allErrs
+}
+
+// ConfigMapName checks the name of a ConfigMap in the same namespace.
+func ConfigMapName(value string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for _, msg := range k8svalidation.IsDNS1123Subdomain(value) {
+		allErrs = append(allErrs, field.Invalid(fldPath, value, msg))
+	}
+	return allErrs
+}
+
+// NodeSelector checks a label selector for nodes (for example, "node-role.kubernetes.io/ingress" or "zone in (a,b)").
+func NodeSelector(value string, fldPath *field.Path) field.ErrorList {
+	if _, err := labels.Parse(value); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value, err.Error())}
+	}
+	return nil
+}
+
+// Integer checks a base 10 integer between min and max (both included).
+func Integer(value string, min int64, max int64, fldPath *field.Path) field.ErrorList {
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value, "must be an integer")}
+	} else if number < min || number > max {
+		return field.ErrorList{field.Invalid(fldPath, value, fmt.Sprintf("must be between %d and %d", min, max))}
+	}
+	return nil
+}
+
+// oneOf checks that value is one of validValues.
+func oneOf(value string, validValues []string, fldPath *field.Path) field.ErrorList {
+	if !contains(validValues, value) {
+		return field.ErrorList{field.NotSupported(fldPath, value, validValues)}
+	}
+	return nil
+}
+
+// noneOrList checks that value is "none" or a space separated list of validValues without duplicates.
+func noneOrList(value string, validValues []string, fldPath *field.Path) field.ErrorList {
+	if value == "none" {
+		return nil
+	}
+
+	values := strings.Fields(value)
+	if len(values) == 0 {
+		return field.ErrorList{field.Required(fldPath, fmt.Sprintf(`must be "none" or a space separated list of: %s`, strings.Join(validValues, ", ")))}
+	}
+
+	allErrs := field.ErrorList{}
+	seen := make(map[string]bool)
+	for _, item := range values {
+		if !contains(validValues, item) {
+			allErrs = append(allErrs, field.NotSupported(fldPath, item, append([]string{"none"}, validValues...)))
+		} else if seen[item] {
+			allErrs = append(allErrs, field.Duplicate(fldPath, item))
+		}
+		seen[item] = true
+	}
+	return allErrs
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
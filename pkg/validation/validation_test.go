@@ -0,0 +1,123 @@
+package validation
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMark(t *testing.T) {
+	MasqueradeMark = 0x40000000
+	defer func() { MasqueradeMark = 0 }()
+
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"0x1", true},
+		{"0x3fffffff", true},
+		{"0x40000000", false},
+		{"0xc0000000", false},
+		{"0x100000000", false},
+		{"256", false},
+		{"0xzz", false},
+	}
+
+	for _, test := range tests {
+		errs := Mark(test.value, nil)
+		if valid := len(errs) == 0; valid != test.valid {
+			t.Errorf("%q: got valid %t, want %t (%v)", test.value, valid, test.valid, errs)
+		}
+	}
+}
+
+func TestServiceAnnotation(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"mode", "dsr", true},
+		{"mode", "DSR", false},
+		{"scheduler", "rr", true},
+		{"scheduler", "roundrobin", false},
+		{"sched-param", "srcip dstport", true},
+		{"sched-param", "srcip srcip", false},
+		{"persistence", "none", true},
+		{"persistence", "", false},
+		{"persistence", "srcip cookie", false},
+		{"helper", "ftp", true},
+		{"helper", "http", false},
+		{"log", "input forward", true},
+		{"log", "prerouting", false},
+		{"est-connlimit", "0", true},
+		{"est-connlimit", "4294967295", true},
+		{"est-connlimit", "4294967296", false},
+		{"est-connlimit", "-1", false},
+		{"est-connlimit", "ten", false},
+		{"shared-key", "dns", true},
+		{"shared-key", "", false},
+		{"shared-key", "DNS servers", false},
+		{"source-addr", "fd00::1", true},
+		{"source-addr", "192.168.0", false},
+		{"intra-connect", "off", true},
+		{"intra-connect", "no", false},
+		{"priority", "1", true},
+		{"priority", "0", false},
+		{"ports", `{"http": {"scheduler": "hash"}, "53": {"mode": "dsr"}}`, true},
+		{"ports", `{"http": {"scheduler": "roundrobin"}}`, false},
+		{"ports", `{"http": {"shared-key": "dns"}}`, false},
+		{"ports", `{"http": "hash"}`, false},
+		{"unknown", "value", false},
+	}
+
+	for _, test := range tests {
+		errs := ServiceAnnotation(ServiceAnnotationPrefix+test.name, test.value)
+		if valid := len(errs) == 0; valid != test.valid {
+			t.Errorf("%s: %q: got valid %t, want %t (%v)", test.name, test.value, valid, test.valid, errs)
+		}
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	tests := []struct {
+		interval string
+		timeout  string
+		valid    bool
+	}{
+		{"10s", "2s", true},
+		{"10s", "10s", false},
+		{"1s", "1500ms", false},
+		// Invalid durations are reported by PositiveDuration
+		{"", "2s", true},
+		{"10s", "soon", true},
+	}
+
+	for _, test := range tests {
+		errs := HealthCheckTimeout(test.interval, test.timeout, nil)
+		if valid := len(errs) == 0; valid != test.valid {
+			t.Errorf("interval %q, timeout %q: got valid %t, want %t (%v)", test.interval, test.timeout, valid, test.valid, errs)
+		}
+	}
+}
+
+func TestServiceHealthCheckTimeout(t *testing.T) {
+	// Defaults aren't known here, so a timeout is allowed even if it's longer than the built-in interval
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				ServiceAnnotationPrefix + "health-check-timeout": "15s",
+				ServiceAnnotationPrefix + "ports":                `{"http": {"health-check-interval": "1s"}}`,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{{Name: "http", Port: 80}},
+		},
+	}
+
+	if errs := Service(service, nil); len(errs) != 0 {
+		t.Fatalf("got errors %v, want none", errs)
+	}
+}
@@ -0,0 +1,35 @@
+package validation
+
+// Values accepted by nftlb.
+var (
+	Modes       = []string{"snat", "dnat", "stlsdnat", "dsr"}
+	Schedulers  = []string{"rr", "weight", "hash", "symhash"}
+	Helpers     = []string{"none", "amanda", "ftp", "h323", "irc", "netbios-ns", "pptp", "sane", "sip", "snmp", "tftp"}
+	Switches    = []string{"on", "off"}
+	AutoWeights = []string{"none", "cpu", "memory", "node-cpu", "node-memory"}
+	States      = []string{"up", "down", "off", "config"}
+	Families    = []string{"ipv4", "ipv6", "dual"}
+	Protocols   = []string{"tcp", "udp", "sctp", "all"}
+
+	// What is done with traffic of a farm without backends
+	NoEndpointsActions = []string{"drop", "reject", "fallback"}
+
+	// States that can be set for maintenance through Service and Pod annotations
+	FarmStates    = []string{"up", "down", "off"}
+	BackendStates = []string{"up", "off"}
+
+	// Backends can be preferred by the topology of their nodes
+	Topologies = []string{"none", "zone"}
+
+	// Health checks run by kube-nftlb against every backend
+	HealthChecks = []string{"none", "tcp", "http", "udp"}
+
+	// Policies allow (whitelist) or deny (blacklist) traffic from their elements
+	PolicyTypes = []string{"blacklist", "whitelist"}
+
+	// Persistence and sched-param can be "none" or a space separated list of these values
+	PacketFields = []string{"srcip", "dstip", "srcport", "dstport", "srcmac", "dstmac"}
+
+	// Log can be "none" or a space separated list of these values
+	LogHooks = []string{"input", "forward", "output"}
+)
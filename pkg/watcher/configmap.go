@@ -0,0 +1,17 @@
+package watcher
+
+import (
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NewConfigMapListWatch makes a ListWatch for a single ConfigMap resource given its namespace and name.
+func NewConfigMapListWatch(clientset *kubernetes.Clientset, namespace string, name string) *cache.ListWatch {
+	return cache.NewListWatchFromClient(
+		clientset.CoreV1().RESTClient(), // REST interface
+		"configmaps",                    // Resource to watch for
+		namespace,                       // Resource can be found in this namespace
+		fields.OneTermEqualSelector("metadata.name", name), // Get the resource with this name
+	)
+}
@@ -0,0 +1,50 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newCustomResourceListWatch makes a ListWatch for every custom resource of a kind in the cluster. Objects are
+// *unstructured.Unstructured.
+func newCustomResourceListWatch(dynamicClient dynamic.Interface, resource schema.GroupVersionResource) *cache.ListWatch {
+	client := dynamicClient.Resource(resource).Namespace(corev1.NamespaceAll)
+
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return client.List(context.TODO(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return client.Watch(context.TODO(), options)
+		},
+	}
+}
+
+// CustomResourceServed returns an error if the API Server doesn't serve a custom resource (for example, its CRD isn't
+// applied), so it can't be watched.
+func CustomResourceServed(discoveryClient discovery.DiscoveryInterface, resource schema.GroupVersionResource) error {
+	resources, err := discoveryClient.ServerResourcesForGroupVersion(resource.GroupVersion().String())
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("%s isn't served by the API Server, its CRD must be applied", resource.GroupResource().String())
+	} else if err != nil {
+		return err
+	}
+
+	for _, apiResource := range resources.APIResources {
+		if apiResource.Name == resource.Resource {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s isn't served by the API Server, its CRD must be applied", resource.GroupResource().String())
+}
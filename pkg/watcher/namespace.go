@@ -0,0 +1,19 @@
+package watcher
+
+import (
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NewNamespaceListWatch makes a ListWatch for every Namespace resource in the cluster.
+func NewNamespaceListWatch(clientset *kubernetes.Clientset) *cache.ListWatch {
+	return cache.NewListWatchFromClient(
+		clientset.CoreV1().RESTClient(), // REST interface
+		"namespaces",                    // Resource to watch for
+		corev1.NamespaceAll,             // Resource isn't namespaced
+		fields.Everything(),             // Get ALL fields from requested resource
+	)
+}
@@ -0,0 +1,12 @@
+package watcher
+
+import (
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NewNftlbFarmListWatch makes a ListWatch for every NftlbFarm custom resource in the cluster.
+func NewNftlbFarmListWatch(dynamicClient dynamic.Interface) *cache.ListWatch {
+	return newCustomResourceListWatch(dynamicClient, types.NftlbFarmResource)
+}
@@ -0,0 +1,19 @@
+package watcher
+
+import (
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NewPodListWatch makes a ListWatch for every Pod resource in the cluster.
+func NewPodListWatch(clientset *kubernetes.Clientset) *cache.ListWatch {
+	return cache.NewListWatchFromClient(
+		clientset.CoreV1().RESTClient(), // REST interface
+		"pods",                          // Resource to watch for
+		corev1.NamespaceAll,             // Resource can be found in ALL namespaces
+		fields.Everything(),             // Get ALL fields from requested resource
+	)
+}
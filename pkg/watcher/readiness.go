@@ -0,0 +1,22 @@
+package watcher
+
+import (
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NewProgrammedPodsListWatch makes a ListWatch for every ConfigMap resource where a node reports its programmed Pods
+// (labeled as such) in a namespace.
+func NewProgrammedPodsListWatch(clientset *kubernetes.Clientset, namespace string) *cache.ListWatch {
+	return cache.NewFilteredListWatchFromClient(
+		clientset.CoreV1().RESTClient(), // REST interface
+		"configmaps",                    // Resource to watch for
+		namespace,                       // Resource can be found in this namespace
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = types.ProgrammedPodsLabel // Get only ConfigMaps with this label
+		},
+	)
+}
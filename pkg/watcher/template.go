@@ -0,0 +1,23 @@
+package watcher
+
+import (
+	"github.com/zevenet/kube-nftlb/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NewFarmTemplateListWatch makes a ListWatch for every ConfigMap resource with a farm template (labeled as such) in
+// the cluster.
+func NewFarmTemplateListWatch(clientset *kubernetes.Clientset) *cache.ListWatch {
+	return cache.NewFilteredListWatchFromClient(
+		clientset.CoreV1().RESTClient(), // REST interface
+		"configmaps",                    // Resource to watch for
+		corev1.NamespaceAll,             // Resource can be found in ALL namespaces
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = types.FarmTemplateLabel // Get only ConfigMaps with this label
+		},
+	)
+}
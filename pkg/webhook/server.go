@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// StartServer serves the admission webhook over HTTPS. Stops the container if the server can't be started.
+func StartServer(address string, certFile string, keyFile string, validator *Validator) {
+	mux := http.NewServeMux()
+	mux.Handle("/validate-service", validator)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	if err := http.ListenAndServeTLS(address, certFile, keyFile, mux); err != nil {
+		panic(err)
+	}
+}
+
+// ParseNetworks reads a comma separated list of CIDRs or IPs.
+func ParseNetworks(list string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		// A single IP is a network with a full mask
+		if ip := net.ParseIP(item); ip != nil {
+			if ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"reflect"
+
+	"github.com/zevenet/kube-nftlb/pkg/validation"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Validator reviews Services before they're created or updated, using the same validation as the Service controller.
+type Validator struct {
+	// Every externalIP must be inside one of these networks (every externalIP is allowed if it's empty)
+	AllowedExternalIPs []*net.IPNet
+
+	// Invalid Services are allowed, and errors are returned as warnings
+	WarnOnly bool
+}
+
+// Review returns an AdmissionReview with the response to the request inside the given AdmissionReview.
+func (v *Validator) Review(review *admissionv1.AdmissionReview) *admissionv1.AdmissionReview {
+	response := &admissionv1.AdmissionResponse{
+		Allowed: true,
+	}
+	if review.Request == nil {
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: "AdmissionReview has no request",
+			Reason:  metav1.StatusReasonBadRequest,
+			Code:    http.StatusBadRequest,
+		}
+		return &admissionv1.AdmissionReview{TypeMeta: review.TypeMeta, Response: response}
+	}
+	response.UID = review.Request.UID
+
+	// The status of a Service isn't validated
+	if review.Request.SubResource != "" {
+		return &admissionv1.AdmissionReview{TypeMeta: review.TypeMeta, Response: response}
+	}
+
+	// Only Services are reviewed
+	service := &corev1.Service{}
+	if err := json.Unmarshal(review.Request.Object.Raw, service); err != nil {
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: fmt.Sprintf("can't decode Service: %s", err.Error()),
+			Reason:  metav1.StatusReasonBadRequest,
+			Code:    http.StatusBadRequest,
+		}
+		return &admissionv1.AdmissionReview{TypeMeta: review.TypeMeta, Response: response}
+	}
+
+	// Updates that don't change anything validated are allowed, so Services that were already invalid can still be
+	// updated (for example, the status annotation written by kube-nftlb)
+	if review.Request.Operation == admissionv1.Update {
+		oldService := &corev1.Service{}
+		if err := json.Unmarshal(review.Request.OldObject.Raw, oldService); err == nil && !validatedFieldsChanged(oldService, service) {
+			return &admissionv1.AdmissionReview{TypeMeta: review.TypeMeta, Response: response}
+		}
+	}
+
+	errs := validation.Service(service, v.AllowedExternalIPs)
+	if len(errs) == 0 {
+		return &admissionv1.AdmissionReview{TypeMeta: review.TypeMeta, Response: response}
+	}
+
+	if v.WarnOnly {
+		for _, err := range errs {
+			response.Warnings = append(response.Warnings, err.Error())
+		}
+	} else {
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: errs.ToAggregate().Error(),
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+
+	return &admissionv1.AdmissionReview{TypeMeta: review.TypeMeta, Response: response}
+}
+
+// validatedFieldsChanged returns true if a Service update changes kube-nftlb annotations or Service fields checked by
+// validation.Service.
+func validatedFieldsChanged(oldService *corev1.Service, newService *corev1.Service) bool {
+	if oldService.Spec.Type != newService.Spec.Type ||
+		!reflect.DeepEqual(oldService.Spec.Ports, newService.Spec.Ports) ||
+		!reflect.DeepEqual(oldService.Spec.ExternalIPs, newService.Spec.ExternalIPs) {
+		return true
+	}
+	return !reflect.DeepEqual(kubeNftlbAnnotations(oldService), kubeNftlbAnnotations(newService))
+}
+
+// kubeNftlbAnnotations returns the annotations of a Service with the kube-nftlb prefix.
+func kubeNftlbAnnotations(service *corev1.Service) map[string]string {
+	annotations := make(map[string]string)
+	for key, value := range service.Annotations {
+		if validation.IsServiceAnnotation(key) {
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
+
+// ServeHTTP reads an AdmissionReview from the request body and writes the reviewed AdmissionReview.
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := json.Marshal(v.Review(review))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
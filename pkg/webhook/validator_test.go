@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	// Farm settings are registered by their annotation processors
+	_ "github.com/zevenet/kube-nftlb/pkg/processor"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// review sends an AdmissionReview fixture (testdata/NAME.json) to the Validator and returns the response.
+func review(t *testing.T, validator *Validator, name string) *admissionv1.AdmissionResponse {
+	t.Helper()
+
+	body, err := ioutil.ReadFile(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	validator.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/validate-service", bytes.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("%s: got HTTP status %d, want %d", name, recorder.Code, http.StatusOK)
+	}
+
+	reviewed := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), reviewed); err != nil {
+		t.Fatalf("%s: %s", name, err.Error())
+	}
+	if reviewed.Response == nil {
+		t.Fatalf("%s: AdmissionReview has no response", name)
+	}
+	return reviewed.Response
+}
+
+func TestReviewAllowed(t *testing.T) {
+	_, network, _ := net.ParseCIDR("192.168.0.0/24")
+	response := review(t, &Validator{AllowedExternalIPs: []*net.IPNet{network}}, "create-valid")
+
+	if !response.Allowed {
+		t.Fatalf("got denied: %v", response.Result)
+	}
+	if response.UID != "7f0b2891-916f-4ed6-b7cd-27bff1815a8c" {
+		t.Fatalf("got UID %q, want the UID of the request", response.UID)
+	}
+}
+
+func TestReviewDenied(t *testing.T) {
+	response := review(t, &Validator{}, "create-invalid")
+
+	if response.Allowed {
+		t.Fatal("got allowed, want denied")
+	}
+	if response.Result == nil || response.Result.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got result %v, want code %d", response.Result, http.StatusUnprocessableEntity)
+	}
+	for _, want := range []string{"roundrobin", "dsr"} {
+		if !strings.Contains(response.Result.Message, want) {
+			t.Fatalf("got message %q, want it to contain %q", response.Result.Message, want)
+		}
+	}
+}
+
+func TestReviewExternalIPNotAllowed(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	response := review(t, &Validator{AllowedExternalIPs: []*net.IPNet{network}}, "create-valid")
+
+	if response.Allowed {
+		t.Fatal("got allowed, want denied")
+	}
+}
+
+func TestReviewWarnOnly(t *testing.T) {
+	response := review(t, &Validator{WarnOnly: true}, "create-invalid")
+
+	if !response.Allowed {
+		t.Fatalf("got denied: %v", response.Result)
+	}
+	if len(response.Warnings) != 2 {
+		t.Fatalf("got warnings %v, want 2 warnings", response.Warnings)
+	}
+}
+
+func TestReviewUpdate(t *testing.T) {
+	// Invalid Services can be updated if nothing validated changes (for example, status annotations)
+	if response := review(t, &Validator{}, "update-status-of-invalid"); !response.Allowed {
+		t.Fatalf("status annotation: got denied: %v", response.Result)
+	}
+
+	if response := review(t, &Validator{}, "update-invalid"); response.Allowed {
+		t.Fatal("invalid annotation: got allowed, want denied")
+	}
+}
+
+func TestReviewMalformed(t *testing.T) {
+	for _, name := range []string{"malformed-object", "no-request"} {
+		response := review(t, &Validator{}, name)
+		if response.Allowed {
+			t.Fatalf("%s: got allowed, want denied", name)
+		}
+		if response.Result == nil || response.Result.Code != http.StatusBadRequest {
+			t.Fatalf("%s: got result %v, want code %d", name, response.Result, http.StatusBadRequest)
+		}
+	}
+
+	// Bodies that aren't an AdmissionReview are rejected before they're reviewed
+	recorder := httptest.NewRecorder()
+	(&Validator{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/validate-service", strings.NewReader("{")))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("got HTTP status %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+
+	recorder = httptest.NewRecorder()
+	(&Validator{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/validate-service", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("got HTTP status %d, want %d", recorder.Code, http.StatusMethodNotAllowed)
+	}
+}